@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 访问日志格式
+	accessLogCombined = "combined"
+	accessLogJSON     = "json"
+
+	// 默认访问日志文件路径
+	defaultAccessLogFile = "./logs/access.log"
+)
+
+// 需要脱敏的查询参数名，名称中包含这些词时同样脱敏
+var sensitiveParams = []string{"token", "auth", "key", "secret", "password", "passwd", "signature", "sig", "credential", "jwt", "code"}
+
+// URL中的用户信息
+var userInfoPattern = regexp.MustCompile(`(://)[^/@?#]*@`)
+
+// 一次代理传输的访问日志
+type accessEntry struct {
+	start          time.Time
+	requestID      string
+	clientIP       string
+	apiKeyID       string
+	method         string
+	request        string // 请求地址，已脱敏
+	proto          string
+	target         string // 上游地址，已脱敏
+	rule           string
+	upstream       string
+	upstreamStatus int
+	upstreamTime   time.Duration
+	status         int
+	bytesIn        int64
+	bytesOut       int64
+	referer        string
+	userAgent      string
+}
+
+var (
+	accessLogWriter logWriter
+	accessLogFormat string
+	accessLogConfig AccessLogConfig
+	accessLogLock   sync.Mutex
+)
+
+// 按配置更新访问日志的输出，创建失败时保留当前输出
+func refreshAccessLog(cfg *Config) {
+	logCfg := cfg.AccessLog
+
+	accessLogLock.Lock()
+	unchanged := reflect.DeepEqual(accessLogConfig, logCfg) && (accessLogWriter != nil || !logCfg.Enabled)
+	accessLogLock.Unlock()
+	if unchanged {
+		return
+	}
+
+	var writer logWriter
+	if logCfg.Enabled {
+		var err error
+		writer, err = newLogWriter(LogConfig{Output: logCfg.Output, File: logCfg.File, MaxSize: logCfg.MaxSize, MaxAge: logCfg.MaxAge})
+		if err != nil {
+			logError("创建访问日志输出失败，继续使用当前输出", "output", logCfg.Output, "error", err)
+			return
+		}
+	}
+
+	accessLogLock.Lock()
+	oldWriter := accessLogWriter
+	accessLogWriter = writer
+	accessLogFormat = logCfg.Format
+	accessLogConfig = logCfg
+	accessLogLock.Unlock()
+
+	if oldWriter != nil {
+		oldWriter.Close()
+	}
+}
+
+// 填充访问日志配置的默认值
+func fillAccessLogDefaults(accessLog *AccessLogConfig) bool {
+	defaults := defaultConfig.AccessLog
+	// 逐项填充，已配置的enabled以及为0的maxSize、maxAge保持不变
+	updated := false
+	if accessLog.Format == "" {
+		accessLog.Format = defaults.Format
+		updated = true
+	}
+	if accessLog.Output == "" {
+		accessLog.Output = defaults.Output
+		updated = true
+	}
+	if accessLog.File == "" {
+		accessLog.File = defaults.File
+		updated = true
+	}
+	return updated
+}
+
+// 校验访问日志配置
+func validateAccessLogConfig(cfg *Config) error {
+	switch cfg.AccessLog.Format {
+	case accessLogCombined, accessLogJSON:
+	default:
+		return &configValidationError{"accessLog.format", fmt.Sprintf("不支持的访问日志格式: %s", cfg.AccessLog.Format)}
+	}
+	switch cfg.AccessLog.Output {
+	case logOutputStdout, logOutputFile:
+	default:
+		return &configValidationError{"accessLog.output", fmt.Sprintf("不支持的访问日志输出: %s", cfg.AccessLog.Output)}
+	}
+	if cfg.AccessLog.Output == logOutputFile && cfg.AccessLog.File == "" {
+		return &configValidationError{"accessLog.file", "访问日志文件路径不能为空"}
+	}
+	if cfg.AccessLog.MaxSize < 0 {
+		return &configValidationError{"accessLog.maxSize", "访问日志文件大小不能为负数"}
+	}
+	if cfg.AccessLog.MaxAge < 0 {
+		return &configValidationError{"accessLog.maxAge", "访问日志保留天数不能为负数"}
+	}
+	return nil
+}
+
+// 是否为需要脱敏的查询参数
+func isSensitiveParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range sensitiveParams {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// 去掉URL中的用户信息和敏感查询参数，支持绝对地址和 /https://... 形式的代理地址
+func redactURL(raw string) string {
+	base, query, hasQuery := strings.Cut(raw, "?")
+	base = userInfoPattern.ReplaceAllString(base, "${1}"+redactedValue+"@")
+	if !hasQuery {
+		return base
+	}
+
+	fragment := ""
+	if i := strings.IndexByte(query, '#'); i >= 0 {
+		query, fragment = query[:i], query[i:]
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		name, _, found := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if found && isSensitiveParam(name) {
+			params[i] = param[:strings.IndexByte(param, '=')+1] + redactedValue
+		}
+	}
+	return base + "?" + strings.Join(params, "&") + fragment
+}
+
+// 创建访问日志记录
+func newAccessEntry(c *gin.Context, target, rule string) *accessEntry {
+	return &accessEntry{
+		start:     time.Now(),
+		requestID: requestIDFromContext(c.Request.Context()),
+		clientIP:  c.ClientIP(),
+		apiKeyID:  c.GetString(apiKeyIDKey),
+		method:    c.Request.Method,
+		request:   redactURL(c.Request.RequestURI),
+		proto:     c.Request.Proto,
+		target:    redactURL(target),
+		rule:      rule,
+		referer:   redactURL(c.Request.Referer()),
+		userAgent: c.Request.UserAgent(),
+	}
+}
+
+// 写入访问日志
+func writeAccessLog(entry *accessEntry) {
+	accessLogLock.Lock()
+	defer accessLogLock.Unlock()
+	if accessLogWriter == nil {
+		return
+	}
+
+	var line []byte
+	if accessLogFormat == accessLogJSON {
+		line = formatAccessJSON(entry)
+	} else {
+		line = formatAccessCombined(entry)
+	}
+	if err := accessLogWriter.writeLog(levelInfo, line); err != nil {
+		logError("写入访问日志失败", "error", err)
+	}
+}
+
+// 空值在combined格式中输出为-
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// Apache combined格式，之后追加代理相关的字段
+func formatAccessCombined(e *accessEntry) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s - %s [%s] %s %d %d %s %s",
+		dashIfEmpty(e.clientIP),
+		dashIfEmpty(e.apiKeyID),
+		e.start.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(e.method+" "+e.request+" "+e.proto),
+		e.status,
+		e.bytesOut,
+		strconv.Quote(dashIfEmpty(e.referer)),
+		strconv.Quote(dashIfEmpty(e.userAgent)),
+	)
+	fmt.Fprintf(&buf, " request_id=%s target=%s rule=%s upstream=%s upstream_status=%d upstream_time=%.3f bytes_in=%d duration=%.3f\n",
+		dashIfEmpty(e.requestID),
+		strconv.Quote(e.target),
+		dashIfEmpty(e.rule),
+		dashIfEmpty(e.upstream),
+		e.upstreamStatus,
+		e.upstreamTime.Seconds(),
+		e.bytesIn,
+		time.Since(e.start).Seconds(),
+	)
+	return buf.Bytes()
+}
+
+// JSON格式，每行一个对象
+func formatAccessJSON(e *accessEntry) []byte {
+	fields := []interface{}{
+		"time", e.start.Format(time.RFC3339Nano),
+		"requestId", e.requestID,
+		"clientIp", e.clientIP,
+		"apiKeyId", e.apiKeyID,
+		"method", e.method,
+		"request", e.request,
+		"proto", e.proto,
+		"target", e.target,
+		"rule", e.rule,
+		"upstream", e.upstream,
+		"upstreamStatus", e.upstreamStatus,
+		"upstreamTime", e.upstreamTime.Seconds(),
+		"status", e.status,
+		"bytesIn", e.bytesIn,
+		"bytesOut", e.bytesOut,
+		"duration", time.Since(e.start).Seconds(),
+		"referer", e.referer,
+		"userAgent", e.userAgent,
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeJSONValue(&buf, fields[i])
+		buf.WriteByte(':')
+		writeJSONValue(&buf, fields[i+1])
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
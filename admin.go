@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 脱敏后的占位值
+const redactedValue = "******"
+
+// 初始化管理API路由
+func initAdminRoutes(router *gin.Engine) {
+	adminGroup := router.Group("/api/admin", adminAuth())
+	{
+		// 查看和修改主配置文件中的配置
+		adminGroup.GET("/config", getAdminConfig)
+		adminGroup.PATCH("/config", patchAdminConfig)
+		// 查看合并conf.d后实际生效的配置
+		adminGroup.GET("/config/effective", getEffectiveConfig)
+		// 查看备用上游健康状态
+		adminGroup.GET("/upstreams", getUpstreams)
+		// 查看出站本地地址的使用统计
+		adminGroup.GET("/egress", getEgressStats)
+		// 查看进行中的正向代理隧道
+		adminGroup.GET("/tunnels", getTunnels)
+		// 查看、实时推送和取消进行中的代理传输
+		adminGroup.GET("/transfers", getTransfers)
+		adminGroup.GET("/transfers/stream", streamTransfers)
+		adminGroup.DELETE("/transfers/:id", deleteTransfer)
+		// 按仓库、域名和文件的使用统计
+		adminGroup.GET("/stats", getStats)
+		adminGroup.GET("/stats/repos", getTopRepos)
+		adminGroup.GET("/stats/hosts", getTopHosts)
+		adminGroup.GET("/stats/files", getTopFiles)
+		adminGroup.GET("/stats/traffic", getTraffic)
+		// 控制台概览
+		adminGroup.GET("/overview", getOverview)
+		// 平滑重启
+		adminGroup.POST("/restart", restartServer)
+	}
+}
+
+// 管理API认证中间件
+func adminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		configLock.RLock()
+		admin := config.Admin
+		configLock.RUnlock()
+
+		// 未启用管理API时表现为路由不存在
+		if !admin.Enabled {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "管理API未启用"})
+			return
+		}
+
+		username, password, ok := c.Request.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(username), []byte(admin.Username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(admin.Password)) != 1 {
+			c.Header("WWW-Authenticate", `Basic realm="FastCode Admin"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// 获取脱敏后的配置
+func redactConfig(cfg *Config) *Config {
+	redacted := cloneConfig(cfg)
+	if redacted.Admin.Password != "" {
+		redacted.Admin.Password = redactedValue
+	}
+	for i, p := range redacted.Outbound.Proxies {
+		redacted.Outbound.Proxies[i].URL = redactProxyURL(p.URL)
+	}
+	for _, policy := range redacted.Policies {
+		for i := range policy.APIKeys {
+			policy.APIKeys[i].Key = redactedValue
+		}
+	}
+	for key := range redacted.Tracing.Headers {
+		redacted.Tracing.Headers[key] = redactedValue
+	}
+	return redacted
+}
+
+// 还原请求中未修改的脱敏字段
+func restoreRedacted(patched, current *Config) {
+	if patched.Admin.Password == redactedValue {
+		patched.Admin.Password = current.Admin.Password
+	}
+	for i, p := range patched.Outbound.Proxies {
+		for _, original := range current.Outbound.Proxies {
+			if original.Name == p.Name {
+				patched.Outbound.Proxies[i].URL = restoreProxyURL(p.URL, original.URL)
+			}
+		}
+	}
+	// 新增的请求头没有原来的值，保留占位值，由findRedacted拒绝
+	for key, value := range patched.Tracing.Headers {
+		if original, ok := current.Tracing.Headers[key]; ok && value == redactedValue {
+			patched.Tracing.Headers[key] = original
+		}
+	}
+	for name, policy := range patched.Policies {
+		for i, key := range policy.APIKeys {
+			if key.Key != redactedValue {
+				continue
+			}
+			for _, original := range current.Policies[name].APIKeys {
+				if original.ID == key.ID {
+					policy.APIKeys[i].Key = original.Key
+				}
+			}
+		}
+	}
+}
+
+// 按JSON Merge Patch（RFC 7386）修改配置：对象逐项合并，列表和其他值整体替换，值为null时删除该项
+// 例如只提交admin.enabled时，管理员用户名和密码保持不变
+func applyConfigPatch(current *Config, body []byte) (*Config, error) {
+	merged, err := configToMap(current)
+	if err != nil {
+		return nil, err
+	}
+	patch := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&patch); err != nil {
+		return nil, err
+	}
+	mergePatch(merged, patch)
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	var patched Config
+	decoder = json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patched); err != nil {
+		return nil, err
+	}
+	return &patched, nil
+}
+
+// 将修改合并到配置中
+func mergePatch(dst, patch map[string]interface{}) {
+	for key, value := range patch {
+		if value == nil {
+			delete(dst, key)
+			continue
+		}
+		if patchValue, ok := value.(map[string]interface{}); ok {
+			if dstValue, ok := dst[key].(map[string]interface{}); ok {
+				mergePatch(dstValue, patchValue)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// 查找无法还原的脱敏字段，返回配置项路径
+// 例如原来没有设置密码时直接提交了占位值，这类值不能写入配置文件
+func findRedacted(cfg *Config) string {
+	if cfg.Admin.Password == redactedValue {
+		return "admin.password"
+	}
+	for i, p := range cfg.Outbound.Proxies {
+		if proxyURLRedacted(p.URL) {
+			return "outbound.proxies[" + strconv.Itoa(i) + "].url"
+		}
+	}
+	for key, value := range cfg.Tracing.Headers {
+		if value == redactedValue {
+			return "tracing.headers." + key
+		}
+	}
+	for name, policy := range cfg.Policies {
+		for _, key := range policy.APIKeys {
+			if key.Key == redactedValue {
+				return "policies." + name + ".apiKeys"
+			}
+		}
+	}
+	return ""
+}
+
+// 获取主配置文件中的配置，与修改配置时使用的内容相同
+// 不包含conf.d中的配置片段，避免修改后写回主配置文件造成重复
+func getAdminConfig(c *gin.Context) {
+	configLock.RLock()
+	current := redactConfig(fileConfig)
+	configLock.RUnlock()
+
+	c.JSON(http.StatusOK, current)
+}
+
+// 获取合并conf.d后实际生效的配置，只用于查看
+func getEffectiveConfig(c *gin.Context) {
+	configLock.RLock()
+	current := redactConfig(config)
+	configLock.RUnlock()
+
+	c.JSON(http.StatusOK, current)
+}
+
+// 修改配置，校验通过后写回主配置文件并立即生效
+// 修改作用于主配置文件中的配置，conf.d中的配置片段不会被修改
+func patchAdminConfig(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取请求体失败: " + err.Error()})
+		return
+	}
+
+	configWriteLock.Lock()
+	defer configWriteLock.Unlock()
+
+	configLock.RLock()
+	current := cloneConfig(fileConfig)
+	configLock.RUnlock()
+
+	// 在主配置文件内容上应用修改，未出现的字段保持不变
+	patched, err := applyConfigPatch(current, body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "解析配置失败: " + err.Error()})
+		return
+	}
+
+	// 版本号和UUID不允许修改
+	patched.Version = current.Version
+	patched.UUID = current.UUID
+	restoreRedacted(patched, current)
+	if field := findRedacted(patched); field != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "脱敏字段没有对应的原始值，请填写实际的值", "field": field})
+		return
+	}
+
+	// 重新合并conf.d配置片段后再校验
+	effective, provenance, err := applyConfigIncludes(configFilePath, patched)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加载conf.d配置片段失败: " + err.Error()})
+		return
+	}
+
+	if err := validateConfig(effective); err != nil {
+		recordConfigReload("admin", err)
+		var validationErr *configValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   validationErr.Message,
+				"field":   validationErr.Field,
+				"sources": provenance.lookup(validationErr.Field),
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := writeConfigFile(configFilePath, patched); err != nil {
+		logError("写入配置文件失败", "path", configFilePath, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "写入配置文件失败: " + err.Error()})
+		return
+	}
+
+	swapConfig(patched, effective)
+	recordConfigReload("admin", nil)
+	logInfo("配置已通过管理API更新")
+
+	c.JSON(http.StatusOK, redactConfig(patched))
+}
+
+// 平滑重启，新进程接管监听后当前进程排空并退出
+func restartServer(c *gin.Context) {
+	if err := requestRestart(); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "新进程已就绪，当前进程正在排空连接"})
+}
@@ -10,21 +10,20 @@ import (
 func initAPIRoutes(router *gin.Engine) {
 	apiGroup := router.Group("/api")
 	{
-		// 健康检查
-		apiGroup.GET("/health", healthCheck)
+		// 健康检查，/health 与存活检查相同，保留用于兼容旧的存活探针
+		apiGroup.GET("/health", healthLive)
+		apiGroup.GET("/health/live", healthLive)
+		apiGroup.GET("/health/ready", healthReady)
 		// 程序版本查询
 		apiGroup.GET("/version", getVersion)
 		// UUID查询
 		apiGroup.GET("/uuid", getUUID)
+		// 预览匿名使用统计的上报内容
+		apiGroup.GET("/telemetry", getTelemetryPreview)
 	}
-}
 
-// 健康检查
-func healthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "ok",
-		"message": "FastCode is running",
-	})
+	// Prometheus监控指标
+	router.GET(metricsPath, getMetrics)
 }
 
 // 获取程序版本
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 由Forwarded请求头转换得到的客户端地址链，只在服务内部使用
+const forwardedForHeader = "X-FastCode-Forwarded-For"
+
+// 可信代理，启动时从配置中读取
+var trustedProxyNets []*net.IPNet
+
+// 解析可信代理，支持单个IP和CIDR
+func parseTrustedProxy(item string) (*net.IPNet, error) {
+	item = strings.TrimSpace(item)
+	if _, ipNet, err := net.ParseCIDR(item); err == nil {
+		return ipNet, nil
+	}
+	ip := net.ParseIP(item)
+	if ip == nil {
+		return nil, fmt.Errorf("可信代理地址无效: %s", item)
+	}
+	bits := 128
+	if ip.To4() != nil {
+		ip, bits = ip.To4(), 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// 配置Gin获取客户端真实IP的方式
+func initClientIP(router *gin.Engine) {
+	configLock.RLock()
+	items := config.TrustedProxies
+	configLock.RUnlock()
+
+	trustedProxyNets = nil
+	for _, item := range items {
+		if ipNet, err := parseTrustedProxy(item); err == nil {
+			trustedProxyNets = append(trustedProxyNets, ipNet)
+		}
+	}
+
+	// 只信任配置的代理发送的转发头，未配置时直接使用连接地址
+	if err := router.SetTrustedProxies(items); err != nil {
+		logError("设置可信代理失败", "error", err)
+	}
+	router.ForwardedByClientIP = true
+	router.RemoteIPHeaders = []string{forwardedForHeader, "X-Forwarded-For", "X-Real-IP"}
+	router.Use(convertForwardedHeader)
+}
+
+// 是否为可信代理
+func isTrustedProxy(ip net.IP) bool {
+	for _, ipNet := range trustedProxyNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 将RFC 7239的Forwarded请求头转换为X-Forwarded-For格式的地址链，交由Gin解析
+func convertForwardedHeader(c *gin.Context) {
+	c.Request.Header.Del(forwardedForHeader)
+	if value := c.Request.Header.Get("Forwarded"); value != "" {
+		if chain := parseForwardedFor(value); len(chain) > 0 {
+			c.Request.Header.Set(forwardedForHeader, strings.Join(chain, ", "))
+		}
+	}
+	c.Next()
+}
+
+// 解析Forwarded请求头中各代理记录的for参数
+func parseForwardedFor(value string) []string {
+	var chain []string
+	for _, element := range strings.Split(value, ",") {
+		for _, pair := range strings.Split(element, ";") {
+			key, val, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if !found || !strings.EqualFold(key, "for") {
+				continue
+			}
+			val = strings.Trim(val, `"`)
+			// 去掉端口，IPv6地址带有方括号
+			if host, _, err := net.SplitHostPort(val); err == nil {
+				val = host
+			}
+			chain = append(chain, strings.Trim(val, "[]"))
+		}
+	}
+	return chain
+}
+
+// 设置发往上游的转发头：默认删除客户端传入的转发头，配置了forwardHeaders时按可信代理重新生成
+// 配置了forwardRequestId时发送本次请求的请求ID
+func setForwardedHeaders(c *gin.Context, req *http.Request) {
+	for _, key := range []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "X-Real-IP", forwardedForHeader, requestIDHeader} {
+		req.Header.Del(key)
+	}
+
+	configLock.RLock()
+	forward := config.ForwardHeaders
+	forwardRequestID := config.ForwardRequestID
+	configLock.RUnlock()
+	if id := requestIDFromContext(c.Request.Context()); forwardRequestID && id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+	if !forward {
+		return
+	}
+
+	peer := c.RemoteIP()
+	trusted := isTrustedProxy(net.ParseIP(peer))
+
+	// 只保留可信代理传来的地址链
+	chain := ""
+	proto, host := "http", c.Request.Host
+	if c.Request.TLS != nil {
+		proto = "https"
+	}
+	if trusted {
+		chain = c.Request.Header.Get("X-Forwarded-For")
+		if chain == "" {
+			chain = c.Request.Header.Get(forwardedForHeader)
+		}
+		if value := c.Request.Header.Get("X-Forwarded-Proto"); value != "" {
+			proto = value
+		}
+		if value := c.Request.Header.Get("X-Forwarded-Host"); value != "" {
+			host = value
+		}
+	}
+	if chain != "" {
+		chain += ", "
+	}
+	req.Header.Set("X-Forwarded-For", chain+peer)
+	req.Header.Set("X-Forwarded-Proto", proto)
+	req.Header.Set("X-Forwarded-Host", host)
+}
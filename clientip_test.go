@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseTrustedProxy(t *testing.T) {
+	tests := []struct {
+		item    string
+		want    string
+		wantErr bool
+	}{
+		{"10.0.0.1", "10.0.0.1/32", false},
+		{" 10.0.0.0/8 ", "10.0.0.0/8", false},
+		{"2001:db8::1", "2001:db8::1/128", false},
+		{"2001:db8::/32", "2001:db8::/32", false},
+		{"proxy.example.com", "", true},
+		{"10.0.0.0/33", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.item, func(t *testing.T) {
+			ipNet, err := parseTrustedProxy(tt.item)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTrustedProxy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && ipNet.String() != tt.want {
+				t.Errorf("parseTrustedProxy() = %s, want %s", ipNet, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseForwardedFor(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"for=192.0.2.60", []string{"192.0.2.60"}},
+		{"for=192.0.2.60;proto=https;by=203.0.113.43", []string{"192.0.2.60"}},
+		{"for=192.0.2.43, for=198.51.100.17", []string{"192.0.2.43", "198.51.100.17"}},
+		{`For="[2001:db8:cafe::17]:4711"`, []string{"2001:db8:cafe::17"}},
+		{`for="192.0.2.60:8080"`, []string{"192.0.2.60"}},
+		{"proto=https;by=203.0.113.43", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := parseForwardedFor(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseForwardedFor(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetForwardedHeaders(t *testing.T) {
+	trustedNet, _ := parseTrustedProxy("10.0.0.0/8")
+	tests := []struct {
+		name           string
+		forwardHeaders bool
+		remoteAddr     string
+		header         http.Header
+		want           http.Header
+	}{
+		{
+			name:       "默认删除客户端传入的转发头",
+			remoteAddr: "192.0.2.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"1.2.3.4"}, "Forwarded": {"for=1.2.3.4"}, "X-Real-Ip": {"1.2.3.4"}},
+			want:       http.Header{},
+		},
+		{
+			name:           "不可信的客户端重新生成转发头",
+			forwardHeaders: true,
+			remoteAddr:     "192.0.2.1:1234",
+			header:         http.Header{"X-Forwarded-For": {"1.2.3.4"}, "X-Forwarded-Proto": {"https"}},
+			want:           http.Header{"X-Forwarded-For": {"192.0.2.1"}, "X-Forwarded-Proto": {"http"}, "X-Forwarded-Host": {"fastcode.example"}},
+		},
+		{
+			name:           "可信代理保留地址链",
+			forwardHeaders: true,
+			remoteAddr:     "10.0.0.1:1234",
+			header:         http.Header{"X-Forwarded-For": {"1.2.3.4"}, "X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"gh.example"}},
+			want:           http.Header{"X-Forwarded-For": {"1.2.3.4, 10.0.0.1"}, "X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"gh.example"}},
+		},
+		{
+			name:           "可信代理使用Forwarded中的地址链",
+			forwardHeaders: true,
+			remoteAddr:     "10.0.0.1:1234",
+			header:         http.Header{http.CanonicalHeaderKey(forwardedForHeader): {"1.2.3.4"}},
+			want:           http.Header{"X-Forwarded-For": {"1.2.3.4, 10.0.0.1"}, "X-Forwarded-Proto": {"http"}, "X-Forwarded-Host": {"fastcode.example"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.ForwardHeaders = tt.forwardHeaders
+			setTestConfig(t, cfg)
+			oldNets := trustedProxyNets
+			trustedProxyNets = []*net.IPNet{trustedNet}
+			t.Cleanup(func() { trustedProxyNets = oldNets })
+
+			gin.SetMode(gin.TestMode)
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "http://fastcode.example/https://github.com/a/b", nil)
+			c.Request.RemoteAddr = tt.remoteAddr
+			c.Request.Header = tt.header.Clone()
+
+			upstreamReq := httptest.NewRequest(http.MethodGet, "https://github.com/a/b", nil)
+			upstreamReq.Header = tt.header.Clone()
+			setForwardedHeaders(c, upstreamReq)
+			if !reflect.DeepEqual(upstreamReq.Header, tt.want) {
+				t.Errorf("上游请求头 = %v, want %v", upstreamReq.Header, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 已经压缩过的文件扩展名，即使上游返回文本类型也不再压缩
+var compressedExtensions = []string{
+	".zip", ".gz", ".tgz", ".bz2", ".tbz", ".xz", ".txz", ".zst", ".lz4", ".lzma", ".br",
+	".7z", ".rar", ".jar", ".war", ".whl", ".apk", ".deb", ".rpm", ".dmg", ".nupkg", ".crx",
+}
+
+// 压缩响应体的写入器
+type compressWriter interface {
+	io.Writer
+	Close() error
+}
+
+// 不做处理的写入器
+type nopCompressWriter struct {
+	io.Writer
+}
+
+func (nopCompressWriter) Close() error {
+	return nil
+}
+
+// 解压上游gzip响应后写入客户端，解压在独立协程中进行，写入的仍是上游原始数据，不影响断点续传的偏移量
+type gunzipWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func newGunzipWriter(dst io.Writer) *gunzipWriter {
+	pr, pw := io.Pipe()
+	w := &gunzipWriter{pw: pw, done: make(chan error, 1)}
+	go func() {
+		zr, err := gzip.NewReader(pr)
+		if err == nil {
+			_, err = io.Copy(dst, zr)
+		} else if errors.Is(err, io.EOF) {
+			// 空响应体
+			err = nil
+		}
+		// 解压或写入失败时让上游数据的写入也失败，结束传输
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+	return w
+}
+
+func (w *gunzipWriter) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *gunzipWriter) Close() error {
+	w.pw.Close()
+	return <-w.done
+}
+
+// 填充压缩配置的默认值
+func fillCompressionDefaults(compression *CompressionConfig) bool {
+	// 逐项填充，已配置的enabled和minSize保持不变
+	updated := false
+	if compression.Types == nil {
+		compression.Types = append([]string{}, defaultConfig.Compression.Types...)
+		updated = true
+	}
+	if compression.Level == 0 {
+		compression.Level = defaultConfig.Compression.Level
+		updated = true
+	}
+	return updated
+}
+
+// 校验压缩配置
+func validateCompressionConfig(cfg *Config) error {
+	if cfg.Compression.MinSize < 0 {
+		return &configValidationError{"compression.minSize", "最小压缩大小不能为负数"}
+	}
+	if cfg.Compression.Level < gzip.BestSpeed || cfg.Compression.Level > gzip.BestCompression {
+		return &configValidationError{"compression.level", "压缩级别必须在1到9之间"}
+	}
+	for _, pattern := range cfg.Compression.Types {
+		if _, err := path.Match(pattern, ""); pattern == "" || err != nil {
+			return &configValidationError{"compression.types", fmt.Sprintf("MIME类型无效: %q", pattern)}
+		}
+	}
+	return nil
+}
+
+// 设置发往上游的Accept-Encoding：统一请求gzip，再按客户端支持的编码处理；范围请求保留客户端的请求头，避免偏移量对应到不同编码
+func setUpstreamEncoding(req *http.Request) {
+	if req.Header.Get("Range") != "" {
+		return
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+}
+
+// 解析Accept-Encoding请求头，返回各编码的权重
+func parseAcceptEncoding(value string) map[string]float64 {
+	weights := map[string]float64{}
+	for _, item := range strings.Split(value, ",") {
+		name, params, _ := strings.Cut(item, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if key, val, found := strings.Cut(strings.TrimSpace(params), "="); found && strings.TrimSpace(key) == "q" {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+				q = parsed
+			}
+		}
+		weights[name] = q
+	}
+	return weights
+}
+
+// 客户端对某个编码的权重，未列出时使用*的权重
+func encodingWeight(weights map[string]float64, encoding string) float64 {
+	if q, ok := weights[encoding]; ok {
+		return q
+	}
+	if encoding == "gzip" {
+		if q, ok := weights["x-gzip"]; ok {
+			return q
+		}
+	}
+	return weights["*"]
+}
+
+// 选择压缩编码，权重相同时优先gzip，客户端都不支持时返回空
+func chooseEncoding(weights map[string]float64) string {
+	gzipWeight := encodingWeight(weights, "gzip")
+	deflateWeight := encodingWeight(weights, "deflate")
+	switch {
+	case gzipWeight > 0 && gzipWeight >= deflateWeight:
+		return "gzip"
+	case deflateWeight > 0:
+		return "deflate"
+	}
+	return ""
+}
+
+// 响应是否适合压缩：文本类型且不是压缩文件
+func compressible(resp *http.Response, types []string) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	matched := false
+	for _, pattern := range types {
+		if ok, _ := path.Match(pattern, mediaType); ok {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+	if resp.Request != nil {
+		name := strings.ToLower(resp.Request.URL.Path)
+		for _, ext := range compressedExtensions {
+			if strings.HasSuffix(name, ext) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// 在响应的Vary头中加入Accept-Encoding
+func addVaryAcceptEncoding(header http.Header) {
+	for _, value := range header.Values("Vary") {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item == "*" || strings.EqualFold(item, "Accept-Encoding") {
+				return
+			}
+		}
+	}
+	header.Add("Vary", "Accept-Encoding")
+}
+
+// 内容编码改变后的响应头：长度未知，强ETag改为弱ETag，不再支持范围请求
+func setEncodedHeaders(header http.Header, encoding string) {
+	if encoding == "" {
+		header.Del("Content-Encoding")
+	} else {
+		header.Set("Content-Encoding", encoding)
+	}
+	header.Del("Content-Length")
+	header.Del("Accept-Ranges")
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+// 按客户端支持的编码设置响应头，返回写入响应体的写入器，响应头需已复制到客户端
+func responseEncoder(c *gin.Context, resp *http.Response) (compressWriter, error) {
+	configLock.RLock()
+	compression := config.Compression
+	configLock.RUnlock()
+
+	header := c.Writer.Header()
+	weights := parseAcceptEncoding(c.Request.Header.Get("Accept-Encoding"))
+	hasBody := c.Request.Method != http.MethodHead
+
+	switch encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); encoding {
+	case "gzip", "x-gzip":
+		// 上游的gzip响应，客户端不支持时解压
+		if resp.Request != nil && resp.Request.Header.Get("Range") == "" {
+			addVaryAcceptEncoding(header)
+		}
+		if encodingWeight(weights, "gzip") > 0 || resp.StatusCode == http.StatusPartialContent {
+			return nopCompressWriter{c.Writer}, nil
+		}
+		setEncodedHeaders(header, "")
+		if !hasBody {
+			return nopCompressWriter{c.Writer}, nil
+		}
+		return newGunzipWriter(c.Writer), nil
+	case "", "identity":
+	default:
+		// 其他编码由客户端自行协商，原样返回
+		return nopCompressWriter{c.Writer}, nil
+	}
+
+	if !compression.Enabled || resp.StatusCode != http.StatusOK || !compressible(resp, compression.Types) {
+		return nopCompressWriter{c.Writer}, nil
+	}
+	if resp.ContentLength >= 0 && resp.ContentLength < compression.MinSize {
+		return nopCompressWriter{c.Writer}, nil
+	}
+
+	addVaryAcceptEncoding(header)
+	encoding := chooseEncoding(weights)
+	if encoding == "" {
+		return nopCompressWriter{c.Writer}, nil
+	}
+	setEncodedHeaders(header, encoding)
+	if !hasBody {
+		return nopCompressWriter{c.Writer}, nil
+	}
+	if encoding == "gzip" {
+		return gzip.NewWriterLevel(c.Writer, compression.Level)
+	}
+	return zlib.NewWriterLevel(c.Writer, compression.Level)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestChooseEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"gzip, deflate, br", "gzip"},
+		{"deflate, gzip;q=0.5", "deflate"},
+		{"gzip;q=0.5, deflate;q=0.5", "gzip"},
+		{"x-gzip", "gzip"},
+		{"GZIP;Q=1", "gzip"},
+		{"gzip;q=0, deflate", "deflate"},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"*", "gzip"},
+		{"*;q=0, deflate", "deflate"},
+		{"br", ""},
+		{"identity", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			if got := chooseEncoding(parseAcceptEncoding(tt.acceptEncoding)); got != tt.want {
+				t.Errorf("chooseEncoding(%q) = %q, want %q", tt.acceptEncoding, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompressible(t *testing.T) {
+	types := []string{"text/*", "application/json"}
+	tests := []struct {
+		contentType string
+		path        string
+		want        bool
+	}{
+		{"text/plain; charset=utf-8", "/owner/repo/main/README.md", true},
+		{"application/json", "/repos/owner/repo", true},
+		{"application/octet-stream", "/owner/repo/main/app.bin", false},
+		{"text/plain", "/owner/repo/releases/download/v1/src.tar.gz", false},
+		{"text/plain", "/owner/repo/archive/main.ZIP", false},
+		{"", "/owner/repo/main/README.md", false},
+		{"text/", "/owner/repo/main/README.md", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType+" "+tt.path, func(t *testing.T) {
+			resp := &http.Response{
+				Header:  http.Header{"Content-Type": {tt.contentType}},
+				Request: httptest.NewRequest(http.MethodGet, "https://raw.githubusercontent.com"+tt.path, nil),
+			}
+			if got := compressible(resp, types); got != tt.want {
+				t.Errorf("compressible() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddVaryAcceptEncoding(t *testing.T) {
+	tests := []struct {
+		vary []string
+		want []string
+	}{
+		{nil, []string{"Accept-Encoding"}},
+		{[]string{"Origin"}, []string{"Origin", "Accept-Encoding"}},
+		{[]string{"Origin, accept-encoding"}, []string{"Origin, accept-encoding"}},
+		{[]string{"*"}, []string{"*"}},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.vary, ","), func(t *testing.T) {
+			header := http.Header{}
+			for _, value := range tt.vary {
+				header.Add("Vary", value)
+			}
+			addVaryAcceptEncoding(header)
+			if got := header.Values("Vary"); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("Vary = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 解码响应体
+func decodeBody(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	var r io.Reader = bytes.NewReader(body)
+	var err error
+	switch encoding {
+	case "gzip":
+		r, err = gzip.NewReader(r)
+	case "deflate":
+		r, err = zlib.NewReader(r)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	io.WriteString(zw, s)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestResponseEncoder(t *testing.T) {
+	content := strings.Repeat("FastCode ", 200)
+	tests := []struct {
+		name             string
+		acceptEncoding   string
+		upstreamEncoding string
+		contentType      string
+		path             string
+		wantEncoding     string
+	}{
+		{"压缩文本", "gzip, deflate", "", "text/plain", "/README.md", "gzip"},
+		{"使用deflate", "deflate", "", "text/plain", "/README.md", "deflate"},
+		{"客户端不支持压缩", "", "", "text/plain", "/README.md", ""},
+		{"二进制文件不压缩", "gzip", "", "application/octet-stream", "/app.bin", ""},
+		{"压缩文件不压缩", "gzip", "", "text/plain", "/src.tar.gz", ""},
+		{"上游gzip原样返回", "gzip", "gzip", "text/plain", "/README.md", "gzip"},
+		{"客户端不支持时解压", "", "gzip", "text/plain", "/README.md", ""},
+		{"其他编码原样返回", "", "br", "text/plain", "/README.md", "br"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Compression = CompressionConfig{Enabled: true, MinSize: 100, Level: 6, Types: []string{"text/*"}}
+			setTestConfig(t, cfg)
+
+			upstreamBody := []byte(content)
+			if tt.upstreamEncoding == "gzip" {
+				upstreamBody = gzipBytes(t, content)
+			}
+			resp := &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{"Content-Type": {tt.contentType}, "Etag": {`"v1"`}},
+				ContentLength: int64(len(upstreamBody)),
+				Request:       httptest.NewRequest(http.MethodGet, "https://raw.githubusercontent.com"+tt.path, nil),
+			}
+			if tt.upstreamEncoding != "" {
+				resp.Header.Set("Content-Encoding", tt.upstreamEncoding)
+			}
+
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/https://raw.githubusercontent.com"+tt.path, nil)
+			c.Request.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			for key, values := range resp.Header {
+				c.Writer.Header()[key] = values
+			}
+
+			writer, err := responseEncoder(c, resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := writer.Write(upstreamBody); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if tt.wantEncoding == "br" {
+				return
+			}
+			if got := decodeBody(t, tt.wantEncoding, w.Body.Bytes()); got != content {
+				t.Errorf("解码后的响应体长度 = %d, want %d", len(got), len(content))
+			}
+			// 内容编码改变后不能再使用强ETag
+			if tt.wantEncoding != tt.upstreamEncoding && w.Header().Get("Etag") != `W/"v1"` {
+				t.Errorf("ETag = %q, want W/\"v1\"", w.Header().Get("Etag"))
+			}
+		})
+	}
+}
+
+func TestFillCompressionDefaults(t *testing.T) {
+	// 只缺少types时保留已配置的enabled和minSize
+	compression := CompressionConfig{Enabled: false, MinSize: 0, Level: 9}
+	if !fillCompressionDefaults(&compression) {
+		t.Error("缺少字段时应返回true")
+	}
+	if compression.Enabled || compression.MinSize != 0 || compression.Level != 9 {
+		t.Errorf("不应覆盖已配置的字段: %+v", compression)
+	}
+	if len(compression.Types) != len(defaultConfig.Compression.Types) {
+		t.Errorf("Types = %v, want 默认类型", compression.Types)
+	}
+	compression.Types[0] = "changed"
+	if defaultConfig.Compression.Types[0] == "changed" {
+		t.Error("填充的Types不应与默认配置共用底层数组")
+	}
+
+	compression = CompressionConfig{Enabled: true, Types: []string{}}
+	if !fillCompressionDefaults(&compression) || compression.Level != defaultConfig.Compression.Level || len(compression.Types) != 0 {
+		t.Errorf("应只填充level: %+v", compression)
+	}
+	if fillCompressionDefaults(&compression) {
+		t.Error("没有缺少的字段时应返回false")
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 配置片段目录名，位于主配置文件所在目录下
+const configIncludeDir = "conf.d"
+
+// 配置来源记录，键为配置项路径（如 whiteList、admin.password），值为提供该配置项的文件列表
+type configProvenance map[string][]string
+
+// 合并conf.d目录中的配置片段
+// 片段按文件名字典序依次合并：列表追加，标量覆盖，对象逐项合并
+func applyConfigIncludes(mainPath string, mainConfig *Config) (*Config, configProvenance, error) {
+	provenance := configProvenance{}
+
+	merged, err := configToMap(mainConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	recordProvenance(merged, "", mainPath, provenance)
+
+	includePaths, err := listConfigIncludes(filepath.Join(filepath.Dir(mainPath), configIncludeDir))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, includePath := range includePaths {
+		fragment, err := readConfigFragment(includePath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", includePath, err)
+		}
+		mergeConfigMap(merged, fragment, "", includePath, provenance)
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, nil, err
+	}
+	var effectiveConfig Config
+	if err := json.Unmarshal(data, &effectiveConfig); err != nil {
+		return nil, nil, fmt.Errorf("合并后的配置无效: %v", err)
+	}
+
+	// 版本号和UUID只能来自主配置文件
+	effectiveConfig.Version = mainConfig.Version
+	effectiveConfig.UUID = mainConfig.UUID
+
+	return &effectiveConfig, provenance, nil
+}
+
+// 列出conf.d目录中的配置片段，目录不存在时返回空列表
+func listConfigIncludes(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if isYAMLPath(name) || strings.HasSuffix(name, ".json") {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// 读取配置片段
+func readConfigFragment(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fragment := map[string]interface{}{}
+	if isYAMLPath(path) {
+		if err := yaml.Unmarshal(data, &fragment); err != nil {
+			return nil, err
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&fragment); err != nil {
+			return nil, err
+		}
+	}
+	return fragment, nil
+}
+
+// 合并配置片段
+func mergeConfigMap(dst, src map[string]interface{}, prefix, source string, provenance configProvenance) {
+	for key, value := range src {
+		path := joinConfigPath(prefix, key)
+		switch srcValue := value.(type) {
+		case map[string]interface{}:
+			if dstValue, ok := dst[key].(map[string]interface{}); ok {
+				mergeConfigMap(dstValue, srcValue, path, source, provenance)
+				continue
+			}
+			dst[key] = srcValue
+			recordProvenance(srcValue, path, source, provenance)
+		case []interface{}:
+			if dstValue, ok := dst[key].([]interface{}); ok {
+				dst[key] = append(dstValue, srcValue...)
+				provenance[path] = append(provenance[path], source)
+				continue
+			}
+			dst[key] = srcValue
+			provenance[path] = []string{source}
+		default:
+			dst[key] = value
+			provenance[path] = []string{source}
+		}
+	}
+}
+
+// 记录配置项来源
+func recordProvenance(values map[string]interface{}, prefix, source string, provenance configProvenance) {
+	for key, value := range values {
+		path := joinConfigPath(prefix, key)
+		if nested, ok := value.(map[string]interface{}); ok {
+			recordProvenance(nested, path, source, provenance)
+			continue
+		}
+		// 空列表不记录来源，避免校验失败时误报
+		if list, ok := value.([]interface{}); ok && len(list) == 0 {
+			continue
+		}
+		provenance[path] = []string{source}
+	}
+}
+
+// 拼接配置项路径
+func joinConfigPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// 查找配置项的来源，包括其上级和下级配置项
+func (p configProvenance) lookup(field string) []string {
+	seen := map[string]bool{}
+	var sources []string
+	for path, files := range p {
+		related := path == field ||
+			strings.HasPrefix(path, field+".") ||
+			strings.HasPrefix(field, path+".")
+		if !related {
+			continue
+		}
+		for _, file := range files {
+			if !seen[file] {
+				seen[file] = true
+				sources = append(sources, file)
+			}
+		}
+	}
+	// 主配置文件在前，conf.d片段按合并顺序排列
+	sort.Slice(sources, func(i, j int) bool {
+		iInclude := isConfigInclude(sources[i])
+		jInclude := isConfigInclude(sources[j])
+		if iInclude != jInclude {
+			return !iInclude
+		}
+		return sources[i] < sources[j]
+	})
+	return sources
+}
+
+// 判断文件是否为conf.d中的配置片段
+func isConfigInclude(path string) bool {
+	return filepath.Base(filepath.Dir(path)) == configIncludeDir
+}
+
+// 生成带来源信息的配置错误描述
+func describeConfigError(err error, provenance configProvenance) string {
+	var validationErr *configValidationError
+	if !errors.As(err, &validationErr) {
+		return err.Error()
+	}
+	sources := provenance.lookup(validationErr.Field)
+	if len(sources) == 0 {
+		return err.Error()
+	}
+	return fmt.Sprintf("%v (来源: %s)", err, strings.Join(sources, ", "))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// 在临时目录中创建主配置文件路径和conf.d片段
+func writeConfigIncludes(t *testing.T, fragments map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if len(fragments) > 0 {
+		if err := os.Mkdir(filepath.Join(dir, configIncludeDir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range fragments {
+		if err := os.WriteFile(filepath.Join(dir, configIncludeDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "fastcode.yml")
+}
+
+func TestApplyConfigIncludes(t *testing.T) {
+	tests := []struct {
+		name      string
+		fragments map[string]string
+		check     func(t *testing.T, cfg *Config)
+	}{
+		{
+			name:      "没有conf.d目录",
+			fragments: nil,
+			check: func(t *testing.T, cfg *Config) {
+				if want := []string{"main/*"}; !reflect.DeepEqual(cfg.WhiteList, want) {
+					t.Errorf("whiteList = %v, want %v", cfg.WhiteList, want)
+				}
+			},
+		},
+		{
+			name: "列表按文件名顺序追加",
+			fragments: map[string]string{
+				"20-b.yml":  "whiteList:\n  - b/*\n",
+				"10-a.json": `{"whiteList": ["a/*"]}`,
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if want := []string{"main/*", "a/*", "b/*"}; !reflect.DeepEqual(cfg.WhiteList, want) {
+					t.Errorf("whiteList = %v, want %v", cfg.WhiteList, want)
+				}
+			},
+		},
+		{
+			name: "标量由后面的片段覆盖",
+			fragments: map[string]string{
+				"10-a.yml": "sizeLimit: 100\n",
+				"20-b.yml": "sizeLimit: 200\n",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.SizeLimit != 200 {
+					t.Errorf("sizeLimit = %d, want 200", cfg.SizeLimit)
+				}
+			},
+		},
+		{
+			name: "对象逐项合并",
+			fragments: map[string]string{
+				"10-admin.yml": "admin:\n  password: from-fragment\n",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				want := AdminConfig{Enabled: true, Username: "admin", Password: "from-fragment"}
+				if cfg.Admin != want {
+					t.Errorf("admin = %+v, want %+v", cfg.Admin, want)
+				}
+			},
+		},
+		{
+			name: "忽略隐藏文件和其他扩展名",
+			fragments: map[string]string{
+				".10-hidden.yml": "sizeLimit: 100\n",
+				"20-notes.txt":   "sizeLimit: 200\n",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.SizeLimit != defaultSizeLimit {
+					t.Errorf("sizeLimit = %d, want %d", cfg.SizeLimit, defaultSizeLimit)
+				}
+			},
+		},
+		{
+			name: "片段不能修改版本号和UUID",
+			fragments: map[string]string{
+				"10-a.yml": "version: 0.0.1\nuuid: other\n",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Version != configVersion || cfg.UUID != testConfig().UUID {
+					t.Errorf("version = %q, uuid = %q", cfg.Version, cfg.UUID)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mainPath := writeConfigIncludes(t, tt.fragments)
+			mainConfig := testConfig()
+			mainConfig.WhiteList = []string{"main/*"}
+			mainConfig.Admin = AdminConfig{Enabled: true, Username: "admin", Password: "from-main"}
+
+			effective, _, err := applyConfigIncludes(mainPath, mainConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, effective)
+			if len(mainConfig.WhiteList) != 1 || mainConfig.Admin.Password != "from-main" {
+				t.Errorf("合并不应修改主配置: %+v", mainConfig)
+			}
+		})
+	}
+}
+
+func TestApplyConfigIncludesInvalidFragment(t *testing.T) {
+	tests := []struct {
+		name     string
+		fragment string
+		content  string
+	}{
+		{"YAML语法错误", "10-a.yml", "whiteList: [\n"},
+		{"JSON语法错误", "10-a.json", `{"whiteList": `},
+		{"类型不匹配", "10-a.yml", "sizeLimit: large\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mainPath := writeConfigIncludes(t, map[string]string{tt.fragment: tt.content})
+			if _, _, err := applyConfigIncludes(mainPath, testConfig()); err == nil {
+				t.Error("应返回错误")
+			}
+		})
+	}
+}
+
+func TestConfigProvenanceLookup(t *testing.T) {
+	mainPath := writeConfigIncludes(t, map[string]string{
+		"10-a.yml": "whiteList:\n  - a/*\nadmin:\n  password: from-fragment\n",
+		"20-b.yml": "whiteList:\n  - b/*\n",
+	})
+	mainConfig := testConfig()
+	mainConfig.WhiteList = []string{"main/*"}
+	_, provenance, err := applyConfigIncludes(mainPath, mainConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	includeA := filepath.Join(filepath.Dir(mainPath), configIncludeDir, "10-a.yml")
+	includeB := filepath.Join(filepath.Dir(mainPath), configIncludeDir, "20-b.yml")
+	tests := []struct {
+		field string
+		want  []string
+	}{
+		{"whiteList", []string{mainPath, includeA, includeB}},
+		{"admin.password", []string{includeA}},
+		{"admin", []string{mainPath, includeA}},
+		{"sizeLimit", []string{mainPath}},
+		{"blackList", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			if got := provenance.lookup(tt.field); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lookup(%q) = %v, want %v", tt.field, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -13,45 +14,359 @@ import (
 )
 
 const (
-	defaultSizeLimit int64 = 1024 * 1024 * 1024 * 10 // 允许的文件大小，默认10GB
-	defaultHost            = "0.0.0.0"               // 默认监听地址
-	defaultPort            = 8080                    // 默认监听端口
+	defaultSizeLimit       int64 = 1024 * 1024 * 1024 * 10 // 允许的文件大小，默认10GB
+	defaultHost                  = "0.0.0.0"               // 默认监听地址
+	defaultPort                  = 8080                    // 默认监听端口
+	defaultAdminUsername         = "admin"                 // 默认管理员用户名
+	defaultTLSMinVersion         = "1.2"                   // 默认最低TLS版本
+	defaultRedirectPort          = 80                      // 默认HTTP跳转监听端口
+	defaultShutdownTimeout       = 60                      // 默认关闭服务时的排空时间（秒）
+	defaultLogFile               = "./logs/fastcode.log"   // 默认日志文件路径
 )
 
 // 配置结构体
 type Config struct {
-	Version        string   `json:"version"` // 配置文件版本
-	Host           string   `json:"host"`
-	Port           int64    `json:"port"`
-	SizeLimit      int64    `json:"sizeLimit"`
-	WhiteList      []string `json:"whiteList"`
-	BlackList      []string `json:"blackList"`
-	AllowProxyAll  bool     `json:"allowProxyAll"` // 是否允许代理非github的其他地址
-	OtherWhiteList []string `json:"otherWhiteList"`
-	OtherBlackList []string `json:"otherBlackList"`
-	UUID           string   `json:"uuid"` // 唯一标识符，用于数据统计
+	Version          string                  `json:"version" yaml:"version"`               // 配置文件版本
+	Host             string                  `json:"host,omitempty" yaml:"host,omitempty"` // 已由listeners代替，仅用于迁移旧配置
+	Port             int64                   `json:"port,omitempty" yaml:"port,omitempty"` // 已由listeners代替，仅用于迁移旧配置
+	Listeners        []ListenerConfig        `json:"listeners" yaml:"listeners"`           // 监听配置
+	Policies         map[string]PolicyConfig `json:"policies" yaml:"policies"`             // 监听使用的策略
+	SizeLimit        int64                   `json:"sizeLimit" yaml:"sizeLimit"`
+	WhiteList        []string                `json:"whiteList" yaml:"whiteList"`
+	BlackList        []string                `json:"blackList" yaml:"blackList"`
+	AllowProxyAll    bool                    `json:"allowProxyAll" yaml:"allowProxyAll"` // 是否允许代理非github的其他地址
+	OtherWhiteList   []string                `json:"otherWhiteList" yaml:"otherWhiteList"`
+	OtherBlackList   []string                `json:"otherBlackList" yaml:"otherBlackList"`
+	UUID             string                  `json:"uuid" yaml:"uuid"`                         // 唯一标识符，启用telemetry时随匿名使用统计上报
+	ShutdownTimeout  int64                   `json:"shutdownTimeout" yaml:"shutdownTimeout"`   // 关闭服务时等待传输完成的最长时间（秒）
+	ShutdownDelay    int64                   `json:"shutdownDelay" yaml:"shutdownDelay"`       // 收到退出信号后关闭监听前的等待时间（秒），期间就绪检查返回排空状态
+	TrustedProxies   []string                `json:"trustedProxies" yaml:"trustedProxies"`     // 可信代理的IP或CIDR，用于获取客户端真实IP
+	ProxyProtocol    bool                    `json:"proxyProtocol" yaml:"proxyProtocol"`       // 是否接受可信代理发送的PROXY protocol头
+	ForwardHeaders   bool                    `json:"forwardHeaders" yaml:"forwardHeaders"`     // 是否向上游发送X-Forwarded-*请求头
+	ForwardRequestID bool                    `json:"forwardRequestId" yaml:"forwardRequestId"` // 是否向上游发送X-Request-ID请求头
+	TunnelHosts      []string                `json:"tunnelHosts" yaml:"tunnelHosts"`           // 正向代理允许建立隧道的域名，包含其子域名
+	Admin            AdminConfig             `json:"admin" yaml:"admin"`                       // 管理API配置
+	TLS              TLSConfig               `json:"tls" yaml:"tls"`                           // HTTPS配置
+	Outbound         OutboundConfig          `json:"outbound" yaml:"outbound"`                 // 出站连接配置
+	Rules            map[string]RuleConfig   `json:"rules" yaml:"rules"`                       // 按URL规则的上游配置，default为默认配置
+	Retry            RetryConfig             `json:"retry" yaml:"retry"`                       // 重试和断点续传配置
+	Timeouts         TimeoutsConfig          `json:"timeouts" yaml:"timeouts"`                 // 超时和服务端限制配置
+	Resolver         ResolverConfig          `json:"resolver" yaml:"resolver"`                 // 域名解析配置
+	Compression      CompressionConfig       `json:"compression" yaml:"compression"`           // 响应压缩配置
+	Log              LogConfig               `json:"log" yaml:"log"`                           // 日志配置
+	AccessLog        AccessLogConfig         `json:"accessLog" yaml:"accessLog"`               // 访问日志配置
+	Stats            StatsConfig             `json:"stats" yaml:"stats"`                       // 使用统计配置
+	Health           HealthConfig            `json:"health" yaml:"health"`                     // 就绪检查配置
+	Tracing          TracingConfig           `json:"tracing" yaml:"tracing"`                   // 链路追踪配置
+	Telemetry        TelemetryConfig         `json:"telemetry" yaml:"telemetry"`               // 匿名使用统计上报配置
+}
+
+// 管理API配置
+type AdminConfig struct {
+	Enabled  bool   `json:"enabled" yaml:"enabled"`
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+}
+
+// HTTPS配置
+type TLSConfig struct {
+	Enabled      bool                 `json:"enabled" yaml:"enabled"`
+	CertFile     string               `json:"certFile" yaml:"certFile"`         // 默认证书文件
+	KeyFile      string               `json:"keyFile" yaml:"keyFile"`           // 默认私钥文件
+	Certificates []TLSCertificateFile `json:"certificates" yaml:"certificates"` // 其他证书，按SNI选择
+	MinVersion   string               `json:"minVersion" yaml:"minVersion"`     // 最低TLS版本：1.0、1.1、1.2、1.3
+	RedirectHTTP bool                 `json:"redirectHTTP" yaml:"redirectHTTP"` // 是否启用HTTP跳转HTTPS监听
+	RedirectPort int64                `json:"redirectPort" yaml:"redirectPort"` // HTTP跳转监听端口
+}
+
+// 证书文件
+type TLSCertificateFile struct {
+	CertFile string `json:"certFile" yaml:"certFile"`
+	KeyFile  string `json:"keyFile" yaml:"keyFile"`
+}
+
+// 出站连接配置
+type OutboundConfig struct {
+	Proxies              []OutboundProxy `json:"proxies" yaml:"proxies"`                           // 出站代理
+	NoProxy              []string        `json:"noProxy" yaml:"noProxy"`                           // 不使用出站代理的地址，格式同NO_PROXY环境变量
+	LocalAddresses       []string        `json:"localAddresses" yaml:"localAddresses"`             // 出站连接绑定的本地地址，为空时由系统选择
+	LocalAddressStrategy string          `json:"localAddressStrategy" yaml:"localAddressStrategy"` // 本地地址选择策略: roundRobin、leastThrottled
+}
+
+// 出站代理
+type OutboundProxy struct {
+	Name string `json:"name" yaml:"name"`
+	URL  string `json:"url" yaml:"url"` // 支持 http://、https://、socks5://，认证信息写在URL中
+}
+
+// URL规则的上游配置
+type RuleConfig struct {
+	Proxy   string         `json:"proxy" yaml:"proxy"`     // 使用的出站代理名称，direct表示直连，为空时使用default规则的配置
+	Timeout int64          `json:"timeout" yaml:"timeout"` // 单次请求（含传输响应体）的最长时间（秒），0表示使用default规则的配置或不限制
+	Mirrors []MirrorConfig `json:"mirrors" yaml:"mirrors"` // 备用上游，与原始地址一起按健康状态和延迟选择，为空时使用default规则的配置
+}
+
+// 备用上游
+type MirrorConfig struct {
+	Name        string `json:"name" yaml:"name"`
+	URL         string `json:"url" yaml:"url"`                 // URL模板，支持 {url}、{host}、{path} 占位符
+	HealthCheck string `json:"healthCheck" yaml:"healthCheck"` // 健康检查地址，为空时使用URL模板的根路径
+}
+
+// 重试和断点续传配置，只作用于GET/HEAD请求
+type RetryConfig struct {
+	MaxAttempts int   `json:"maxAttempts" yaml:"maxAttempts"` // 最大尝试次数（含第一次），1表示不重试
+	Backoff     int64 `json:"backoff" yaml:"backoff"`         // 首次重试前的等待时间（毫秒），之后每次翻倍
+	MaxResumes  int   `json:"maxResumes" yaml:"maxResumes"`   // 传输中断后最多续传次数，0表示不续传
+}
+
+// 超时和服务端限制配置，时间单位均为秒
+type TimeoutsConfig struct {
+	Dial             int64 `json:"dial" yaml:"dial"`                         // 连接上游的超时时间
+	TLSHandshake     int64 `json:"tlsHandshake" yaml:"tlsHandshake"`         // 与上游TLS握手的超时时间
+	ResponseHeader   int64 `json:"responseHeader" yaml:"responseHeader"`     // 等待上游响应头的超时时间
+	IdleRead         int64 `json:"idleRead" yaml:"idleRead"`                 // 上游响应体两次收到数据之间的最长间隔
+	ServerReadHeader int64 `json:"serverReadHeader" yaml:"serverReadHeader"` // 读取客户端请求头的超时时间
+	ServerRead       int64 `json:"serverRead" yaml:"serverRead"`             // 读取客户端完整请求的超时时间，0表示不限制
+	ServerWrite      int64 `json:"serverWrite" yaml:"serverWrite"`           // 写入响应的超时时间，0表示不限制
+	ServerIdle       int64 `json:"serverIdle" yaml:"serverIdle"`             // 客户端keep-alive连接的空闲超时时间
+	MaxHeaderBytes   int   `json:"maxHeaderBytes" yaml:"maxHeaderBytes"`     // 客户端请求头的最大字节数
+}
+
+// 域名解析配置
+type ResolverConfig struct {
+	Hosts         map[string][]string `json:"hosts" yaml:"hosts"`                 // 静态解析，同一域名的多个IP轮流使用
+	Servers       []string            `json:"servers" yaml:"servers"`             // DNS服务器，支持 udp://、tcp:// 前缀，为空时使用系统DNS
+	CacheTTL      int64               `json:"cacheTTL" yaml:"cacheTTL"`           // 解析结果缓存时间（秒）
+	ProbeInterval int64               `json:"probeInterval" yaml:"probeInterval"` // 探测各IP连接速度的间隔（秒）
+}
+
+// 响应压缩配置
+type CompressionConfig struct {
+	Enabled bool     `json:"enabled" yaml:"enabled"`
+	MinSize int64    `json:"minSize" yaml:"minSize"` // 响应体小于该字节数时不压缩，长度未知时始终压缩
+	Level   int      `json:"level" yaml:"level"`     // 压缩级别，1（最快）到9（最小）
+	Types   []string `json:"types" yaml:"types"`     // 压缩的MIME类型，支持 * 通配符，如 text/*
+}
+
+// 日志配置
+type LogConfig struct {
+	Level     string `json:"level" yaml:"level"`         // 日志级别: debug、info、warn、error
+	Format    string `json:"format" yaml:"format"`       // 日志格式: text、json
+	Output    string `json:"output" yaml:"output"`       // 输出位置: stdout、file、syslog
+	File      string `json:"file" yaml:"file"`           // 日志文件路径，output为file时使用
+	MaxSize   int64  `json:"maxSize" yaml:"maxSize"`     // 日志文件超过该大小（MB）时轮转，0表示不轮转
+	MaxAge    int64  `json:"maxAge" yaml:"maxAge"`       // 轮转后的日志文件保留天数，0表示不删除
+	SyslogTag string `json:"syslogTag" yaml:"syslogTag"` // syslog中的程序标识
+}
+
+// 访问日志配置
+type AccessLogConfig struct {
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+	Format  string `json:"format" yaml:"format"`   // 日志格式: combined、json
+	Output  string `json:"output" yaml:"output"`   // 输出位置: stdout、file
+	File    string `json:"file" yaml:"file"`       // 日志文件路径，output为file时使用
+	MaxSize int64  `json:"maxSize" yaml:"maxSize"` // 日志文件超过该大小（MB）时轮转，0表示不轮转
+	MaxAge  int64  `json:"maxAge" yaml:"maxAge"`   // 轮转后的日志文件保留天数，0表示不删除
+}
+
+// 使用统计配置
+type StatsConfig struct {
+	Enabled         bool   `json:"enabled" yaml:"enabled"`
+	File            string `json:"file" yaml:"file"`                       // 统计文件路径
+	FlushInterval   int64  `json:"flushInterval" yaml:"flushInterval"`     // 写入统计文件的间隔（秒）
+	HourlyRetention int64  `json:"hourlyRetention" yaml:"hourlyRetention"` // 按小时汇总的保留时间（小时）
+	DailyRetention  int64  `json:"dailyRetention" yaml:"dailyRetention"`   // 按天汇总的保留时间（天）
+	MaxFiles        int    `json:"maxFiles" yaml:"maxFiles"`               // 最多统计的文件数，超过时只保留请求最多的文件
+}
+
+// 就绪检查配置
+type HealthConfig struct {
+	Interval  int64    `json:"interval" yaml:"interval"`   // 检查间隔（秒）
+	Upstreams []string `json:"upstreams" yaml:"upstreams"` // 需要探测的上游地址，任一不可访问时服务未就绪
+}
+
+// 链路追踪配置
+type TracingConfig struct {
+	Enabled     bool              `json:"enabled" yaml:"enabled"`
+	Endpoint    string            `json:"endpoint" yaml:"endpoint"`       // OTLP/HTTP收集器的接收地址
+	ServiceName string            `json:"serviceName" yaml:"serviceName"` // 上报的服务名称
+	SampleRatio float64           `json:"sampleRatio" yaml:"sampleRatio"` // 请求未带有traceparent时的采样比例，0到1
+	Headers     map[string]string `json:"headers" yaml:"headers"`         // 上报时附加的请求头，例如收集器的认证信息
+}
+
+// 匿名使用统计上报配置，默认关闭
+type TelemetryConfig struct {
+	Enabled  bool   `json:"enabled" yaml:"enabled"`
+	Endpoint string `json:"endpoint" yaml:"endpoint"` // 接收上报的地址
+	Interval int64  `json:"interval" yaml:"interval"` // 上报间隔（秒）
+}
+
+// 监听配置
+type ListenerConfig struct {
+	Name    string `json:"name" yaml:"name"`
+	Address string `json:"address" yaml:"address"` // host:port 或 unix:/path/to.sock
+	Policy  string `json:"policy" yaml:"policy"`   // 使用的策略名称，为空时使用全局配置
+	Mode    string `json:"mode" yaml:"mode"`       // server（默认）或 forward（正向代理）
+}
+
+// 监听策略，未配置的项使用全局配置
+type PolicyConfig struct {
+	WhiteList      []string       `json:"whiteList" yaml:"whiteList"`
+	BlackList      []string       `json:"blackList" yaml:"blackList"`
+	AllowProxyAll  *bool          `json:"allowProxyAll,omitempty" yaml:"allowProxyAll,omitempty"`
+	OtherWhiteList []string       `json:"otherWhiteList" yaml:"otherWhiteList"`
+	OtherBlackList []string       `json:"otherBlackList" yaml:"otherBlackList"`
+	SizeLimit      int64          `json:"sizeLimit" yaml:"sizeLimit"`     // 0表示使用全局配置
+	Rules          []string       `json:"rules" yaml:"rules"`             // 允许代理的URL规则，为空时不限制
+	Routes         []string       `json:"routes" yaml:"routes"`           // 启用的路由: proxy、api、admin，为空时全部启用
+	APIKeys        []APIKeyConfig `json:"apiKeys" yaml:"apiKeys"`         // 配置后代理请求需要提供其中一个密钥
+	TunnelHosts    []string       `json:"tunnelHosts" yaml:"tunnelHosts"` // 允许建立隧道的域名，为空时使用全局配置
+}
+
+// 访问密钥
+type APIKeyConfig struct {
+	ID  string `json:"id" yaml:"id"`
+	Key string `json:"key" yaml:"key"`
 }
 
 // 配置文件版本
-const configVersion = "1.0.1"
+const configVersion = "1.1.0"
 
 // 默认配置
 var defaultConfig = Config{
-	Version:        configVersion,
-	Host:           defaultHost,
-	Port:           defaultPort,
-	SizeLimit:      defaultSizeLimit,
-	WhiteList:      []string{},
-	BlackList:      []string{},
-	AllowProxyAll:  false,
-	OtherWhiteList: []string{},
-	OtherBlackList: []string{},
-	UUID:           "",
+	Version: configVersion,
+	Listeners: []ListenerConfig{{
+		Name:    defaultListenerName,
+		Address: fmt.Sprintf("%s:%d", defaultHost, defaultPort),
+	}},
+	Policies:        map[string]PolicyConfig{},
+	SizeLimit:       defaultSizeLimit,
+	WhiteList:       []string{},
+	BlackList:       []string{},
+	AllowProxyAll:   false,
+	OtherWhiteList:  []string{},
+	OtherBlackList:  []string{},
+	UUID:            "",
+	ShutdownTimeout: defaultShutdownTimeout,
+	TrustedProxies:  []string{},
+	TunnelHosts:     []string{"github.com", "githubusercontent.com", "githubassets.com"},
+	ProxyProtocol:   false,
+	ForwardHeaders:  false,
+	Admin: AdminConfig{
+		Enabled:  false,
+		Username: defaultAdminUsername,
+		Password: "",
+	},
+	TLS: TLSConfig{
+		Enabled:      false,
+		CertFile:     "",
+		KeyFile:      "",
+		Certificates: []TLSCertificateFile{},
+		MinVersion:   defaultTLSMinVersion,
+		RedirectHTTP: false,
+		RedirectPort: defaultRedirectPort,
+	},
+	Outbound: OutboundConfig{
+		Proxies:              []OutboundProxy{},
+		NoProxy:              []string{},
+		LocalAddresses:       []string{},
+		LocalAddressStrategy: egressRoundRobin,
+	},
+	Rules: map[string]RuleConfig{},
+	Retry: RetryConfig{
+		MaxAttempts: 3,
+		Backoff:     500,
+		MaxResumes:  3,
+	},
+	Timeouts: TimeoutsConfig{
+		Dial:             30,
+		TLSHandshake:     10,
+		ResponseHeader:   30,
+		IdleRead:         60,
+		ServerReadHeader: 10,
+		ServerRead:       0,
+		ServerWrite:      0,
+		ServerIdle:       120,
+		MaxHeaderBytes:   1 << 20,
+	},
+	Resolver: ResolverConfig{
+		Hosts:         map[string][]string{},
+		Servers:       []string{},
+		CacheTTL:      300,
+		ProbeInterval: 60,
+	},
+	Compression: CompressionConfig{
+		Enabled: true,
+		MinSize: 1024,
+		Level:   6,
+		Types: []string{
+			"text/*",
+			"application/json",
+			"application/*+json",
+			"application/javascript",
+			"application/xml",
+			"application/*+xml",
+			"application/x-yaml",
+			"application/yaml",
+			"application/x-sh",
+			"image/svg+xml",
+		},
+	},
+	Log: LogConfig{
+		Level:     "info",
+		Format:    logFormatText,
+		Output:    logOutputStdout,
+		File:      defaultLogFile,
+		MaxSize:   100,
+		MaxAge:    7,
+		SyslogTag: "fastcode",
+	},
+	AccessLog: AccessLogConfig{
+		Enabled: true,
+		Format:  accessLogCombined,
+		Output:  logOutputStdout,
+		File:    defaultAccessLogFile,
+		MaxSize: 100,
+		MaxAge:  30,
+	},
+	Stats: StatsConfig{
+		Enabled:         true,
+		File:            defaultStatsFile,
+		FlushInterval:   60,
+		HourlyRetention: 168,
+		DailyRetention:  365,
+		MaxFiles:        10000,
+	},
+	Health: HealthConfig{
+		Interval: 30,
+		Upstreams: []string{
+			"https://github.com/",
+			"https://raw.githubusercontent.com/",
+			"https://codeload.github.com/",
+		},
+	},
+	Tracing: TracingConfig{
+		Endpoint:    defaultTracingEndpoint,
+		ServiceName: "fastcode",
+		SampleRatio: 1,
+	},
+	Telemetry: TelemetryConfig{
+		Interval: 86400,
+	},
 }
 
 var (
 	config     *Config
 	configLock sync.RWMutex
+
+	// 主配置文件中的配置（不含conf.d片段），管理API修改配置时以此为基础
+	fileConfig *Config
+
+	// 配置文件路径
+	configFilePath string
+	// 配置文件写入锁，避免并发修改配置文件
+	configWriteLock sync.Mutex
 )
 
 // 初始化配置
@@ -59,13 +374,14 @@ func initConfig() {
 	// 配置文件路径
 	configDir := "./config"
 	configPath := filepath.Join(configDir, "fastcode.yml")
+	configFilePath = configPath
 
 	// 检查并创建config目录
 	if _, err := os.Stat(configDir); os.IsNotExist(err) {
-		printlnWithTime("config目录不存在，创建目录...")
+		logInfo("config目录不存在，创建目录", "dir", configDir)
 		err := os.MkdirAll(configDir, 0755)
 		if err != nil {
-			printfWithTime("创建config目录失败: %v\n", err)
+			logError("创建config目录失败", "dir", configDir, "error", err)
 			os.Exit(1)
 		}
 	}
@@ -73,10 +389,10 @@ func initConfig() {
 	// 检查配置文件是否存在
 	if _, err := os.Stat(configPath); err != nil {
 		// 配置文件不存在，生成默认配置
-		printlnWithTime("配置文件不存在，生成默认配置...")
+		logInfo("配置文件不存在，生成默认配置", "path", configPath)
 		err := generateDefaultConfig(configPath)
 		if err != nil {
-			printfWithTime("生成配置文件失败: %v\n", err)
+			logError("生成配置文件失败", "path", configPath, "error", err)
 			os.Exit(1)
 		}
 	}
@@ -94,77 +410,315 @@ func generateDefaultConfig(path string) error {
 	config := defaultConfig
 	config.UUID = generateUUID()
 
-	var configData []byte
-	var err error
+	return writeConfigFile(path, &config)
+}
+
+// 判断是否为YAML配置文件
+func isYAMLPath(path string) bool {
+	return strings.HasSuffix(path, ".yml") || strings.HasSuffix(path, ".yaml")
+}
 
+// 生成配置文件内容
+func marshalConfig(path string, cfg *Config) ([]byte, error) {
 	// 根据文件扩展名选择格式
-	if strings.HasSuffix(path, ".yml") || strings.HasSuffix(path, ".yaml") {
-		// 生成带注释的YAML格式
-		yamlContent := "# FastCode 配置文件\n"
-		yamlContent += "# 配置文件版本，请勿修改\n"
-		yamlContent += fmt.Sprintf("version: %s\n\n", config.Version)
-		yamlContent += "# 监听地址，默认: 0.0.0.0\n"
-		yamlContent += fmt.Sprintf("host: %s\n\n", config.Host)
-		yamlContent += "# 监听端口，默认: 8080\n"
-		yamlContent += fmt.Sprintf("port: %d\n\n", config.Port)
-		yamlContent += "# 文件大小限制，默认: 10GB\n"
-		yamlContent += fmt.Sprintf("sizeLimit: %d\n\n", config.SizeLimit)
-		yamlContent += "# GitHub地址白名单，支持通配符\n"
-		yamlContent += "whiteList: []\n"
-		if len(config.WhiteList) > 0 {
-			for _, item := range config.WhiteList {
-				yamlContent += fmt.Sprintf("  - %s\n", item)
-			}
+	if !isYAMLPath(path) {
+		// 生成JSON格式
+		return json.MarshalIndent(cfg, "", "  ")
+	}
+
+	// 生成带注释的YAML格式
+	yamlContent := "# FastCode 配置文件\n"
+	yamlContent += "# 配置文件版本，请勿修改\n"
+	yamlContent += fmt.Sprintf("version: %s\n\n", cfg.Version)
+	yamlContent += "# 文件大小限制，默认: 10GB\n"
+	yamlContent += fmt.Sprintf("sizeLimit: %d\n\n", cfg.SizeLimit)
+	yamlContent += "# GitHub地址白名单，支持通配符\n"
+	yamlContent += yamlList("whiteList", cfg.WhiteList)
+	yamlContent += "\n"
+	yamlContent += "# GitHub地址黑名单，支持通配符\n"
+	yamlContent += yamlList("blackList", cfg.BlackList)
+	yamlContent += "\n"
+	yamlContent += "# 是否允许代理非GitHub的其他地址\n"
+	yamlContent += fmt.Sprintf("allowProxyAll: %t\n\n", cfg.AllowProxyAll)
+	yamlContent += "# 其他地址白名单\n"
+	yamlContent += yamlList("otherWhiteList", cfg.OtherWhiteList)
+	yamlContent += "\n"
+	yamlContent += "# 其他地址黑名单\n"
+	yamlContent += yamlList("otherBlackList", cfg.OtherBlackList)
+	yamlContent += "\n"
+	yamlContent += "# 唯一标识符，用于数据统计\n"
+	yamlContent += fmt.Sprintf("uuid: %s\n\n", cfg.UUID)
+	yamlContent += "# 关闭服务时等待进行中的传输完成的最长时间（秒），默认: 60\n"
+	yamlContent += fmt.Sprintf("shutdownTimeout: %d\n\n", cfg.ShutdownTimeout)
+	yamlContent += "# 收到退出信号后先等待的时间（秒），期间就绪检查返回503但继续处理请求，使负载均衡摘除节点后再关闭监听，默认: 0\n"
+	yamlContent += fmt.Sprintf("shutdownDelay: %d\n\n", cfg.ShutdownDelay)
+	yamlContent += "# 可信代理（IP或CIDR），来自这些地址的请求使用 X-Forwarded-For、X-Real-IP、Forwarded 中的客户端IP，修改后需要重启\n"
+	yamlContent += yamlList("trustedProxies", cfg.TrustedProxies)
+	yamlContent += "\n"
+	yamlContent += "# 是否接受可信代理发送的PROXY protocol（v1/v2）头，修改后需要重启\n"
+	yamlContent += fmt.Sprintf("proxyProtocol: %t\n\n", cfg.ProxyProtocol)
+	yamlContent += "# 是否向上游发送 X-Forwarded-For、X-Forwarded-Proto、X-Forwarded-Host 请求头\n"
+	yamlContent += fmt.Sprintf("forwardHeaders: %t\n\n", cfg.ForwardHeaders)
+	yamlContent += "# 是否向上游发送 X-Request-ID 请求头，值与返回给客户端的请求ID相同\n"
+	yamlContent += fmt.Sprintf("forwardRequestId: %t\n\n", cfg.ForwardRequestID)
+	yamlContent += "# 正向代理允许建立CONNECT隧道的域名（包含子域名），只允许443端口，为空时不允许建立隧道\n"
+	yamlContent += yamlList("tunnelHosts", cfg.TunnelHosts)
+
+	// 嵌套配置段
+	sections := []struct {
+		comment string
+		key     string
+		value   interface{}
+	}{
+		{"# 监听配置，address 为 host:port 或 unix:/path/to.sock，policy 为使用的策略，mode 为 server 或 forward（正向代理），修改后需要重启", "listeners", cfg.Listeners},
+		{"# 监听策略，未配置的项使用全局配置，routes 可选 proxy、api、admin，apiKeys 配置后代理请求需要认证", "policies", cfg.Policies},
+		{"# 管理API配置，启用后可通过 /api/admin 在运行时查看和修改配置", "admin", cfg.Admin},
+		{"# HTTPS配置，证书文件变化后自动重新加载，certificates 中的证书按SNI选择", "tls", cfg.TLS},
+		{"# 出站连接配置，proxies 为可供规则选择的出站代理，noProxy 中的地址始终直连，localAddresses 为轮换使用的本地地址", "outbound", cfg.Outbound},
+		{"# 按URL规则的上游配置，规则名称: release、blob、git、raw、gist、api、other，default为默认配置", "rules", cfg.Rules},
+		{"# GET/HEAD请求遇到连接错误或5xx时的重试次数和退避时间（毫秒），以及传输中断后的断点续传次数", "retry", cfg.Retry},
+		{"# 超时配置（秒），dial/tlsHandshake/responseHeader/idleRead 作用于上游，server* 作用于客户端连接且需要重启生效", "timeouts", cfg.Timeouts},
+		{"# 域名解析配置，hosts 为静态解析，servers 为DNS服务器（如 udp://8.8.8.8:53、tcp://1.1.1.1），cacheTTL/probeInterval 单位为秒", "resolver", cfg.Resolver},
+		{"# 日志配置，level 可选 debug、info、warn、error，format 可选 text、json，output 可选 stdout、file、syslog，maxSize 单位为MB，maxAge 单位为天", "log", cfg.Log},
+		{"# 访问日志配置，每次代理传输结束后记录一行，format 可选 combined、json，output 可选 stdout、file，URL中的令牌会被脱敏", "accessLog", cfg.AccessLog},
+		{"# 使用统计配置，按仓库、域名和文件统计请求数和流量，并按小时、按天汇总，通过管理API /api/admin/stats 查询", "stats", cfg.Stats},
+		{"# 就绪检查配置，每隔 interval 秒探测 upstreams 中的上游并检查数据目录是否可写，结果通过 /api/health/ready 查询", "health", cfg.Health},
+		{"# 链路追踪配置，启用后按 sampleRatio 采样代理请求，记录DNS、连接、TLS、等待首字节和传输各阶段的耗时，以OTLP/HTTP JSON格式上报到 endpoint", "tracing", cfg.Tracing},
+		{"# 匿名使用统计上报，默认关闭，启用后每隔 interval 秒向 endpoint POST 版本、运行时间、请求数和流量合计及 uuid，内容可通过 /api/telemetry 预览", "telemetry", cfg.Telemetry},
+		{"# 响应压缩配置，按客户端的 Accept-Encoding 使用gzip或deflate压缩 types 中的文本类型，minSize 单位为字节，压缩文件不会再次压缩", "compression", cfg.Compression},
+	}
+	for _, section := range sections {
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(map[string]interface{}{section.key: section.value}); err != nil {
+			return nil, err
 		}
-		yamlContent += "\n"
-		yamlContent += "# GitHub地址黑名单，支持通配符\n"
-		yamlContent += "blackList: []\n"
-		if len(config.BlackList) > 0 {
-			for _, item := range config.BlackList {
-				yamlContent += fmt.Sprintf("  - %s\n", item)
-			}
+		encoder.Close()
+		yamlContent += "\n" + section.comment + "\n" + buf.String()
+	}
+
+	return []byte(yamlContent), nil
+}
+
+// 生成YAML列表
+func yamlList(key string, items []string) string {
+	if len(items) == 0 {
+		return key + ": []\n"
+	}
+	content := key + ":\n"
+	for _, item := range items {
+		content += fmt.Sprintf("  - %q\n", item)
+	}
+	return content
+}
+
+// 写入配置文件，先写临时文件再重命名，保证写入的原子性
+func writeConfigFile(path string, cfg *Config) error {
+	configData, err := marshalConfig(path, cfg)
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	// 失败时清理临时文件
+	defer os.Remove(tmpPath)
+
+	if _, err := tmpFile.Write(configData); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// 复制配置，避免修改共享的配置对象
+func cloneConfig(cfg *Config) *Config {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		copied := *cfg
+		return &copied
+	}
+	var copied Config
+	if err := json.Unmarshal(data, &copied); err != nil {
+		copied = *cfg
+	}
+	return &copied
+}
+
+// 将配置转换为通用的键值结构
+func configToMap(cfg *Config) (map[string]interface{}, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 配置校验错误
+type configValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *configValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// 校验配置
+func validateConfig(cfg *Config) error {
+	if cfg.Host != "" || cfg.Port != 0 {
+		return &configValidationError{"host", "host 和 port 已由 listeners 代替"}
+	}
+	if err := validateListenersConfig(cfg); err != nil {
+		return err
+	}
+	if cfg.SizeLimit <= 0 {
+		return &configValidationError{"sizeLimit", "文件大小限制必须大于0"}
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		return &configValidationError{"shutdownTimeout", "排空时间必须大于0"}
+	}
+	if cfg.ShutdownDelay < 0 {
+		return &configValidationError{"shutdownDelay", "等待时间不能为负数"}
+	}
+	for _, item := range cfg.TrustedProxies {
+		if _, err := parseTrustedProxy(item); err != nil {
+			return &configValidationError{"trustedProxies", err.Error()}
 		}
-		yamlContent += "\n"
-		yamlContent += "# 是否允许代理非GitHub的其他地址\n"
-		yamlContent += fmt.Sprintf("allowProxyAll: %t\n\n", config.AllowProxyAll)
-		yamlContent += "# 其他地址白名单\n"
-		yamlContent += "otherWhiteList: []\n"
-		if len(config.OtherWhiteList) > 0 {
-			for _, item := range config.OtherWhiteList {
-				yamlContent += fmt.Sprintf("  - %s\n", item)
-			}
+	}
+	for _, item := range cfg.WhiteList {
+		if strings.TrimSpace(item) == "" {
+			return &configValidationError{"whiteList", "白名单中存在空项"}
 		}
-		yamlContent += "\n"
-		yamlContent += "# 其他地址黑名单\n"
-		yamlContent += "otherBlackList: []\n"
-		if len(config.OtherBlackList) > 0 {
-			for _, item := range config.OtherBlackList {
-				yamlContent += fmt.Sprintf("  - %s\n", item)
-			}
+	}
+	for _, item := range cfg.BlackList {
+		if strings.TrimSpace(item) == "" {
+			return &configValidationError{"blackList", "黑名单中存在空项"}
 		}
-		yamlContent += "\n"
-		yamlContent += "# 唯一标识符，用于数据统计\n"
-		yamlContent += fmt.Sprintf("uuid: %s\n", config.UUID)
-		configData = []byte(yamlContent)
-	} else {
-		// 生成JSON格式
-		configData, err = json.MarshalIndent(config, "", "  ")
-		if err != nil {
-			return err
+	}
+	for _, item := range cfg.OtherWhiteList {
+		if strings.TrimSpace(item) == "" {
+			return &configValidationError{"otherWhiteList", "白名单中存在空项"}
 		}
 	}
+	for _, item := range cfg.OtherBlackList {
+		if strings.TrimSpace(item) == "" {
+			return &configValidationError{"otherBlackList", "黑名单中存在空项"}
+		}
+	}
+	if cfg.Admin.Enabled && (cfg.Admin.Username == "" || cfg.Admin.Password == "") {
+		return &configValidationError{"admin.password", "启用管理API时必须设置用户名和密码"}
+	}
+	if err := validateTLSConfig(cfg); err != nil {
+		return err
+	}
+	if err := validateOutboundConfig(cfg); err != nil {
+		return err
+	}
+	if err := validateMirrorsConfig(cfg); err != nil {
+		return err
+	}
+	if err := validateTimeoutsConfig(cfg); err != nil {
+		return err
+	}
+	if err := validateResolverConfig(cfg); err != nil {
+		return err
+	}
+	if err := validateCompressionConfig(cfg); err != nil {
+		return err
+	}
+	if err := validateLogConfig(cfg); err != nil {
+		return err
+	}
+	if err := validateAccessLogConfig(cfg); err != nil {
+		return err
+	}
+	if err := validateStatsConfig(cfg); err != nil {
+		return err
+	}
+	if err := validateHealthConfig(cfg); err != nil {
+		return err
+	}
+	if err := validateTracingConfig(cfg); err != nil {
+		return err
+	}
+	if err := validateTelemetryConfig(cfg); err != nil {
+		return err
+	}
+	if cfg.Retry.MaxAttempts <= 0 {
+		return &configValidationError{"retry.maxAttempts", "最大尝试次数必须大于0"}
+	}
+	if cfg.Retry.Backoff < 0 {
+		return &configValidationError{"retry.backoff", "重试等待时间不能为负数"}
+	}
+	if cfg.Retry.MaxResumes < 0 {
+		return &configValidationError{"retry.maxResumes", "续传次数不能为负数"}
+	}
+	return nil
+}
+
+// 替换当前生效的配置
+func swapConfig(mainConfig, effectiveConfig *Config) {
+	configLock.Lock()
+	fileConfig = mainConfig
+	config = effectiveConfig
+	configLock.Unlock()
+
+	// 使新的日志和上游配置生效
+	refreshLogger(effectiveConfig)
+	refreshAccessLog(effectiveConfig)
+	refreshHTTPClient(effectiveConfig)
+	refreshResolver(effectiveConfig)
+	refreshTracing(effectiveConfig)
+}
 
-	return os.WriteFile(path, configData, 0644)
+// 使用默认配置
+func useDefaultConfig() {
+	swapConfig(cloneConfig(&defaultConfig), cloneConfig(&defaultConfig))
+}
+
+// 配置无效时保留当前配置，首次加载时使用默认配置
+func keepCurrentConfig() {
+	configLock.RLock()
+	loaded := config != nil
+	configLock.RUnlock()
+
+	if !loaded {
+		useDefaultConfig()
+	}
 }
 
 // 加载配置
 func loadConfig(path string) {
+	configWriteLock.Lock()
+	defer configWriteLock.Unlock()
+
 	file, err := os.Open(path)
 	if err != nil {
-		printfWithTime("加载配置文件失败: %v，使用默认配置\n", err)
-		configLock.Lock()
-		config = &defaultConfig
-		configLock.Unlock()
+		logError("加载配置文件失败，保留当前配置", "path", path, "error", err)
+		recordConfigReload("file", err)
+		keepCurrentConfig()
 		return
 	}
 	defer file.Close()
@@ -173,24 +727,22 @@ func loadConfig(path string) {
 	var versionUpdated bool
 
 	// 根据文件扩展名选择解析器
-	if strings.HasSuffix(path, ".yml") || strings.HasSuffix(path, ".yaml") {
+	if isYAMLPath(path) {
 		// 使用YAML解析器
 		decoder := yaml.NewDecoder(file)
 		if err := decoder.Decode(&newConfig); err != nil {
-			printfWithTime("解析YAML配置文件失败: %v，使用默认配置\n", err)
-			configLock.Lock()
-			config = &defaultConfig
-			configLock.Unlock()
+			logError("解析YAML配置文件失败，保留当前配置", "path", path, "error", err)
+			recordConfigReload("file", err)
+			keepCurrentConfig()
 			return
 		}
 	} else {
 		// 使用JSON解析器
 		decoder := json.NewDecoder(file)
 		if err := decoder.Decode(&newConfig); err != nil {
-			printfWithTime("解析JSON配置文件失败: %v，使用默认配置\n", err)
-			configLock.Lock()
-			config = &defaultConfig
-			configLock.Unlock()
+			logError("解析JSON配置文件失败，保留当前配置", "path", path, "error", err)
+			recordConfigReload("file", err)
+			keepCurrentConfig()
 			return
 		}
 	}
@@ -199,19 +751,18 @@ func loadConfig(path string) {
 	configUpdated := false
 	versionUpdated = false
 	if newConfig.Version != configVersion {
-		printfWithTime("检测到配置文件版本不一致 (%s -> %s)，更新配置文件...\n", newConfig.Version, configVersion)
+		logInfo("检测到配置文件版本不一致，更新配置文件", "from", newConfig.Version, "to", configVersion)
 		newConfig.Version = configVersion
 		configUpdated = true
 		versionUpdated = true
 	}
 
 	// 使用默认值填充未配置项
-	if newConfig.Host == "" {
-		newConfig.Host = defaultHost
+	if migrateListeners(&newConfig) {
 		configUpdated = true
 	}
-	if newConfig.Port == 0 {
-		newConfig.Port = defaultPort
+	if newConfig.Policies == nil {
+		newConfig.Policies = map[string]PolicyConfig{}
 		configUpdated = true
 	}
 	if newConfig.SizeLimit <= 0 {
@@ -234,99 +785,129 @@ func loadConfig(path string) {
 		newConfig.OtherBlackList = []string{}
 		configUpdated = true
 	}
+	if newConfig.ShutdownTimeout <= 0 {
+		newConfig.ShutdownTimeout = defaultShutdownTimeout
+		configUpdated = true
+	}
+	if newConfig.TunnelHosts == nil {
+		newConfig.TunnelHosts = append([]string{}, defaultConfig.TunnelHosts...)
+		configUpdated = true
+	}
+	if newConfig.TrustedProxies == nil {
+		newConfig.TrustedProxies = []string{}
+		configUpdated = true
+	}
+	if newConfig.Admin.Username == "" {
+		newConfig.Admin.Username = defaultAdminUsername
+		configUpdated = true
+	}
+	if newConfig.TLS.Certificates == nil {
+		newConfig.TLS.Certificates = []TLSCertificateFile{}
+		configUpdated = true
+	}
+	if newConfig.TLS.MinVersion == "" {
+		newConfig.TLS.MinVersion = defaultTLSMinVersion
+		configUpdated = true
+	}
+	if newConfig.Outbound.Proxies == nil {
+		newConfig.Outbound.Proxies = []OutboundProxy{}
+		configUpdated = true
+	}
+	if newConfig.Outbound.NoProxy == nil {
+		newConfig.Outbound.NoProxy = []string{}
+		configUpdated = true
+	}
+	if newConfig.Outbound.LocalAddresses == nil {
+		newConfig.Outbound.LocalAddresses = []string{}
+		configUpdated = true
+	}
+	if newConfig.Outbound.LocalAddressStrategy == "" {
+		newConfig.Outbound.LocalAddressStrategy = egressRoundRobin
+		configUpdated = true
+	}
+	if newConfig.Rules == nil {
+		newConfig.Rules = map[string]RuleConfig{}
+		configUpdated = true
+	}
+	if newConfig.Retry.MaxAttempts <= 0 {
+		newConfig.Retry = defaultConfig.Retry
+		configUpdated = true
+	}
+	if fillTimeoutDefaults(&newConfig.Timeouts) {
+		configUpdated = true
+	}
+	if fillResolverDefaults(&newConfig.Resolver) {
+		configUpdated = true
+	}
+	if fillCompressionDefaults(&newConfig.Compression) {
+		configUpdated = true
+	}
+	if fillLogDefaults(&newConfig.Log) {
+		configUpdated = true
+	}
+	if fillAccessLogDefaults(&newConfig.AccessLog) {
+		configUpdated = true
+	}
+	if fillStatsDefaults(&newConfig.Stats) {
+		configUpdated = true
+	}
+	if fillHealthDefaults(&newConfig.Health) {
+		configUpdated = true
+	}
+	if fillTracingDefaults(&newConfig.Tracing) {
+		configUpdated = true
+	}
+	if fillTelemetryDefaults(&newConfig.Telemetry) {
+		configUpdated = true
+	}
+	if newConfig.TLS.RedirectPort == 0 {
+		newConfig.TLS.RedirectPort = defaultRedirectPort
+		configUpdated = true
+	}
 
 	// 如果配置文件中没有UUID，生成一个新的
+	uuidGenerated := false
 	if newConfig.UUID == "" {
 		newConfig.UUID = generateUUID()
 		configUpdated = true
+		uuidGenerated = true
 	}
 
 	// 如果配置有更新，写回文件
 	if configUpdated {
 		// 将更新后的配置写回文件
-		var configData []byte
-		var err error
-
-		// 根据文件扩展名选择格式
-		if strings.HasSuffix(path, ".yml") || strings.HasSuffix(path, ".yaml") {
-			// 生成带注释的YAML格式
-			yamlContent := "# FastCode 配置文件\n"
-			yamlContent += "# 配置文件版本，请勿修改\n"
-			yamlContent += fmt.Sprintf("version: %s\n\n", newConfig.Version)
-			yamlContent += "# 监听地址，默认: 0.0.0.0\n"
-			yamlContent += fmt.Sprintf("host: %s\n\n", newConfig.Host)
-			yamlContent += "# 监听端口，默认: 8080\n"
-			yamlContent += fmt.Sprintf("port: %d\n\n", newConfig.Port)
-			yamlContent += "# 文件大小限制，默认: 10GB\n"
-			yamlContent += fmt.Sprintf("sizeLimit: %d\n\n", newConfig.SizeLimit)
-			yamlContent += "# GitHub地址白名单，支持通配符\n"
-			yamlContent += "whiteList: []\n"
-			if len(newConfig.WhiteList) > 0 {
-				for _, item := range newConfig.WhiteList {
-					yamlContent += fmt.Sprintf("  - %s\n", item)
-				}
-			}
-			yamlContent += "\n"
-			yamlContent += "# GitHub地址黑名单，支持通配符\n"
-			yamlContent += "blackList: []\n"
-			if len(newConfig.BlackList) > 0 {
-				for _, item := range newConfig.BlackList {
-					yamlContent += fmt.Sprintf("  - %s\n", item)
-				}
-			}
-			yamlContent += "\n"
-			yamlContent += "# 是否允许代理非GitHub的其他地址\n"
-			yamlContent += fmt.Sprintf("allowProxyAll: %t\n\n", newConfig.AllowProxyAll)
-			yamlContent += "# 其他地址白名单\n"
-			yamlContent += "otherWhiteList: []\n"
-			if len(newConfig.OtherWhiteList) > 0 {
-				for _, item := range newConfig.OtherWhiteList {
-					yamlContent += fmt.Sprintf("  - %s\n", item)
-				}
-			}
-			yamlContent += "\n"
-			yamlContent += "# 其他地址黑名单\n"
-			yamlContent += "otherBlackList: []\n"
-			if len(newConfig.OtherBlackList) > 0 {
-				for _, item := range newConfig.OtherBlackList {
-					yamlContent += fmt.Sprintf("  - %s\n", item)
-				}
-			}
-			yamlContent += "\n"
-			yamlContent += "# 唯一标识符，用于数据统计\n"
-			yamlContent += fmt.Sprintf("uuid: %s\n", newConfig.UUID)
-			configData = []byte(yamlContent)
+		if err := writeConfigFile(path, &newConfig); err != nil {
+			logError("写入配置文件失败", "path", path, "error", err)
 		} else {
-			// 生成JSON格式
-			configData, err = json.MarshalIndent(newConfig, "", "  ")
-			if err != nil {
-				printfWithTime("更新配置文件失败: %v\n", err)
-				return
+			// 显示更新消息
+			if versionUpdated {
+				logInfo("配置文件已更新版本", "version", configVersion)
+			} else if uuidGenerated {
+				logInfo("配置文件已更新UUID", "uuid", newConfig.UUID)
 			}
 		}
+	}
 
-		if err != nil {
-			printfWithTime("更新配置文件失败: %v\n", err)
-		} else {
-			err = os.WriteFile(path, configData, 0644)
-			if err != nil {
-				printfWithTime("写入配置文件失败: %v\n", err)
-			} else {
-				// 显示更新消息
-				if versionUpdated {
-					printlnWithTime("配置文件已更新版本")
-				} else if newConfig.UUID == "" {
-					printlnWithTime("配置文件已更新UUID")
-				}
-			}
-		}
+	// 合并conf.d目录中的配置片段
+	effectiveConfig, provenance, err := applyConfigIncludes(path, &newConfig)
+	if err != nil {
+		logError("加载conf.d配置片段失败，保留当前配置", "error", err)
+		recordConfigReload("file", err)
+		keepCurrentConfig()
+		return
 	}
 
-	configLock.Lock()
-	config = &newConfig
-	configLock.Unlock()
+	if err := validateConfig(effectiveConfig); err != nil {
+		logError("配置校验失败，保留当前配置", "error", describeConfigError(err, provenance))
+		recordConfigReload("file", err)
+		keepCurrentConfig()
+		return
+	}
+
+	swapConfig(&newConfig, effectiveConfig)
+	recordConfigReload("file", nil)
 
-	printlnWithTime("配置文件加载成功")
+	logInfo("配置文件加载成功", "path", path)
 }
 
 // 自动刷新配置
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 在测试期间替换当前配置，结束后恢复；cfg为nil时模拟尚未加载配置
+func setTestConfig(t *testing.T, cfg *Config) {
+	t.Helper()
+	configLock.Lock()
+	oldConfig, oldFileConfig := config, fileConfig
+	config, fileConfig = cfg, nil
+	if cfg != nil {
+		fileConfig = cloneConfig(cfg)
+	}
+	configLock.Unlock()
+	t.Cleanup(func() {
+		configLock.Lock()
+		config, fileConfig = oldConfig, oldFileConfig
+		configLock.Unlock()
+	})
+}
+
+// 获取默认配置的副本
+func testConfig() *Config {
+	cfg := cloneConfig(&defaultConfig)
+	cfg.Version = configVersion
+	cfg.UUID = "00000000-0000-0000-0000-000000000000"
+	return cfg
+}
+
+func currentAdminPassword() string {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return config.Admin.Password
+}
+
+func TestLoadConfigKeepsCurrentConfigOnReloadError(t *testing.T) {
+	setTestConfig(t, nil)
+	path := filepath.Join(t.TempDir(), "fastcode.yml")
+
+	// 首次加载失败时使用默认配置
+	if err := os.WriteFile(path, []byte("sizeLimit: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loadConfig(path)
+	if got := currentAdminPassword(); got != defaultConfig.Admin.Password {
+		t.Fatalf("首次加载失败后应使用默认配置，admin.password = %q", got)
+	}
+
+	cfg := testConfig()
+	cfg.Admin = AdminConfig{Enabled: true, Username: "admin", Password: "secret"}
+	if err := writeConfigFile(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	loadConfig(path)
+	if got := currentAdminPassword(); got != "secret" {
+		t.Fatalf("加载有效配置后 admin.password = %q, want secret", got)
+	}
+
+	tests := []struct {
+		name  string
+		setup func() error
+	}{
+		{"解析失败", func() error { return os.WriteFile(path, []byte("admin: [\n"), 0644) }},
+		{"校验失败", func() error { return os.WriteFile(path, []byte("admin:\n  enabled: true\n"), 0644) }},
+		{"文件不存在", func() error { return os.Remove(path) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.setup(); err != nil {
+				t.Fatal(err)
+			}
+			loadConfig(path)
+			if got := currentAdminPassword(); got != "secret" {
+				t.Errorf("重新加载失败后应保留当前配置，admin.password = %q", got)
+			}
+		})
+	}
+}
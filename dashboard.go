@@ -0,0 +1,84 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 控制台页面路径
+const dashboardPath = "/dashboard"
+
+// 服务启动时间
+var startTime = time.Now()
+
+// 控制台页面及其资源，对应嵌入的public目录中的文件
+var dashboardFiles = map[string]string{
+	"":              "public/dashboard.html",
+	"dashboard.js":  "public/dashboard.js",
+	"dashboard.css": "public/dashboard.css",
+}
+
+// 初始化控制台路由，与管理API使用相同的认证
+func initDashboardRoutes(router *gin.Engine) {
+	dashboardGroup := router.Group(dashboardPath, adminAuth())
+	{
+		dashboardGroup.GET("", serveDashboard)
+		dashboardGroup.GET("/:file", serveDashboard)
+	}
+}
+
+// 是否为控制台页面或其资源文件，这些文件不能作为公开的静态资源提供
+func isDashboardPath(p string) bool {
+	return p == dashboardPath || strings.HasPrefix(p, dashboardPath+"/") || strings.HasPrefix(p, dashboardPath+".")
+}
+
+// 从嵌入的文件系统提供控制台页面
+func serveDashboard(c *gin.Context) {
+	name, ok := dashboardFiles[c.Param("file")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		return
+	}
+	data, err := embeddedPublic.ReadFile(name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		return
+	}
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	// 页面需要认证，不允许缓存
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// 控制台概览：运行状态、进行中的传输、响应状态和拒绝原因
+func getOverview(c *gin.Context) {
+	statusClasses := map[string]float64{}
+	for code, count := range requestsTotal.sumBy(1) {
+		statusClasses[code[:1]+"xx"] += count
+	}
+
+	tunnelsLock.Lock()
+	tunnelCount := len(tunnels)
+	tunnelsLock.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"version":         version,
+		"startTime":       startTime,
+		"uptime":          int64(time.Since(startTime).Seconds()),
+		"activeTransfers": atomic.LoadInt64(&activeTransfers),
+		"tunnels":         tunnelCount,
+		"statusClasses":   statusClasses,
+		"blocked":         blockedTotal.sumBy(0),
+		// 暂未实现缓存，控制台据此显示缓存未启用
+		"cache": gin.H{"enabled": false},
+	})
+}
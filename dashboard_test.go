@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIsDashboardPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/dashboard", true},
+		{"/dashboard/", true},
+		{"/dashboard/dashboard.js", true},
+		{"/dashboard.html", true},
+		{"/dashboards", false},
+		{"/https://github.com/dashboard", false},
+		{"/", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := isDashboardPath(tt.path); got != tt.want {
+				t.Errorf("isDashboardPath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeDashboard(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := testConfig()
+	cfg.Admin.Enabled = true
+	cfg.Admin.Username = "admin"
+	cfg.Admin.Password = "secret"
+	setTestConfig(t, cfg)
+
+	router := gin.New()
+	initDashboardRoutes(router)
+
+	tests := []struct {
+		name        string
+		path        string
+		password    string
+		wantStatus  int
+		contentType string
+	}{
+		{"控制台页面", "/dashboard", "secret", http.StatusOK, "text/html"},
+		{"脚本", "/dashboard/dashboard.js", "secret", http.StatusOK, "javascript"},
+		{"样式", "/dashboard/dashboard.css", "secret", http.StatusOK, "text/css"},
+		{"不属于控制台的文件", "/dashboard/index.html", "secret", http.StatusNotFound, ""},
+		{"密码错误", "/dashboard", "wrong", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.SetBasicAuth("admin", tt.password)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("状态码 = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := w.Header().Get("Content-Type"); !strings.Contains(got, tt.contentType) {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if got := w.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 按顺序轮流使用本地地址
+	egressRoundRobin = "roundRobin"
+	// 优先使用最久未被限流的本地地址
+	egressLeastThrottled = "leastThrottled"
+)
+
+// 本地地址与目标地址的协议族不同
+var errAddressFamily = errors.New("目标地址与本地地址的协议族不同")
+
+// 本地地址的使用统计
+type egressStat struct {
+	requests      int64
+	errors        int64
+	throttled     int64
+	lastThrottled time.Time
+	lastUsed      time.Time
+}
+
+var (
+	// 本地地址的使用统计，重建HTTP客户端后保留
+	egressStats = map[string]*egressStat{}
+	egressLock  sync.Mutex
+	egressNext  int
+)
+
+// 将请求分配到绑定不同本地地址的连接
+type egressTransport struct {
+	addrs      []string
+	transports []*http.Transport
+}
+
+// 为每个本地地址创建独立的连接池，使轮换对每个请求生效
+func newEgressTransport(addrs []string, newTransport func(localAddr net.Addr) *http.Transport) *egressTransport {
+	t := &egressTransport{addrs: addrs}
+	for _, addr := range addrs {
+		t.transports = append(t.transports, newTransport(&net.TCPAddr{IP: net.ParseIP(addr)}))
+	}
+	return t
+}
+
+func (t *egressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	order := egressOrder(t.addrs)
+
+	var err error
+	for _, i := range order {
+		var resp *http.Response
+		resp, err = t.transports[i].RoundTrip(req)
+		// 协议族不同时连接尚未建立，幂等请求可以换一个本地地址
+		if errors.Is(err, errAddressFamily) && isIdempotent(req.Method) {
+			continue
+		}
+		recordEgressResult(t.addrs[i], resp, err)
+		return resp, err
+	}
+	return nil, err
+}
+
+func (t *egressTransport) CloseIdleConnections() {
+	for _, transport := range t.transports {
+		transport.CloseIdleConnections()
+	}
+}
+
+// 按选择策略排列本地地址
+func egressOrder(addrs []string) []int {
+	configLock.RLock()
+	strategy := config.Outbound.LocalAddressStrategy
+	configLock.RUnlock()
+
+	egressLock.Lock()
+	defer egressLock.Unlock()
+
+	start := egressNext % len(addrs)
+	egressNext++
+	order := make([]int, 0, len(addrs))
+	for i := range addrs {
+		order = append(order, (start+i)%len(addrs))
+	}
+
+	// 从未被限流的地址之间仍按顺序轮流使用
+	if strategy == egressLeastThrottled {
+		lastThrottled := func(i int) time.Time {
+			if stat, ok := egressStats[addrs[i]]; ok {
+				return stat.lastThrottled
+			}
+			return time.Time{}
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return lastThrottled(order[a]).Before(lastThrottled(order[b]))
+		})
+	}
+	return order
+}
+
+// 是否为限流响应
+func isThrottled(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		return resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != ""
+	}
+	return false
+}
+
+// 记录本地地址的请求结果
+func recordEgressResult(addr string, resp *http.Response, err error) {
+	egressLock.Lock()
+	defer egressLock.Unlock()
+
+	stat, ok := egressStats[addr]
+	if !ok {
+		stat = &egressStat{}
+		egressStats[addr] = stat
+	}
+	stat.requests++
+	stat.lastUsed = time.Now()
+	if err != nil {
+		stat.errors++
+		return
+	}
+	// 隧道连接没有响应
+	if resp != nil && isThrottled(resp) {
+		stat.throttled++
+		stat.lastThrottled = time.Now()
+		logWarn("出站地址被限流", requestLogFields(resp.Request.Context(), "addr", addr, "status", resp.StatusCode)...)
+	}
+}
+
+// 校验本地地址配置
+func validateEgressConfig(cfg *Config) error {
+	seen := map[string]bool{}
+	for _, addr := range cfg.Outbound.LocalAddresses {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return &configValidationError{"outbound.localAddresses", fmt.Sprintf("本地地址无效: %s", addr)}
+		}
+		if seen[ip.String()] {
+			return &configValidationError{"outbound.localAddresses", fmt.Sprintf("本地地址重复: %s", addr)}
+		}
+		seen[ip.String()] = true
+	}
+	switch cfg.Outbound.LocalAddressStrategy {
+	case egressRoundRobin, egressLeastThrottled:
+	default:
+		return &configValidationError{"outbound.localAddressStrategy", fmt.Sprintf("不支持的选择策略: %s", cfg.Outbound.LocalAddressStrategy)}
+	}
+	return nil
+}
+
+// 查看本地地址的使用统计
+func getEgressStats(c *gin.Context) {
+	configLock.RLock()
+	addrs := config.Outbound.LocalAddresses
+	strategy := config.Outbound.LocalAddressStrategy
+	configLock.RUnlock()
+
+	egressLock.Lock()
+	result := make([]gin.H, 0, len(addrs))
+	for _, addr := range addrs {
+		stat, ok := egressStats[addr]
+		if !ok {
+			stat = &egressStat{}
+		}
+		result = append(result, gin.H{
+			"address":       addr,
+			"requests":      stat.requests,
+			"errors":        stat.errors,
+			"throttled":     stat.throttled,
+			"lastThrottled": stat.lastThrottled,
+			"lastUsed":      stat.lastUsed,
+		})
+	}
+	egressLock.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"strategy":  strategy,
+		"addresses": result,
+	})
+}
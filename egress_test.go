@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 在测试期间使用独立的本地地址统计
+func resetEgressStats(t *testing.T) {
+	t.Helper()
+	egressLock.Lock()
+	oldStats, oldNext := egressStats, egressNext
+	egressStats, egressNext = map[string]*egressStat{}, 0
+	egressLock.Unlock()
+	t.Cleanup(func() {
+		egressLock.Lock()
+		egressStats, egressNext = oldStats, oldNext
+		egressLock.Unlock()
+	})
+}
+
+func TestEgressOrder(t *testing.T) {
+	addrs := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}
+	tests := []struct {
+		name      string
+		strategy  string
+		throttled map[string]time.Time
+		want      [][]int
+	}{
+		{"按顺序轮流使用", egressRoundRobin, nil, [][]int{{0, 1, 2}, {1, 2, 0}, {2, 0, 1}, {0, 1, 2}}},
+		{"优先使用最久未被限流的地址", egressLeastThrottled, map[string]time.Time{
+			"192.0.2.1": time.Now(),
+			"192.0.2.2": time.Now().Add(-time.Hour),
+		}, [][]int{{2, 1, 0}, {2, 1, 0}}},
+		{"未被限流的地址之间轮流使用", egressLeastThrottled, map[string]time.Time{
+			"192.0.2.1": time.Now(),
+		}, [][]int{{1, 2, 0}, {1, 2, 0}, {2, 1, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetEgressStats(t)
+			cfg := testConfig()
+			cfg.Outbound.LocalAddressStrategy = tt.strategy
+			setTestConfig(t, cfg)
+			for addr, lastThrottled := range tt.throttled {
+				egressStats[addr] = &egressStat{lastThrottled: lastThrottled}
+			}
+			for i, want := range tt.want {
+				if got := egressOrder(addrs); !reflect.DeepEqual(got, want) {
+					t.Errorf("第%d次 egressOrder() = %v, want %v", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsThrottled(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		want   bool
+	}{
+		{"429", http.StatusTooManyRequests, http.Header{}, true},
+		{"403 剩余次数为0", http.StatusForbidden, http.Header{"X-Ratelimit-Remaining": {"0"}}, true},
+		{"403 带Retry-After", http.StatusForbidden, http.Header{"Retry-After": {"60"}}, true},
+		{"403 没有权限", http.StatusForbidden, http.Header{"X-Ratelimit-Remaining": {"10"}}, false},
+		{"200", http.StatusOK, http.Header{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isThrottled(&http.Response{StatusCode: tt.status, Header: tt.header}); got != tt.want {
+				t.Errorf("isThrottled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordEgressResult(t *testing.T) {
+	resetEgressStats(t)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	recordEgressResult("192.0.2.1", &http.Response{StatusCode: http.StatusOK, Request: req}, nil)
+	recordEgressResult("192.0.2.1", &http.Response{StatusCode: http.StatusTooManyRequests, Request: req}, nil)
+	recordEgressResult("192.0.2.1", nil, errors.New("connection refused"))
+	// 隧道连接成功时没有响应
+	recordEgressResult("192.0.2.1", nil, nil)
+
+	stat := egressStats["192.0.2.1"]
+	if stat.requests != 4 || stat.errors != 1 || stat.throttled != 1 || stat.lastThrottled.IsZero() {
+		t.Errorf("统计 = %+v", stat)
+	}
+}
+
+func TestValidateEgressConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		addrs     []string
+		strategy  string
+		wantField string
+	}{
+		{"不绑定本地地址", nil, egressRoundRobin, ""},
+		{"IPv4和IPv6", []string{"192.0.2.1", "2001:db8::1"}, egressLeastThrottled, ""},
+		{"地址无效", []string{"192.0.2.300"}, egressRoundRobin, "outbound.localAddresses"},
+		{"地址重复", []string{"2001:db8::1", "2001:db8:0::1"}, egressRoundRobin, "outbound.localAddresses"},
+		{"策略无效", nil, "random", "outbound.localAddressStrategy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Outbound.LocalAddresses = tt.addrs
+			cfg.Outbound.LocalAddressStrategy = tt.strategy
+			err := validateEgressConfig(cfg)
+			field := ""
+			if validationErr, ok := err.(*configValidationError); ok {
+				field = validationErr.Field
+			}
+			if field != tt.wantField {
+				t.Errorf("validateEgressConfig() = %v, want field %q", err, tt.wantField)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 普通监听，通过路径前缀代理
+	listenerModeServer = "server"
+	// 正向代理监听，客户端将其设置为HTTP代理
+	listenerModeForward = "forward"
+)
+
+// 标记正向代理请求的context键
+type forwardProxyContextKey struct{}
+
+// 是否为正向代理请求
+func isForwardProxyRequest(ctx context.Context) bool {
+	forward, _ := ctx.Value(forwardProxyContextKey{}).(bool)
+	return forward
+}
+
+// 进行中的CONNECT隧道
+type tunnel struct {
+	id        int64
+	requestID string
+	client    string
+	target    string
+	apiKeyID  string
+	start     time.Time
+	sent      int64 // 客户端发往目标的字节数
+	received  int64 // 目标返回客户端的字节数
+}
+
+var (
+	tunnels      = map[int64]*tunnel{}
+	tunnelsLock  sync.Mutex
+	nextTunnelID int64
+)
+
+// 统计写入字节数
+type countingWriter struct {
+	w     io.Writer
+	count *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	atomic.AddInt64(w.count, int64(n))
+	return n, err
+}
+
+// 正向代理处理器：CONNECT请求建立隧道，绝对URL的HTTP请求转换为路径形式后交给代理处理
+func forwardProxyHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), forwardProxyContextKey{}, true)
+		if r.Method == http.MethodConnect {
+			handleConnect(w, r.WithContext(ctx))
+			return
+		}
+		if !r.URL.IsAbs() {
+			http.Error(w, "此监听为正向代理，请将其设置为HTTP代理使用", http.StatusBadRequest)
+			return
+		}
+
+		pathURL, err := url.ParseRequestURI("/" + r.URL.String())
+		if err != nil {
+			http.Error(w, "无效的请求地址", http.StatusBadRequest)
+			return
+		}
+		proxied := r.Clone(ctx)
+		proxied.URL = pathURL
+		proxied.RequestURI = pathURL.RequestURI()
+		next.ServeHTTP(w, proxied)
+	})
+}
+
+// 是否允许建立到该域名的隧道，hosts中的域名包含其子域名
+func tunnelAllowed(host string, hosts []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range hosts {
+		allowed = strings.ToLower(strings.TrimSuffix(allowed, "."))
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析Proxy-Authorization中的Basic认证
+func proxyBasicAuth(r *http.Request) (username, password string, ok bool) {
+	encoded, found := strings.CutPrefix(r.Header.Get("Proxy-Authorization"), "Basic ")
+	if !found {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+	username, password, ok = strings.Cut(string(decoded), ":")
+	return username, password, ok
+}
+
+// 建立到GitHub的CONNECT隧道
+func handleConnect(w http.ResponseWriter, r *http.Request) {
+	// 隧道请求不经过Gin，单独分配请求ID
+	requestID := newRequestID(r)
+	w.Header().Set(requestIDHeader, requestID)
+
+	policy := policyFromContext(r.Context())
+	if !policy.routeEnabled(routeProxy) {
+		http.Error(w, "此监听未启用代理", http.StatusNotFound)
+		return
+	}
+	apiKeyID := ""
+	if len(policy.APIKeys) > 0 {
+		id, ok := authenticateAPIKey(r, policy.APIKeys)
+		if !ok {
+			recordBlocked(blockedAuth)
+			w.Header().Set("Proxy-Authenticate", `Basic realm="FastCode"`)
+			http.Error(w, "需要提供有效的访问密钥", http.StatusProxyAuthRequired)
+			return
+		}
+		apiKeyID = id
+	}
+
+	// 隧道内容经过加密无法按仓库检查名单，策略限制了仓库或规则时不允许建立隧道
+	if policy.filtersRepos() {
+		recordBlocked(blockedTunnel)
+		http.Error(w, "此监听限制了可代理的仓库，隧道内无法按仓库过滤，请使用地址前缀的方式代理", http.StatusForbidden)
+		return
+	}
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil || port != "443" || !tunnelAllowed(host, policy.TunnelHosts) {
+		recordBlocked(blockedTunnel)
+		http.Error(w, "不允许建立到该地址的隧道，只允许tunnelHosts中域名的443端口", http.StatusForbidden)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "当前连接不支持建立隧道", http.StatusInternalServerError)
+		return
+	}
+
+	targetConn, err := dialTunnel(r.Context(), r.Host)
+	if err != nil {
+		http.Error(w, "连接目标失败: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer targetConn.Close()
+
+	clientConn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		logError("接管隧道连接失败", "requestId", requestID, "error", err)
+		return
+	}
+	defer clientConn.Close()
+
+	// 记录进行中的传输，关闭服务时等待其完成
+	defer trackTransfer()()
+
+	t := &tunnel{
+		id:        atomic.AddInt64(&nextTunnelID, 1),
+		requestID: requestID,
+		client:    clientIPFromRequest(r),
+		target:    r.Host,
+		apiKeyID:  apiKeyID,
+		start:     time.Now(),
+	}
+	tunnelsLock.Lock()
+	tunnels[t.id] = t
+	tunnelsLock.Unlock()
+	defer func() {
+		tunnelsLock.Lock()
+		delete(tunnels, t.id)
+		tunnelsLock.Unlock()
+		requestsTotal.inc(tunnelRuleLabel, strconv.Itoa(http.StatusOK))
+		requestBytesTotal.add(float64(atomic.LoadInt64(&t.sent)), tunnelRuleLabel)
+		responseBytesTotal.add(float64(atomic.LoadInt64(&t.received)), tunnelRuleLabel)
+		writeAccessLog(&accessEntry{
+			start:          t.start,
+			requestID:      t.requestID,
+			clientIP:       t.client,
+			apiKeyID:       t.apiKeyID,
+			method:         r.Method,
+			request:        r.Host,
+			proto:          r.Proto,
+			target:         t.target,
+			rule:           tunnelRuleLabel,
+			upstream:       t.target,
+			upstreamStatus: http.StatusOK,
+			status:         http.StatusOK,
+			bytesIn:        atomic.LoadInt64(&t.sent),
+			bytesOut:       atomic.LoadInt64(&t.received),
+			userAgent:      r.UserAgent(),
+		})
+		recordUsage("https://"+t.target, tunnelRuleLabel, http.StatusOK, atomic.LoadInt64(&t.received))
+		logInfo("隧道已关闭", "id", t.id, "requestId", t.requestID, "client", t.client, "target", t.target,
+			"sent", atomic.LoadInt64(&t.sent), "received", atomic.LoadInt64(&t.received), "duration", time.Since(t.start).Round(time.Millisecond))
+	}()
+
+	if _, err := clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n" + requestIDHeader + ": " + requestID + "\r\n\r\n")); err != nil {
+		return
+	}
+
+	// 两个方向都长时间没有数据时关闭隧道，避免空闲连接一直占用
+	configLock.RLock()
+	idleTimeout := seconds(config.Timeouts.IdleRead)
+	configLock.RUnlock()
+	fromClient, fromTarget := withTunnelIdleTimeout(
+		struct {
+			io.Reader
+			io.Closer
+		}{buffered, clientConn},
+		targetConn, idleTimeout)
+	defer fromClient.Close()
+	defer fromTarget.Close()
+
+	// 任一方向结束后关闭两端连接
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(&countingWriter{targetConn, &t.sent}, fromClient)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(&countingWriter{clientConn, &t.received}, fromTarget)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// 获取请求的客户端IP，隧道请求不经过Gin，只使用连接地址
+func clientIPFromRequest(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// 查看进行中的隧道
+func getTunnels(c *gin.Context) {
+	tunnelsLock.Lock()
+	result := make([]gin.H, 0, len(tunnels))
+	for _, t := range tunnels {
+		result = append(result, gin.H{
+			"id":        t.id,
+			"requestId": t.requestID,
+			"client":    t.client,
+			"target":    t.target,
+			"apiKeyId":  t.apiKeyID,
+			"start":     t.start,
+			"sent":      atomic.LoadInt64(&t.sent),
+			"received":  atomic.LoadInt64(&t.received),
+		})
+	}
+	tunnelsLock.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i]["id"].(int64) < result[j]["id"].(int64)
+	})
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTunnelAllowed(t *testing.T) {
+	hosts := []string{"github.com", "githubusercontent.com."}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"github.com", true},
+		{"GitHub.com", true},
+		{"github.com.", true},
+		{"codeload.github.com", true},
+		{"raw.githubusercontent.com", true},
+		{"notgithub.com", false},
+		{"github.com.evil.example", false},
+		{"example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := tunnelAllowed(tt.host, hosts); got != tt.want {
+				t.Errorf("tunnelAllowed(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFiltersRepos(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy requestPolicy
+		want   bool
+	}{
+		{"不限制", requestPolicy{}, false},
+		{"白名单允许全部", requestPolicy{WhiteList: []string{"*"}}, false},
+		{"白名单", requestPolicy{WhiteList: []string{"owner/*"}}, true},
+		{"黑名单", requestPolicy{BlackList: []string{"owner/repo"}}, true},
+		{"URL规则", requestPolicy{Rules: []string{"github"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.filtersRepos(); got != tt.want {
+				t.Errorf("filtersRepos() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleConnectPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		whiteList  []string
+		apiKeys    []APIKeyConfig
+		host       string
+		auth       string
+		wantStatus int
+	}{
+		{"允许的域名", nil, nil, "github.com:443", "", http.StatusInternalServerError},
+		{"允许的子域名", nil, nil, "codeload.github.com:443", "", http.StatusInternalServerError},
+		{"其他域名", nil, nil, "example.com:443", "", http.StatusForbidden},
+		{"其他端口", nil, nil, "github.com:22", "", http.StatusForbidden},
+		{"缺少端口", nil, nil, "github.com", "", http.StatusForbidden},
+		{"限制了仓库", []string{"owner/*"}, nil, "github.com:443", "", http.StatusForbidden},
+		{"缺少密钥", nil, testAPIKeys, "github.com:443", "", http.StatusProxyAuthRequired},
+		{"使用密钥", nil, testAPIKeys, "github.com:443", basicAuthValue("u", "key-ci"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Listeners = []ListenerConfig{{Name: "forward", Address: ":8082", Policy: "forward", Mode: listenerModeForward}}
+			cfg.Policies = map[string]PolicyConfig{"forward": {WhiteList: tt.whiteList, APIKeys: tt.apiKeys}}
+			setTestConfig(t, cfg)
+
+			req := httptest.NewRequest(http.MethodConnect, "http://"+tt.host, nil)
+			req.Host = tt.host
+			if tt.auth != "" {
+				req.Header.Set("Proxy-Authorization", tt.auth)
+			}
+			ctx := context.WithValue(req.Context(), listenerContextKey{}, "forward")
+			w := httptest.NewRecorder()
+			// 通过检查后因ResponseRecorder不支持Hijack返回500
+			handleConnect(w, req.WithContext(ctx))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body = %q", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+// 模拟HTTP出站代理，校验认证信息后建立隧道并立即发送目标数据
+func startConnectProxy(t *testing.T, wantAuth string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				if req.Method != http.MethodConnect || req.Header.Get("Proxy-Authorization") != wantAuth {
+					io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+					return
+				}
+				io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\nhello "+req.Host)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestDialViaProxy(t *testing.T) {
+	addr := startConnectProxy(t, basicAuthValue("user", "secret"))
+	dialer := &net.Dialer{}
+
+	tests := []struct {
+		name     string
+		proxyURL string
+		want     string
+		wantErr  bool
+	}{
+		{"认证通过", "http://user:secret@" + addr, "hello github.com:443", false},
+		{"认证失败", "http://user:wrong@" + addr, "", true},
+		{"没有认证信息", "http://" + addr, "", true},
+		{"不支持的协议", "ftp://" + addr, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyURL, err := url.Parse(tt.proxyURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn, err := dialViaProxy(context.Background(), dialer.DialContext, proxyURL, "github.com:443", 5*time.Second)
+			if tt.wantErr {
+				if err == nil {
+					conn.Close()
+					t.Error("应返回错误")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			// 代理随响应一起发送的目标数据不能丢失
+			data, _ := io.ReadAll(conn)
+			if string(data) != tt.want {
+				t.Errorf("读取的数据 = %q, want %q", data, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 就绪检查项名称
+	healthCheckConfig   = "config"
+	healthCheckStorage  = "storage"
+	healthCheckUpstream = "upstream"
+
+	// 检查项状态
+	healthStatusOK      = "ok"
+	healthStatusFail    = "fail"
+	healthStatusPending = "pending"
+	// 排空期间的就绪状态
+	healthStatusDraining = "draining"
+)
+
+// 就绪检查项的状态
+type healthCheckState struct {
+	name          string
+	target        string
+	healthy       bool
+	latency       time.Duration
+	lastCheck     time.Time
+	lastError     string
+	lastErrorTime time.Time
+}
+
+var (
+	// 就绪检查项，键为名称和检查对象
+	healthChecks     = map[string]*healthCheckState{}
+	healthChecksLock sync.Mutex
+)
+
+func healthCheckKey(name, target string) string {
+	if target == "" {
+		return name
+	}
+	return name + " " + target
+}
+
+// 记录一次检查的结果，失败时保留最近一次错误
+func recordHealthCheck(name, target string, latency time.Duration, err error) {
+	healthChecksLock.Lock()
+	defer healthChecksLock.Unlock()
+
+	key := healthCheckKey(name, target)
+	state, ok := healthChecks[key]
+	if !ok {
+		state = &healthCheckState{name: name, target: target}
+		healthChecks[key] = state
+	}
+	state.lastCheck = time.Now()
+	state.latency = latency
+	state.healthy = err == nil
+	if err != nil {
+		state.lastError = err.Error()
+		state.lastErrorTime = state.lastCheck
+	}
+}
+
+// 登记尚未检查的项，就绪检查会等待其第一次结果
+func registerHealthCheck(name, target string) {
+	healthChecksLock.Lock()
+	defer healthChecksLock.Unlock()
+
+	key := healthCheckKey(name, target)
+	if _, ok := healthChecks[key]; !ok {
+		healthChecks[key] = &healthCheckState{name: name, target: target}
+	}
+}
+
+// 删除不在当前配置中的检查项
+func pruneHealthChecks(name string, targets map[string]bool) {
+	healthChecksLock.Lock()
+	defer healthChecksLock.Unlock()
+
+	for key, state := range healthChecks {
+		if state.name == name && !targets[state.target] {
+			delete(healthChecks, key)
+		}
+	}
+}
+
+// 定期执行就绪检查
+func autoCheckHealth() {
+	for {
+		checkHealth()
+
+		configLock.RLock()
+		interval := time.Duration(config.Health.Interval) * time.Second
+		configLock.RUnlock()
+		time.Sleep(interval)
+	}
+}
+
+// 探测上游并检查数据目录是否可写
+func checkHealth() {
+	configLock.RLock()
+	cfg := config
+	configLock.RUnlock()
+
+	targets := map[string]bool{}
+	for _, target := range cfg.Health.Upstreams {
+		targets[target] = true
+		registerHealthCheck(healthCheckUpstream, target)
+	}
+	pruneHealthChecks(healthCheckUpstream, targets)
+
+	var wg sync.WaitGroup
+	for target := range targets {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			// 与代理请求使用相同的出站配置，github.com 等根地址不匹配任何规则时使用默认规则
+			rule, _ := matchRule(target)
+			if rule == otherRuleName {
+				rule = defaultRuleName
+			}
+			latency, err := probeUpstream(rule, target)
+			recordHealthCheck(healthCheckUpstream, target, latency, err)
+		}(target)
+	}
+
+	dirs := storageDirs(cfg)
+	if len(dirs) > 0 {
+		start := time.Now()
+		err := checkDirsWritable(dirs)
+		recordHealthCheck(healthCheckStorage, "", time.Since(start), err)
+	} else {
+		pruneHealthChecks(healthCheckStorage, nil)
+	}
+
+	wg.Wait()
+}
+
+// 需要写入数据的目录
+func storageDirs(cfg *Config) []string {
+	seen := map[string]bool{}
+	var dirs []string
+	add := func(file string) {
+		dir := filepath.Dir(file)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	if cfg.Stats.Enabled {
+		add(cfg.Stats.File)
+	}
+	if cfg.Log.Output == logOutputFile {
+		add(cfg.Log.File)
+	}
+	if cfg.AccessLog.Enabled && cfg.AccessLog.Output == logOutputFile {
+		add(cfg.AccessLog.File)
+	}
+	return dirs
+}
+
+// 在目录中写入并删除临时文件，检查目录存在、有权限且磁盘未满
+func checkDirsWritable(dirs []string) error {
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		file, err := os.CreateTemp(dir, ".fastcode-health-*")
+		if err != nil {
+			return err
+		}
+		_, writeErr := file.Write([]byte("ok"))
+		closeErr := file.Close()
+		os.Remove(file.Name())
+		if writeErr != nil {
+			return fmt.Errorf("%s: %w", dir, writeErr)
+		}
+		if closeErr != nil {
+			return fmt.Errorf("%s: %w", dir, closeErr)
+		}
+	}
+	return nil
+}
+
+// 存活检查：进程能处理请求即返回成功
+func healthLive(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": healthStatusOK,
+		"uptime": int64(time.Since(startTime).Seconds()),
+	})
+}
+
+// 就绪检查：配置已加载、数据目录可写且所有上游可访问时返回成功，否则返回503和各项的检查结果
+func healthReady(c *gin.Context) {
+	healthChecksLock.Lock()
+	checks := make([]gin.H, 0, len(healthChecks))
+	ready := true
+	for _, state := range healthChecks {
+		status := healthStatusOK
+		switch {
+		case state.lastCheck.IsZero():
+			status = healthStatusPending
+			ready = false
+		case !state.healthy:
+			status = healthStatusFail
+			ready = false
+		}
+		check := gin.H{
+			"name":      state.name,
+			"status":    status,
+			"latencyMs": state.latency.Milliseconds(),
+			"lastCheck": state.lastCheck,
+		}
+		if state.target != "" {
+			check["target"] = state.target
+		}
+		if state.lastError != "" {
+			check["lastError"] = state.lastError
+			check["lastErrorTime"] = state.lastErrorTime
+		}
+		checks = append(checks, check)
+	}
+	healthChecksLock.Unlock()
+
+	sort.Slice(checks, func(i, j int) bool {
+		return healthCheckKey(checks[i]["name"].(string), fmt.Sprint(checks[i]["target"])) <
+			healthCheckKey(checks[j]["name"].(string), fmt.Sprint(checks[j]["target"]))
+	})
+
+	status, code := healthStatusOK, http.StatusOK
+	// 排空期间返回未就绪，让负载均衡停止转发新请求
+	if isDraining() {
+		status, code = healthStatusDraining, http.StatusServiceUnavailable
+	} else if !ready {
+		status, code = healthStatusFail, http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"status": status,
+		"checks": checks,
+	})
+}
+
+// 填充就绪检查配置的默认值
+func fillHealthDefaults(health *HealthConfig) bool {
+	defaults := defaultConfig.Health
+	updated := false
+	if health.Interval <= 0 {
+		health.Interval = defaults.Interval
+		updated = true
+	}
+	if health.Upstreams == nil {
+		health.Upstreams = append([]string{}, defaults.Upstreams...)
+		updated = true
+	}
+	return updated
+}
+
+// 校验就绪检查配置
+func validateHealthConfig(cfg *Config) error {
+	if cfg.Health.Interval <= 0 {
+		return &configValidationError{"health.interval", "就绪检查间隔必须大于0"}
+	}
+	for _, target := range cfg.Health.Upstreams {
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return &configValidationError{"health.upstreams", fmt.Sprintf("上游地址无效: %s", target)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 在测试期间使用独立的就绪检查项
+func resetHealthChecks(t *testing.T) {
+	t.Helper()
+	healthChecksLock.Lock()
+	oldChecks := healthChecks
+	healthChecks = map[string]*healthCheckState{}
+	healthChecksLock.Unlock()
+	t.Cleanup(func() {
+		healthChecksLock.Lock()
+		healthChecks = oldChecks
+		healthChecksLock.Unlock()
+	})
+}
+
+// 请求就绪检查，返回状态码和结果
+func getHealthReady(t *testing.T) (int, map[string]interface{}) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/health/ready", nil)
+	healthReady(c)
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, body
+}
+
+func TestCheckHealth(t *testing.T) {
+	resetHealthChecks(t)
+	var failing int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.Health.Upstreams = []string{server.URL}
+	cfg.Stats.Enabled = true
+	cfg.Stats.File = filepath.Join(t.TempDir(), "data", "stats.json")
+	setTestConfig(t, cfg)
+	initTestHTTPClient(t)
+
+	// 第一次检查之前未就绪
+	registerHealthCheck(healthCheckUpstream, server.URL)
+	if code, body := getHealthReady(t); code != http.StatusServiceUnavailable || body["status"] != healthStatusFail {
+		t.Errorf("检查前 = %d %v, want 503 fail", code, body["status"])
+	}
+
+	checkHealth()
+	if code, body := getHealthReady(t); code != http.StatusOK || len(body["checks"].([]interface{})) != 2 {
+		t.Errorf("检查通过后 = %d %v", code, body)
+	}
+
+	atomic.StoreInt32(&failing, 1)
+	checkHealth()
+	code, body := getHealthReady(t)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("上游失败后状态码 = %d, want 503", code)
+	}
+	for _, check := range body["checks"].([]interface{}) {
+		check := check.(map[string]interface{})
+		if check["name"] == healthCheckUpstream && (check["status"] != healthStatusFail || check["lastError"] == nil) {
+			t.Errorf("上游检查结果 = %v", check)
+		}
+	}
+
+	// 上游从配置中删除、不再写入数据后不再检查
+	cfg = testConfig()
+	cfg.Health.Upstreams = []string{}
+	cfg.Stats.Enabled = false
+	setTestConfig(t, cfg)
+	checkHealth()
+	if code, body := getHealthReady(t); code != http.StatusOK || len(body["checks"].([]interface{})) != 0 {
+		t.Errorf("删除上游后 = %d %v", code, body)
+	}
+}
+
+func TestHealthReadyDraining(t *testing.T) {
+	resetHealthChecks(t)
+	atomic.StoreInt32(&draining, 1)
+	t.Cleanup(func() { atomic.StoreInt32(&draining, 0) })
+	if code, body := getHealthReady(t); code != http.StatusServiceUnavailable || body["status"] != healthStatusDraining {
+		t.Errorf("排空期间 = %d %v, want 503 draining", code, body["status"])
+	}
+}
+
+func TestStorageDirs(t *testing.T) {
+	cfg := testConfig()
+	cfg.Stats.Enabled = true
+	cfg.Stats.File = "./data/stats.json"
+	cfg.Log.Output = logOutputFile
+	cfg.Log.File = "./logs/fastcode.log"
+	cfg.AccessLog.Enabled = true
+	cfg.AccessLog.Output = logOutputFile
+	cfg.AccessLog.File = "./logs/access.log"
+	if got, want := storageDirs(cfg), []string{"data", "logs"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("storageDirs() = %v, want %v", got, want)
+	}
+
+	cfg.Stats.Enabled = false
+	cfg.Log.Output = logOutputStdout
+	cfg.AccessLog.Enabled = false
+	if got := storageDirs(cfg); len(got) != 0 {
+		t.Errorf("没有写入文件时 storageDirs() = %v", got)
+	}
+}
+
+func TestCheckDirsWritable(t *testing.T) {
+	dir := t.TempDir()
+	if err := checkDirsWritable([]string{filepath.Join(dir, "a", "b")}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "a", "b"))
+	if err != nil || len(entries) != 0 {
+		t.Errorf("检查后应删除临时文件: %v, %v", entries, err)
+	}
+
+	// 路径为文件时不能创建目录
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDirsWritable([]string{file}); err == nil {
+		t.Error("应返回错误")
+	}
+}
+
+func TestValidateHealthConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    func(health *HealthConfig)
+		wantField string
+	}{
+		{"默认配置", func(health *HealthConfig) {}, ""},
+		{"没有上游", func(health *HealthConfig) { health.Upstreams = nil }, ""},
+		{"检查间隔为0", func(health *HealthConfig) { health.Interval = 0 }, "health.interval"},
+		{"上游缺少协议", func(health *HealthConfig) { health.Upstreams = []string{"github.com"} }, "health.upstreams"},
+		{"上游协议无效", func(health *HealthConfig) { health.Upstreams = []string{"ftp://github.com"} }, "health.upstreams"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			tt.modify(&cfg.Health)
+			err := validateHealthConfig(cfg)
+			field := ""
+			if validationErr, ok := err.(*configValidationError); ok {
+				field = validationErr.Field
+			}
+			if field != tt.wantField {
+				t.Errorf("validateHealthConfig() = %v, want field %q", err, tt.wantField)
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 旧配置迁移得到的监听名称
+	defaultListenerName = "default"
+	// Unix套接字地址前缀
+	unixAddressPrefix = "unix:"
+
+	// 可以按监听启用的路由
+	routeProxy = "proxy" // 代理请求和网页
+	routeAPI   = "api"   // /api 下的公开接口
+	routeAdmin = "admin" // /api/admin 管理接口
+
+	// 通过认证的访问密钥ID在gin.Context中的键
+	apiKeyIDKey = "apiKeyID"
+	// 专用于传递访问密钥的请求头，不会发送给上游
+	apiKeyHeader = "X-FastCode-Key"
+)
+
+var policyRoutes = []string{routeProxy, routeAPI, routeAdmin}
+
+// 请求所属监听名称在context中的键
+type listenerContextKey struct{}
+
+// 生效的监听策略
+type requestPolicy struct {
+	WhiteList      []string
+	BlackList      []string
+	AllowProxyAll  bool
+	OtherWhiteList []string
+	OtherBlackList []string
+	SizeLimit      int64
+	Rules          []string
+	Routes         []string
+	APIKeys        []APIKeyConfig
+	TunnelHosts    []string
+}
+
+// 将旧配置中的host和port迁移为监听，返回是否有更新
+func migrateListeners(cfg *Config) bool {
+	if len(cfg.Listeners) > 0 && cfg.Host == "" && cfg.Port == 0 {
+		return false
+	}
+	if len(cfg.Listeners) == 0 {
+		host, port := cfg.Host, cfg.Port
+		if host == "" {
+			host = defaultHost
+		}
+		if port == 0 {
+			port = defaultPort
+		}
+		cfg.Listeners = []ListenerConfig{{
+			Name:    defaultListenerName,
+			Address: net.JoinHostPort(host, strconv.FormatInt(port, 10)),
+		}}
+	}
+	cfg.Host, cfg.Port = "", 0
+	return true
+}
+
+// 是否为Unix套接字地址
+func isUnixAddress(addr string) bool {
+	return strings.HasPrefix(addr, unixAddressPrefix)
+}
+
+// 获取TCP监听地址的端口
+func listenerPort(addr string) int64 {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.ParseInt(port, 10, 64)
+	return n
+}
+
+// 校验监听和策略配置
+func validateListenersConfig(cfg *Config) error {
+	if len(cfg.Listeners) == 0 {
+		return &configValidationError{"listeners", "至少需要配置一个监听"}
+	}
+	names := map[string]bool{}
+	addrs := map[string]bool{}
+	for _, l := range cfg.Listeners {
+		if l.Name == "" || names[l.Name] {
+			return &configValidationError{"listeners", fmt.Sprintf("监听名称无效或重复: %q", l.Name)}
+		}
+		names[l.Name] = true
+
+		if isUnixAddress(l.Address) {
+			if strings.TrimPrefix(l.Address, unixAddressPrefix) == "" {
+				return &configValidationError{"listeners", fmt.Sprintf("监听 %s 的套接字路径不能为空", l.Name)}
+			}
+		} else if port := listenerPort(l.Address); port <= 0 || port > 65535 {
+			return &configValidationError{"listeners", fmt.Sprintf("监听 %s 的地址无效: %s", l.Name, l.Address)}
+		}
+		if addrs[l.Address] {
+			return &configValidationError{"listeners", fmt.Sprintf("监听地址重复: %s", l.Address)}
+		}
+		addrs[l.Address] = true
+
+		switch l.Mode {
+		case "", listenerModeServer, listenerModeForward:
+		default:
+			return &configValidationError{"listeners", fmt.Sprintf("监听 %s 的模式无效: %s", l.Name, l.Mode)}
+		}
+
+		if _, ok := cfg.Policies[l.Policy]; l.Policy != "" && !ok {
+			return &configValidationError{"listeners", fmt.Sprintf("监听 %s 使用的策略 %s 不存在", l.Name, l.Policy)}
+		}
+	}
+
+	for name, policy := range cfg.Policies {
+		field := "policies." + name
+		if policy.SizeLimit < 0 {
+			return &configValidationError{field + ".sizeLimit", "不能为负数"}
+		}
+		for _, list := range [][]string{policy.WhiteList, policy.BlackList, policy.OtherWhiteList, policy.OtherBlackList, policy.TunnelHosts} {
+			for _, item := range list {
+				if strings.TrimSpace(item) == "" {
+					return &configValidationError{field, "名单中不能包含空项"}
+				}
+			}
+		}
+		for _, rule := range policy.Rules {
+			if !isKnownRule(rule) || rule == defaultRuleName {
+				return &configValidationError{field + ".rules", fmt.Sprintf("未知的规则名称: %s", rule)}
+			}
+		}
+		for _, route := range policy.Routes {
+			if !containsString(policyRoutes, route) {
+				return &configValidationError{field + ".routes", fmt.Sprintf("未知的路由: %s，可选: %s", route, strings.Join(policyRoutes, "、"))}
+			}
+		}
+		ids := map[string]bool{}
+		for _, key := range policy.APIKeys {
+			if key.ID == "" || ids[key.ID] {
+				return &configValidationError{field + ".apiKeys", fmt.Sprintf("密钥ID无效或重复: %q", key.ID)}
+			}
+			ids[key.ID] = true
+			if key.Key == "" {
+				return &configValidationError{field + ".apiKeys", fmt.Sprintf("密钥 %s 的值不能为空", key.ID)}
+			}
+		}
+	}
+	return nil
+}
+
+// 计算监听生效的策略
+func listenerPolicy(cfg *Config, listenerName string) requestPolicy {
+	policy := requestPolicy{
+		WhiteList:      cfg.WhiteList,
+		BlackList:      cfg.BlackList,
+		AllowProxyAll:  cfg.AllowProxyAll,
+		OtherWhiteList: cfg.OtherWhiteList,
+		OtherBlackList: cfg.OtherBlackList,
+		SizeLimit:      cfg.SizeLimit,
+		TunnelHosts:    cfg.TunnelHosts,
+	}
+
+	var profile PolicyConfig
+	for _, l := range cfg.Listeners {
+		if l.Name == listenerName {
+			profile = cfg.Policies[l.Policy]
+			break
+		}
+	}
+	if len(profile.WhiteList) > 0 {
+		policy.WhiteList = profile.WhiteList
+	}
+	if len(profile.BlackList) > 0 {
+		policy.BlackList = profile.BlackList
+	}
+	if profile.AllowProxyAll != nil {
+		policy.AllowProxyAll = *profile.AllowProxyAll
+	}
+	if len(profile.OtherWhiteList) > 0 {
+		policy.OtherWhiteList = profile.OtherWhiteList
+	}
+	if len(profile.OtherBlackList) > 0 {
+		policy.OtherBlackList = profile.OtherBlackList
+	}
+	if profile.SizeLimit > 0 {
+		policy.SizeLimit = profile.SizeLimit
+	}
+	if len(profile.TunnelHosts) > 0 {
+		policy.TunnelHosts = profile.TunnelHosts
+	}
+	policy.Rules = profile.Rules
+	policy.Routes = profile.Routes
+	policy.APIKeys = profile.APIKeys
+	return policy
+}
+
+// 获取请求所属监听生效的策略
+func policyFromContext(ctx context.Context) requestPolicy {
+	name, _ := ctx.Value(listenerContextKey{}).(string)
+
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return listenerPolicy(config, name)
+}
+
+// 策略是否启用了路由
+func (p requestPolicy) routeEnabled(route string) bool {
+	return len(p.Routes) == 0 || containsString(p.Routes, route)
+}
+
+// 策略是否允许代理该规则的地址
+func (p requestPolicy) ruleAllowed(rule string) bool {
+	return len(p.Rules) == 0 || containsString(p.Rules, rule)
+}
+
+// 策略是否按仓库或URL规则限制代理的地址
+// 隧道内容经过加密，无法检查访问的仓库和路径，此时不允许建立隧道
+func (p requestPolicy) filtersRepos() bool {
+	if len(p.BlackList) > 0 || len(p.Rules) > 0 {
+		return true
+	}
+	return len(p.WhiteList) > 0 && !containsString(p.WhiteList, "*")
+}
+
+// 请求路径所属的路由
+func requestRoute(path string) string {
+	switch {
+	case path == "/api/admin" || strings.HasPrefix(path, "/api/admin/") || isDashboardPath(path):
+		return routeAdmin
+	case path == "/api" || strings.HasPrefix(path, "/api/") || path == metricsPath:
+		return routeAPI
+	}
+	return routeProxy
+}
+
+// 按监听策略限制可访问的路由，并对代理请求进行认证
+func policyMiddleware(c *gin.Context) {
+	policy := policyFromContext(c.Request.Context())
+	route := requestRoute(c.Request.URL.Path)
+	if !policy.routeEnabled(route) {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if route == routeProxy && len(policy.APIKeys) > 0 {
+		id, ok := authenticateAPIKey(c.Request, policy.APIKeys)
+		if !ok {
+			recordBlocked(blockedAuth)
+			// 正向代理使用Proxy-Authorization认证
+			if isForwardProxyRequest(c.Request.Context()) {
+				c.Header("Proxy-Authenticate", `Basic realm="FastCode"`)
+				c.String(http.StatusProxyAuthRequired, "需要提供有效的访问密钥")
+			} else {
+				c.Header("WWW-Authenticate", `Basic realm="FastCode"`)
+				c.String(http.StatusUnauthorized, "需要提供有效的访问密钥")
+			}
+			c.Abort()
+			return
+		}
+		c.Set(apiKeyIDKey, id)
+	}
+	c.Next()
+}
+
+// 校验请求中的访问密钥，支持X-FastCode-Key请求头、Bearer令牌和Basic认证（用户名或密码为密钥），
+// 正向代理还支持Proxy-Authorization中的Basic认证
+// 用于认证的请求头不会发送给上游
+func authenticateAPIKey(req *http.Request, keys []APIKeyConfig) (string, bool) {
+	type candidate struct {
+		value  string
+		header string
+	}
+	var candidates []candidate
+	if value := req.Header.Get(apiKeyHeader); value != "" {
+		candidates = append(candidates, candidate{value, apiKeyHeader})
+	}
+	if token, found := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); found {
+		candidates = append(candidates, candidate{token, "Authorization"})
+	}
+	if username, password, ok := req.BasicAuth(); ok {
+		candidates = append(candidates, candidate{password, "Authorization"}, candidate{username, "Authorization"})
+	}
+	if username, password, ok := proxyBasicAuth(req); ok {
+		candidates = append(candidates, candidate{password, "Proxy-Authorization"}, candidate{username, "Proxy-Authorization"})
+	}
+
+	for _, c := range candidates {
+		if c.value == "" {
+			continue
+		}
+		for _, key := range keys {
+			if subtle.ConstantTimeCompare([]byte(c.value), []byte(key.Key)) == 1 {
+				req.Header.Del(c.header)
+				return key.ID, true
+			}
+		}
+	}
+	return "", false
+}
+
+// 监听地址，Unix套接字删除残留的套接字文件后再监听
+func listenAddress(addr string) (net.Listener, error) {
+	if !isUnixAddress(addr) {
+		return net.Listen("tcp", addr)
+	}
+	path := strings.TrimPrefix(addr, unixAddressPrefix)
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// 平滑重启时新进程继续使用同一个套接字文件，关闭监听时不删除
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	return listener, nil
+}
+
+// 按配置启动所有监听
+func startListeners(handler http.Handler) {
+	configLock.RLock()
+	listenerConfigs := config.Listeners
+	tlsConfig := config.TLS
+	configLock.RUnlock()
+
+	// 所有TCP监听共用同一份证书
+	var serverTLSConfig *tls.Config
+	if tlsConfig.Enabled {
+		var err error
+		serverTLSConfig, err = newTLSConfig(tlsConfig)
+		if err != nil {
+			logError("初始化HTTPS失败", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	httpsPort := int64(0)
+	httpsHost := ""
+	for _, l := range listenerConfigs {
+		name := l.Name
+		listenerHandler := handler
+		if l.Mode == listenerModeForward {
+			listenerHandler = forwardProxyHandler(handler)
+		}
+		server := &http.Server{
+			Addr:    l.Address,
+			Handler: listenerHandler,
+			BaseContext: func(net.Listener) context.Context {
+				return context.WithValue(context.Background(), listenerContextKey{}, name)
+			},
+		}
+		applyServerTimeouts(server)
+
+		// Unix套接字通常由本机的反向代理访问，正向代理需要处理CONNECT，均使用HTTP
+		useTLS := serverTLSConfig != nil && !isUnixAddress(l.Address) && l.Mode != listenerModeForward
+		if useTLS {
+			server.TLSConfig = serverTLSConfig
+			if httpsPort == 0 {
+				httpsHost, _, _ = net.SplitHostPort(l.Address)
+				httpsPort = listenerPort(l.Address)
+			}
+			logInfo("监听启动成功", "listener", name, "address", "https://"+l.Address)
+		} else {
+			logInfo("监听启动成功", "listener", name, "address", l.Address)
+		}
+		startServer(server, useTLS)
+	}
+
+	if tlsConfig.RedirectHTTP && httpsPort != 0 {
+		startHTTPSRedirect(httpsHost, tlsConfig.RedirectPort, httpsPort)
+	}
+}
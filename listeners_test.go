@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var testAPIKeys = []APIKeyConfig{{ID: "ci", Key: "key-ci"}, {ID: "dev", Key: "key-dev"}}
+
+func basicAuthValue(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		wantID  string
+		wantOK  bool
+		removed bool
+	}{
+		{"专用请求头", apiKeyHeader, "key-ci", "ci", true, true},
+		{"Bearer令牌", "Authorization", "Bearer key-dev", "dev", true, true},
+		{"Basic认证密码", "Authorization", basicAuthValue("git", "key-ci"), "ci", true, true},
+		{"Basic认证用户名", "Authorization", basicAuthValue("key-dev", ""), "dev", true, true},
+		{"Proxy-Authorization", "Proxy-Authorization", basicAuthValue("user", "key-ci"), "ci", true, true},
+		{"错误的密钥", apiKeyHeader, "key-other", "", false, false},
+		{"错误的Bearer令牌", "Authorization", "Bearer key-other", "", false, false},
+		{"密钥前缀", apiKeyHeader, "key-c", "", false, false},
+		{"Basic认证用户名和密码为空", "Authorization", basicAuthValue("", ""), "", false, false},
+		{"Proxy-Authorization格式无效", "Proxy-Authorization", "Basic !!!", "", false, false},
+		{"没有密钥", "", "", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/https://github.com/owner/repo/archive/main.zip", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			id, ok := authenticateAPIKey(req, testAPIKeys)
+			if id != tt.wantID || ok != tt.wantOK {
+				t.Errorf("authenticateAPIKey() = %q, %v, want %q, %v", id, ok, tt.wantID, tt.wantOK)
+			}
+			// 通过认证的请求头不发送给上游，未通过时保留
+			if tt.header != "" && (req.Header.Get(tt.header) == "") != tt.removed {
+				t.Errorf("%s 请求头是否删除 = %v, want %v", tt.header, req.Header.Get(tt.header) == "", tt.removed)
+			}
+		})
+	}
+}
+
+func TestAuthenticateAPIKeyKeepsOtherHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(apiKeyHeader, "key-ci")
+	req.Header.Set("Authorization", "Bearer upstream-token")
+	if _, ok := authenticateAPIKey(req, testAPIKeys); !ok {
+		t.Fatal("应通过认证")
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer upstream-token" {
+		t.Errorf("未用于认证的Authorization不应删除，got %q", got)
+	}
+}
+
+// 使用指定的监听策略处理请求
+func servePolicyRequest(t *testing.T, cfg *Config, listenerName string, forward bool, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	setTestConfig(t, cfg)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(policyMiddleware)
+	router.NoRoute(func(c *gin.Context) {
+		c.String(http.StatusOK, "ok %s", c.GetString(apiKeyIDKey))
+	})
+
+	ctx := context.WithValue(req.Context(), listenerContextKey{}, listenerName)
+	if forward {
+		ctx = context.WithValue(ctx, forwardProxyContextKey{}, true)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req.WithContext(ctx))
+	return w
+}
+
+func TestPolicyMiddleware(t *testing.T) {
+	cfg := testConfig()
+	cfg.Listeners = []ListenerConfig{
+		{Name: "public", Address: ":8080", Policy: "public"},
+		{Name: "internal", Address: ":8081"},
+		{Name: "forward", Address: ":8082", Policy: "public", Mode: listenerModeForward},
+	}
+	cfg.Policies = map[string]PolicyConfig{
+		"public": {Routes: []string{routeProxy, routeAPI}, APIKeys: testAPIKeys},
+	}
+
+	tests := []struct {
+		name       string
+		listener   string
+		forward    bool
+		path       string
+		header     string
+		value      string
+		wantStatus int
+		wantBody   string
+		wantHeader string
+	}{
+		{"没有密钥", "public", false, "/https://github.com/a/b", "", "", http.StatusUnauthorized, "", "WWW-Authenticate"},
+		{"错误的密钥", "public", false, "/https://github.com/a/b", apiKeyHeader, "wrong", http.StatusUnauthorized, "", "WWW-Authenticate"},
+		{"正确的密钥", "public", false, "/https://github.com/a/b", apiKeyHeader, "key-ci", http.StatusOK, "ok ci", ""},
+		{"正向代理没有密钥", "forward", true, "/https://github.com/a/b", "", "", http.StatusProxyAuthRequired, "", "Proxy-Authenticate"},
+		{"正向代理使用Proxy-Authorization", "forward", true, "/https://github.com/a/b", "Proxy-Authorization", basicAuthValue("u", "key-dev"), http.StatusOK, "ok dev", ""},
+		{"公开接口不需要密钥", "public", false, "/api/health", "", "", http.StatusOK, "ok ", ""},
+		{"未启用的管理接口", "public", false, "/api/admin/config", "", "", http.StatusNotFound, "", ""},
+		{"没有策略的监听不需要密钥", "internal", false, "/https://github.com/a/b", "", "", http.StatusOK, "ok ", ""},
+		{"没有策略的监听启用管理接口", "internal", false, "/api/admin/config", "", "", http.StatusOK, "ok ", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := servePolicyRequest(t, cloneConfig(cfg), tt.listener, tt.forward, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if tt.wantHeader != "" && w.Header().Get(tt.wantHeader) == "" {
+				t.Errorf("缺少 %s 响应头", tt.wantHeader)
+			}
+		})
+	}
+}
+
+func TestListenerPolicy(t *testing.T) {
+	allow := true
+	cfg := testConfig()
+	cfg.WhiteList = []string{"global/*"}
+	cfg.SizeLimit = 100
+	cfg.Listeners = []ListenerConfig{
+		{Name: "public", Address: ":8080", Policy: "public"},
+		{Name: "internal", Address: ":8081"},
+	}
+	cfg.Policies = map[string]PolicyConfig{
+		"public": {WhiteList: []string{"public/*"}, AllowProxyAll: &allow, Rules: []string{"github"}, TunnelHosts: []string{"github.com"}},
+	}
+
+	tests := []struct {
+		listener string
+		want     requestPolicy
+	}{
+		{"public", requestPolicy{
+			WhiteList: []string{"public/*"}, BlackList: cfg.BlackList, AllowProxyAll: true,
+			OtherWhiteList: cfg.OtherWhiteList, OtherBlackList: cfg.OtherBlackList, SizeLimit: 100,
+			Rules: []string{"github"}, TunnelHosts: []string{"github.com"},
+		}},
+		{"internal", requestPolicy{
+			WhiteList: []string{"global/*"}, BlackList: cfg.BlackList, AllowProxyAll: cfg.AllowProxyAll,
+			OtherWhiteList: cfg.OtherWhiteList, OtherBlackList: cfg.OtherBlackList, SizeLimit: 100,
+			TunnelHosts: cfg.TunnelHosts,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.listener, func(t *testing.T) {
+			if got := listenerPolicy(cfg, tt.listener); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listenerPolicy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestRoute(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/https://github.com/a/b", routeProxy},
+		{"/", routeProxy},
+		{"/apis", routeProxy},
+		{"/api", routeAPI},
+		{"/api/health", routeAPI},
+		{metricsPath, routeAPI},
+		{"/api/admin", routeAdmin},
+		{"/api/admin/config", routeAdmin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := requestRoute(tt.path); got != tt.want {
+				t.Errorf("requestRoute(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// 日志级别
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+// 日志级别名称，与配置中的取值一致
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+func (l logLevel) String() string {
+	return logLevelNames[l]
+}
+
+// 解析日志级别
+func parseLogLevel(name string) (logLevel, bool) {
+	for i, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return logLevel(i), true
+		}
+	}
+	return levelInfo, false
+}
+
+const (
+	// 日志格式
+	logFormatText = "text"
+	logFormatJSON = "json"
+
+	// 日志输出位置
+	logOutputStdout = "stdout"
+	logOutputFile   = "file"
+	logOutputSyslog = "syslog"
+
+	// 文本格式的时间格式
+	logTimeFormat = "2006-01-02 15:04:05.000"
+	// 轮转后的日志文件名中的时间格式
+	logRotateTimeFormat = "20060102-150405"
+)
+
+// 日志输出位置
+type logWriter interface {
+	writeLog(level logLevel, line []byte) error
+	Close() error
+}
+
+// 标准输出
+type stdoutWriter struct{}
+
+func (stdoutWriter) writeLog(level logLevel, line []byte) error {
+	_, err := os.Stdout.Write(line)
+	return err
+}
+
+func (stdoutWriter) Close() error {
+	return nil
+}
+
+// 日志记录器
+type logger struct {
+	mu     sync.Mutex
+	level  logLevel
+	format string
+	writer logWriter
+	config LogConfig
+}
+
+// 配置加载前使用标准输出和文本格式
+var defaultLogger = &logger{level: levelInfo, format: logFormatText, writer: stdoutWriter{}}
+
+// 按配置更新日志记录器，创建输出失败时保留当前输出
+func refreshLogger(cfg *Config) {
+	logCfg := cfg.Log
+
+	defaultLogger.mu.Lock()
+	unchanged := reflect.DeepEqual(defaultLogger.config, logCfg) && defaultLogger.writer != nil
+	defaultLogger.mu.Unlock()
+	if unchanged {
+		return
+	}
+
+	writer, err := newLogWriter(logCfg)
+	if err != nil {
+		logError("创建日志输出失败，继续使用当前输出", "output", logCfg.Output, "error", err)
+		return
+	}
+	level, _ := parseLogLevel(logCfg.Level)
+
+	defaultLogger.mu.Lock()
+	oldWriter := defaultLogger.writer
+	defaultLogger.level = level
+	defaultLogger.format = logCfg.Format
+	defaultLogger.writer = writer
+	defaultLogger.config = logCfg
+	defaultLogger.mu.Unlock()
+
+	if oldWriter != nil {
+		oldWriter.Close()
+	}
+}
+
+// 按配置创建日志输出
+func newLogWriter(cfg LogConfig) (logWriter, error) {
+	switch cfg.Output {
+	case logOutputFile:
+		return openRotatingFile(cfg.File, cfg.MaxSize*1024*1024, cfg.MaxAge)
+	case logOutputSyslog:
+		return newSyslogWriter(cfg.SyslogTag)
+	}
+	return stdoutWriter{}, nil
+}
+
+// 填充日志配置的默认值
+func fillLogDefaults(log *LogConfig) bool {
+	defaults := defaultConfig.Log
+	// 旧配置文件中没有日志配置段时整体使用默认配置
+	if *log == (LogConfig{}) {
+		*log = defaults
+		return true
+	}
+	updated := false
+	if log.Level == "" {
+		log.Level = defaults.Level
+		updated = true
+	}
+	if log.Format == "" {
+		log.Format = defaults.Format
+		updated = true
+	}
+	if log.Output == "" {
+		log.Output = defaults.Output
+		updated = true
+	}
+	if log.File == "" {
+		log.File = defaults.File
+		updated = true
+	}
+	if log.SyslogTag == "" {
+		log.SyslogTag = defaults.SyslogTag
+		updated = true
+	}
+	return updated
+}
+
+// 校验日志配置
+func validateLogConfig(cfg *Config) error {
+	if _, ok := parseLogLevel(cfg.Log.Level); !ok {
+		return &configValidationError{"log.level", fmt.Sprintf("不支持的日志级别: %s", cfg.Log.Level)}
+	}
+	switch cfg.Log.Format {
+	case logFormatText, logFormatJSON:
+	default:
+		return &configValidationError{"log.format", fmt.Sprintf("不支持的日志格式: %s", cfg.Log.Format)}
+	}
+	switch cfg.Log.Output {
+	case logOutputStdout, logOutputFile:
+	case logOutputSyslog:
+		if !syslogSupported {
+			return &configValidationError{"log.output", "当前系统不支持syslog"}
+		}
+	default:
+		return &configValidationError{"log.output", fmt.Sprintf("不支持的日志输出: %s", cfg.Log.Output)}
+	}
+	if cfg.Log.Output == logOutputFile && cfg.Log.File == "" {
+		return &configValidationError{"log.file", "日志文件路径不能为空"}
+	}
+	if cfg.Log.MaxSize < 0 {
+		return &configValidationError{"log.maxSize", "日志文件大小不能为负数"}
+	}
+	if cfg.Log.MaxAge < 0 {
+		return &configValidationError{"log.maxAge", "日志保留天数不能为负数"}
+	}
+	return nil
+}
+
+// 记录日志，fields为交替的键和值
+func (l *logger) log(level logLevel, msg string, fields []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if level < l.level {
+		return
+	}
+
+	var line []byte
+	if l.format == logFormatJSON {
+		line = formatJSONLog(time.Now(), level, msg, fields)
+	} else {
+		line = formatTextLog(time.Now(), level, msg, fields)
+	}
+	if err := l.writer.writeLog(level, line); err != nil {
+		// 日志输出失败时写到标准错误，避免丢失
+		os.Stderr.Write(line)
+	}
+}
+
+func logDebug(msg string, fields ...interface{}) {
+	defaultLogger.log(levelDebug, msg, fields)
+}
+
+func logInfo(msg string, fields ...interface{}) {
+	defaultLogger.log(levelInfo, msg, fields)
+}
+
+func logWarn(msg string, fields ...interface{}) {
+	defaultLogger.log(levelWarn, msg, fields)
+}
+
+func logError(msg string, fields ...interface{}) {
+	defaultLogger.log(levelError, msg, fields)
+}
+
+// 字段值转换为可输出的形式
+func logValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return value
+}
+
+// 文本格式：时间 级别 消息 key=value ...
+func formatTextLog(t time.Time, level logLevel, msg string, fields []interface{}) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(t.Format(logTimeFormat))
+	buf.WriteByte(' ')
+	fmt.Fprintf(&buf, "%-5s", strings.ToUpper(level.String()))
+	buf.WriteByte(' ')
+	buf.WriteString(msg)
+	for i := 0; i < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+		var value interface{} = "<缺少值>"
+		if i+1 < len(fields) {
+			value = logValue(fields[i+1])
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(quoteLogValue(fmt.Sprint(value)))
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// 包含空白、引号或等号的值加上引号
+func quoteLogValue(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) || r == '"' || r == '=' || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// JSON格式，字段按记录时的顺序输出
+func formatJSONLog(t time.Time, level logLevel, msg string, fields []interface{}) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	writeJSONValue(&buf, t.Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeJSONValue(&buf, level.String())
+	buf.WriteString(`,"msg":`)
+	writeJSONValue(&buf, msg)
+	for i := 0; i < len(fields); i += 2 {
+		var value interface{} = "<缺少值>"
+		if i+1 < len(fields) {
+			value = logValue(fields[i+1])
+		}
+		buf.WriteByte(',')
+		writeJSONValue(&buf, fmt.Sprint(fields[i]))
+		buf.WriteByte(':')
+		writeJSONValue(&buf, value)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// 写入JSON值，无法序列化时写入其字符串形式
+func writeJSONValue(buf *bytes.Buffer, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(data)
+}
+
+// 按大小轮转、按时间清理的日志文件
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64 // 字节，0表示不按大小轮转
+	maxAge  int64 // 天，0表示不清理轮转后的文件
+	file    *os.File
+	size    int64
+}
+
+// 打开日志文件，目录不存在时自动创建
+func openRotatingFile(path string, maxSize, maxAge int64) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	go f.removeExpired()
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *rotatingFile) writeLog(level logLevel, line []byte) error {
+	_, err := f.Write(line)
+	return err
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, errors.New("日志文件已关闭")
+	}
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// 将当前文件重命名为带时间的文件并打开新文件
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+	rotated := rotatedLogName(f.path, time.Now())
+	if err := os.Rename(f.path, rotated); err != nil {
+		// 重命名失败时继续写入原文件
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	go f.removeExpired()
+	return nil
+}
+
+// 轮转后的文件名，同一秒内多次轮转时加上序号，避免覆盖之前的文件
+func rotatedLogName(path string, t time.Time) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext) + "-" + t.Format(logRotateTimeFormat)
+	name := base + ext
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(name); err != nil {
+			return name
+		}
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+}
+
+// 删除超过保留天数的轮转文件
+func (f *rotatingFile) removeExpired() {
+	if f.maxAge <= 0 {
+		return
+	}
+	ext := filepath.Ext(f.path)
+	pattern := strings.TrimSuffix(f.path, ext) + "-*" + ext
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-time.Duration(f.maxAge) * 24 * time.Hour)
+	for _, name := range matches {
+		if info, err := os.Stat(name); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(name)
+		}
+	}
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
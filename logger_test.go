@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   logLevel
+		wantOK bool
+	}{
+		{"debug", levelDebug, true},
+		{"WARN", levelWarn, true},
+		{"error", levelError, true},
+		{"trace", levelInfo, false},
+		{"", levelInfo, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseLogLevel(tt.name)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseLogLevel(%q) = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestFormatLog(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	tests := []struct {
+		name     string
+		level    logLevel
+		fields   []interface{}
+		wantText string
+		wantJSON string
+	}{
+		{
+			name:     "没有字段",
+			level:    levelInfo,
+			wantText: "2024-01-02 03:04:05.006 INFO  测试\n",
+			wantJSON: `{"time":"2024-01-02T03:04:05.006Z","level":"info","msg":"测试"}` + "\n",
+		},
+		{
+			name:     "字段按顺序输出",
+			level:    levelWarn,
+			fields:   []interface{}{"url", "/a/b", "status", 502, "delay", time.Second},
+			wantText: "2024-01-02 03:04:05.006 WARN  测试 url=/a/b status=502 delay=1s\n",
+			wantJSON: `{"time":"2024-01-02T03:04:05.006Z","level":"warn","msg":"测试","url":"/a/b","status":502,"delay":"1s"}` + "\n",
+		},
+		{
+			name:     "需要加引号的值",
+			level:    levelError,
+			fields:   []interface{}{"error", errors.New("a b"), "empty", "", "query", "a=b", "line", "a\nlevel=INFO"},
+			wantText: `2024-01-02 03:04:05.006 ERROR 测试 error="a b" empty="" query="a=b" line="a\nlevel=INFO"` + "\n",
+			wantJSON: `{"time":"2024-01-02T03:04:05.006Z","level":"error","msg":"测试","error":"a b","empty":"","query":"a=b","line":"a\nlevel=INFO"}` + "\n",
+		},
+		{
+			name:     "缺少值",
+			level:    levelDebug,
+			fields:   []interface{}{"key"},
+			wantText: "2024-01-02 03:04:05.006 DEBUG 测试 key=<缺少值>\n",
+			wantJSON: `{"time":"2024-01-02T03:04:05.006Z","level":"debug","msg":"测试","key":"\u003c缺少值\u003e"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(formatTextLog(now, tt.level, "测试", tt.fields)); got != tt.wantText {
+				t.Errorf("formatTextLog() = %q, want %q", got, tt.wantText)
+			}
+			if got := string(formatJSONLog(now, tt.level, "测试", tt.fields)); got != tt.wantJSON {
+				t.Errorf("formatJSONLog() = %q, want %q", got, tt.wantJSON)
+			}
+		})
+	}
+}
+
+func TestRotatedLogName(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)
+	tests := []struct {
+		name     string
+		existing []string
+		want     string
+	}{
+		{"没有同名文件", nil, "fastcode-20240102-030405.log"},
+		{"同一秒内第二次轮转", []string{"fastcode-20240102-030405.log"}, "fastcode-20240102-030405-1.log"},
+		{"同一秒内第三次轮转", []string{"fastcode-20240102-030405.log", "fastcode-20240102-030405-1.log"}, "fastcode-20240102-030405-2.log"},
+		{"其他时间的文件不影响", []string{"fastcode-20240102-030404.log"}, "fastcode-20240102-030405.log"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.existing {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := rotatedLogName(filepath.Join(dir, "fastcode.log"), now); got != filepath.Join(dir, tt.want) {
+				t.Errorf("rotatedLogName() = %q, want %q", filepath.Base(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestRotatingFileKeepsAllLines(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fastcode.log")
+	f, err := openRotatingFile(path, 16, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 每行都会触发一次轮转，同一秒内的轮转不能覆盖之前的文件
+	var want []string
+	for i := 0; i < 5; i++ {
+		line := fmt.Sprintf("log line %d\n", i)
+		want = append(want, line)
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+
+	files, err := filepath.Glob(filepath.Join(dir, "fastcode*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(want) {
+		t.Fatalf("日志文件数量 = %d, want %d: %v", len(files), len(want), files)
+	}
+	var got []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(data))
+	}
+	sort.Strings(got)
+	if strings.Join(got, "") != strings.Join(want, "") {
+		t.Errorf("日志内容 = %q, want %q", got, want)
+	}
+}
@@ -36,11 +36,18 @@ func main() {
 	// 暂停一下，确保输出能被看到
 	// time.Sleep(500 * time.Millisecond)
 
+	// 初始化配置
+	initConfig()
+
 	// 初始化HTTP客户端
 	initHTTPClient()
 
-	// 初始化配置
-	initConfig()
+	// 加载使用统计并定期写入文件
+	initStats()
+	go autoFlushStats()
+
+	// 定期上报链路追踪数据
+	go autoExportTraces()
 
 	// 初始化静态资源
 	initStaticFiles()
@@ -48,19 +55,50 @@ func main() {
 	// 检查更新
 	go autoCheckUpdate()
 
+	// 定期检查备用上游的健康状态
+	go autoCheckUpstreams()
+
+	// 定期执行就绪检查
+	go autoCheckHealth()
+
+	// 启用后定期上报匿名使用统计
+	go autoReportTelemetry()
+
+	// 定期探测各域名连接最快的IP
+	go autoProbeHosts()
+
 	// 设置Gin模式
 	gin.SetMode(gin.ReleaseMode)
-	router := gin.Default()
-	var err error
+	// 不使用Gin默认的请求日志，代理请求写入访问日志
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	// 为每个请求分配请求ID
+	router.Use(requestIDMiddleware)
+
+	// 配置可信代理和客户端真实IP
+	initClientIP(router)
+
+	// 统计代理请求的监控指标
+	router.Use(metricsMiddleware)
+
+	// 按监听策略限制路由和认证
+	router.Use(policyMiddleware)
 
 	// 初始化API路由
 	initAPIRoutes(router)
 
+	// 初始化管理API路由
+	initAdminRoutes(router)
+
+	// 初始化控制台路由
+	initDashboardRoutes(router)
+
 	// 配置静态文件服务
 	// 获取可执行文件路径
 	execPath, err := os.Executable()
 	if err != nil {
-		printfWithTime("获取可执行文件路径失败: %v\n", err)
+		logError("获取可执行文件路径失败", "error", err)
 		// 失败时使用当前目录作为备选
 		execPath = "."
 	}
@@ -69,11 +107,11 @@ func main() {
 
 	// 1. 首先尝试使用本地文件系统（如果public目录存在）
 	if _, err := os.Stat(publicDir); err == nil {
-		printlnWithTime("使用本地文件系统提供静态资源")
+		logInfo("使用本地文件系统提供静态资源", "dir", publicDir)
 		// 使用中间件处理静态文件，避免与API路由冲突
 		router.Use(func(c *gin.Context) {
-			// 如果是API请求，跳过静态文件处理
-			if strings.HasPrefix(c.Request.URL.Path, "/api") {
+			// 如果是API请求或控制台页面，跳过静态文件处理
+			if strings.HasPrefix(c.Request.URL.Path, "/api") || isDashboardPath(c.Request.URL.Path) {
 				c.Next()
 				return
 			}
@@ -92,14 +130,14 @@ func main() {
 		// 2. 否则使用嵌入的文件系统
 		subFS, err := fs.Sub(embeddedPublic, "public")
 		if err != nil {
-			printfWithTime("无法创建子文件系统: %v\n", err)
+			logError("无法创建子文件系统", "error", err)
 			// 3. 如果嵌入的文件系统也失败，使用默认处理
 		} else {
-			printlnWithTime("使用嵌入的文件系统提供静态资源")
+			logInfo("使用嵌入的文件系统提供静态资源")
 			// 使用中间件处理静态文件，避免与API路由冲突
 			router.Use(func(c *gin.Context) {
-				// 如果是API请求，跳过静态文件处理
-				if strings.HasPrefix(c.Request.URL.Path, "/api") {
+				// 如果是API请求或控制台页面，跳过静态文件处理
+				if strings.HasPrefix(c.Request.URL.Path, "/api") || isDashboardPath(c.Request.URL.Path) {
 					c.Next()
 					return
 				}
@@ -121,12 +159,14 @@ func main() {
 	// 处理所有未匹配的路由（代理请求）
 	router.NoRoute(handler)
 
-	// 启动服务器
-	addr := fmt.Sprintf("%s:%d", config.Host, config.Port)
-	printfWithTime("服务器启动成功，监听地址: %s\n", addr)
-	err = router.Run(addr)
-	if err != nil {
-		printfWithTime("服务器启动失败: %v\n", err)
-		os.Exit(1)
-	}
+	// 按配置启动所有监听
+	startListeners(router)
+
+	// 收到SIGTERM/SIGINT后优雅关闭，收到SIGUSR2后平滑重启
+	waitForShutdown()
+
+	// 退出前写入未保存的使用统计
+	flushStats()
+	// 上报剩余的链路追踪数据
+	flushTraces()
 }
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 监控指标的路径，属于api路由
+	metricsPath = "/metrics"
+	// 请求匹配的URL规则在Gin上下文中的键
+	ruleKey = "rule"
+	// 请求体计数器在Gin上下文中的键
+	requestBodyKey = "requestBody"
+	// 未匹配任何规则的请求（如被拒绝的无效地址）使用的规则标签
+	noRuleLabel = "none"
+	// CONNECT隧道使用的规则标签
+	tunnelRuleLabel = "tunnel"
+)
+
+// 请求被拒绝的原因
+const (
+	blockedWhiteList = "whitelist"
+	blockedBlackList = "blacklist"
+	blockedSizeLimit = "size_limit"
+	blockedRule      = "rule"
+	blockedNotProxy  = "not_allowed"
+	blockedAuth      = "auth"
+	blockedTunnel    = "tunnel"
+)
+
+// 耗时直方图的分桶（秒）
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// 按标签值区分的计数器
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: map[string]float64{}}
+}
+
+func (v *counterVec) add(delta float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	v.mu.Lock()
+	v.values[key] += delta
+	v.mu.Unlock()
+}
+
+func (v *counterVec) inc(labelValues ...string) {
+	v.add(1, labelValues...)
+}
+
+// 按指定位置的标签值汇总
+func (v *counterVec) sumBy(index int) map[string]float64 {
+	result := map[string]float64{}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for key, value := range v.values {
+		labelValues := strings.Split(key, "\xff")
+		if index < len(labelValues) {
+			result[labelValues[index]] += value
+		}
+	}
+	return result
+}
+
+// 所有标签值的合计
+func (v *counterVec) total() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var sum float64
+	for _, value := range v.values {
+		sum += value
+	}
+	return sum
+}
+
+func (v *counterVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", v.name, v.help, v.name)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, key := range sortedKeys(v.values) {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, key, ""), formatValue(v.values[key]))
+	}
+}
+
+// 按标签值区分的直方图
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+type histogramValue struct {
+	counts []uint64 // 各分桶的累计数量
+	count  uint64
+	sum    float64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, values: map[string]*histogramValue{}}
+}
+
+func (v *histogramVec) observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	h, ok := v.values[key]
+	if !ok {
+		h = &histogramValue{counts: make([]uint64, len(v.buckets))}
+		v.values[key] = h
+	}
+	for i, bound := range v.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+func (v *histogramVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", v.name, v.help, v.name)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		h := v.values[key]
+		for i, bound := range v.buckets {
+			le := `le="` + formatValue(bound) + `"`
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(v.labels, key, le), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(v.labels, key, `le="+Inf"`), h.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, formatLabels(v.labels, key, ""), formatValue(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, formatLabels(v.labels, key, ""), h.count)
+	}
+}
+
+// 排序后的键，使输出顺序稳定
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 生成标签部分，如 {rule="raw",code="200"}
+func formatLabels(names []string, key, extra string) string {
+	var pairs []string
+	if len(names) > 0 {
+		values := strings.Split(key, "\xff")
+		for i, name := range names {
+			value := ""
+			if i < len(values) {
+				value = values[i]
+			}
+			pairs = append(pairs, name+`="`+escapeLabelValue(value)+`"`)
+		}
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// 转义标签值中的反斜杠、双引号和换行
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	requestsTotal = newCounterVec("fastcode_requests_total",
+		"代理请求数，按匹配的URL规则和响应状态码区分", "rule", "code")
+	requestBytesTotal = newCounterVec("fastcode_request_bytes_total",
+		"从客户端接收的请求体字节数", "rule")
+	responseBytesTotal = newCounterVec("fastcode_response_bytes_total",
+		"发送给客户端的响应体字节数", "rule")
+	blockedTotal = newCounterVec("fastcode_blocked_requests_total",
+		"被拒绝的请求数，按原因区分", "reason")
+	configReloadsTotal = newCounterVec("fastcode_config_reloads_total",
+		"配置加载次数，按来源和结果区分", "source", "result")
+	upstreamLatency = newHistogramVec("fastcode_upstream_latency_seconds",
+		"从发送上游请求到收到响应头的耗时，包含重试和切换上游", latencyBuckets, "rule")
+	timeToFirstByte = newHistogramVec("fastcode_time_to_first_byte_seconds",
+		"从开始代理请求到开始返回响应体的耗时", latencyBuckets, "rule")
+
+	// 最近一次成功加载配置的时间
+	configLastReloadSuccess int64
+)
+
+// 记录被拒绝的请求
+func recordBlocked(reason string) {
+	blockedTotal.inc(reason)
+}
+
+// 记录配置加载结果，同时更新就绪检查中的配置状态
+func recordConfigReload(source string, err error) {
+	result := "failure"
+	if err == nil {
+		result = "success"
+		atomic.StoreInt64(&configLastReloadSuccess, time.Now().Unix())
+	}
+	configReloadsTotal.inc(source, result)
+
+	// 管理API的修改未通过校验时不影响正在使用的配置
+	if err == nil || source == "file" {
+		recordHealthCheck(healthCheckConfig, "", 0, err)
+	}
+}
+
+// 统计读取的请求体字节数
+type countingReader struct {
+	io.ReadCloser
+	count int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddInt64(&r.count, int64(n))
+	return n, err
+}
+
+// 已读取的请求体字节数
+func requestBodyBytes(c *gin.Context) int64 {
+	if body, ok := c.Value(requestBodyKey).(*countingReader); ok {
+		return atomic.LoadInt64(&body.count)
+	}
+	return 0
+}
+
+// 统计代理请求的数量、状态码和流量，只统计代理路由的请求
+func metricsMiddleware(c *gin.Context) {
+	if requestRoute(c.Request.URL.Path) != routeProxy {
+		c.Next()
+		return
+	}
+
+	body := &countingReader{ReadCloser: c.Request.Body}
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		c.Request.Body = body
+	}
+	c.Set(requestBodyKey, body)
+
+	c.Next()
+
+	// 静态文件不算作代理请求
+	rule := c.GetString(ruleKey)
+	if rule == "" {
+		if c.Writer.Status() < http.StatusBadRequest {
+			return
+		}
+		rule = noRuleLabel
+	}
+	requestsTotal.inc(rule, strconv.Itoa(c.Writer.Status()))
+	requestBytesTotal.add(float64(requestBodyBytes(c)), rule)
+	if size := c.Writer.Size(); size > 0 {
+		responseBytesTotal.add(float64(size), rule)
+	}
+}
+
+// 记录首次写入响应体的时间
+type firstByteWriter struct {
+	compressWriter
+	once  sync.Once
+	start time.Time
+	rule  string
+}
+
+func (w *firstByteWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() {
+		timeToFirstByte.observe(time.Since(w.start).Seconds(), w.rule)
+	})
+	return w.compressWriter.Write(p)
+}
+
+// 输出Prometheus文本格式的监控指标
+func getMetrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w := c.Writer
+	w.WriteHeader(http.StatusOK)
+
+	requestsTotal.write(w)
+	requestBytesTotal.write(w)
+	responseBytesTotal.write(w)
+	blockedTotal.write(w)
+	upstreamLatency.write(w)
+	timeToFirstByte.write(w)
+	configReloadsTotal.write(w)
+
+	fmt.Fprintf(w, "# HELP fastcode_active_transfers 进行中的代理传输数\n# TYPE fastcode_active_transfers gauge\n")
+	fmt.Fprintf(w, "fastcode_active_transfers %d\n", atomic.LoadInt64(&activeTransfers))
+	fmt.Fprintf(w, "# HELP fastcode_config_last_reload_success_timestamp_seconds 最近一次成功加载配置的时间\n# TYPE fastcode_config_last_reload_success_timestamp_seconds gauge\n")
+	fmt.Fprintf(w, "fastcode_config_last_reload_success_timestamp_seconds %d\n", atomic.LoadInt64(&configLastReloadSuccess))
+	fmt.Fprintf(w, "# HELP fastcode_build_info 程序版本信息\n# TYPE fastcode_build_info gauge\n")
+	fmt.Fprintf(w, "fastcode_build_info{version=\"%s\",commit=\"%s\"} 1\n", escapeLabelValue(version), escapeLabelValue(commit))
+}
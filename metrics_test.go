@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCounterVec(t *testing.T) {
+	v := newCounterVec("test_requests_total", "测试计数器", "rule", "code")
+	v.inc("raw", "200")
+	v.inc("raw", "200")
+	v.add(3, "raw", "404")
+	v.inc("release", "200")
+
+	if got := v.total(); got != 6 {
+		t.Errorf("total() = %v, want 6", got)
+	}
+	if got := v.sumBy(0); got["raw"] != 5 || got["release"] != 1 {
+		t.Errorf("sumBy(0) = %v", got)
+	}
+	if got := v.sumBy(1); got["200"] != 3 || got["404"] != 3 {
+		t.Errorf("sumBy(1) = %v", got)
+	}
+
+	var buf strings.Builder
+	v.write(&buf)
+	want := `# HELP test_requests_total 测试计数器
+# TYPE test_requests_total counter
+test_requests_total{rule="raw",code="200"} 2
+test_requests_total{rule="raw",code="404"} 3
+test_requests_total{rule="release",code="200"} 1
+`
+	if buf.String() != want {
+		t.Errorf("write() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	v := newHistogramVec("test_latency_seconds", "测试直方图", []float64{0.1, 1}, "rule")
+	v.observe(0.05, "raw")
+	v.observe(0.5, "raw")
+	v.observe(2, "raw")
+
+	var buf strings.Builder
+	v.write(&buf)
+	want := `# HELP test_latency_seconds 测试直方图
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{rule="raw",le="0.1"} 1
+test_latency_seconds_bucket{rule="raw",le="1"} 2
+test_latency_seconds_bucket{rule="raw",le="+Inf"} 3
+test_latency_seconds_sum{rule="raw"} 2.55
+test_latency_seconds_count{rule="raw"} 3
+`
+	if buf.String() != want {
+		t.Errorf("write() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		key   string
+		extra string
+		want  string
+	}{
+		{"没有标签", nil, "", "", ""},
+		{"只有附加标签", nil, "", `le="1"`, `{le="1"}`},
+		{"多个标签", []string{"rule", "code"}, "raw\xff200", "", `{rule="raw",code="200"}`},
+		{"缺少标签值", []string{"rule", "code"}, "raw", "", `{rule="raw",code=""}`},
+		{"转义", []string{"reason"}, "a\"b\\c\nd", "", `{reason="a\"b\\c\nd"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatLabels(tt.names, tt.key, tt.extra); got != tt.want {
+				t.Errorf("formatLabels() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{0, "0"},
+		{1, "1"},
+		{0.005, "0.005"},
+		{1234567, "1.234567e+06"},
+		{math.Inf(1), "+Inf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := formatValue(tt.value); got != tt.want {
+				t.Errorf("formatValue(%v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 原始地址的上游名称
+	originUpstreamName = "origin"
+	// 记录所选上游的响应头
+	upstreamHeader = "X-FastCode-Upstream"
+
+	// 健康检查间隔
+	upstreamCheckInterval = 30 * time.Second
+	// 健康检查超时时间
+	upstreamCheckTimeout = 10 * time.Second
+	// 上游超过此时间未被使用时停止健康检查
+	upstreamStateTTL = time.Hour
+	// 尚未测得延迟时使用的延迟
+	defaultUpstreamLatency = 500 * time.Millisecond
+)
+
+// 可选的上游
+type upstreamTarget struct {
+	name  string
+	url   string
+	probe string // 健康检查地址
+}
+
+// 上游健康状态
+type upstreamState struct {
+	name      string
+	rule      string
+	probe     string
+	healthy   bool
+	latency   time.Duration
+	lastError string
+	lastCheck time.Time
+	lastUsed  time.Time
+}
+
+var (
+	// 上游健康状态，键为健康检查地址
+	upstreamStates     = map[string]*upstreamState{}
+	upstreamStatesLock sync.Mutex
+)
+
+// 生成请求的候选上游，规则未配置备用上游时只有原始地址
+func upstreamTargets(rule string, targetURL string) []upstreamTarget {
+	configLock.RLock()
+	mirrors := ruleConfig(config, rule).Mirrors
+	configLock.RUnlock()
+
+	if len(mirrors) == 0 {
+		return []upstreamTarget{{name: originUpstreamName, url: targetURL}}
+	}
+
+	target, err := url.Parse(targetURL)
+	if err != nil {
+		return []upstreamTarget{{name: originUpstreamName, url: targetURL}}
+	}
+
+	targets := []upstreamTarget{{
+		name:  originUpstreamName,
+		url:   targetURL,
+		probe: target.Scheme + "://" + target.Host + "/",
+	}}
+	for _, mirror := range mirrors {
+		probe := mirror.HealthCheck
+		if probe == "" {
+			probe = mirrorRoot(mirror.URL)
+		}
+		targets = append(targets, upstreamTarget{
+			name:  mirror.Name,
+			url:   expandMirrorURL(mirror.URL, target),
+			probe: probe,
+		})
+	}
+
+	// 登记上游，由后台定期检查健康状态
+	upstreamStatesLock.Lock()
+	now := time.Now()
+	for _, t := range targets {
+		state, ok := upstreamStates[t.probe]
+		if !ok {
+			state = &upstreamState{name: t.name, rule: rule, probe: t.probe, healthy: true}
+			upstreamStates[t.probe] = state
+		}
+		state.lastUsed = now
+	}
+	upstreamStatesLock.Unlock()
+
+	return orderTargets(targets)
+}
+
+// 替换URL模板中的占位符
+func expandMirrorURL(template string, target *url.URL) string {
+	replacer := strings.NewReplacer(
+		"{url}", target.String(),
+		"{host}", target.Host,
+		"{path}", strings.TrimPrefix(target.RequestURI(), "/"),
+	)
+	return replacer.Replace(template)
+}
+
+// 获取URL模板的根路径
+func mirrorRoot(template string) string {
+	u, err := url.Parse(expandMirrorURL(template, &url.URL{}))
+	if err != nil {
+		return template
+	}
+	return u.Scheme + "://" + u.Host + "/"
+}
+
+// 按健康状态和延迟排列候选上游：健康的上游按延迟加权随机排序，不健康的上游排在最后
+func orderTargets(targets []upstreamTarget) []upstreamTarget {
+	type candidate struct {
+		target  upstreamTarget
+		healthy bool
+		weight  float64
+	}
+
+	upstreamStatesLock.Lock()
+	candidates := make([]candidate, 0, len(targets))
+	for _, t := range targets {
+		healthy, latency := true, defaultUpstreamLatency
+		if state, ok := upstreamStates[t.probe]; ok {
+			healthy = state.healthy
+			if state.latency > 0 {
+				latency = state.latency
+			}
+		}
+		candidates = append(candidates, candidate{t, healthy, 1 / latency.Seconds()})
+	}
+	upstreamStatesLock.Unlock()
+
+	ordered := make([]upstreamTarget, 0, len(targets))
+	var unhealthy []upstreamTarget
+	var healthy []candidate
+	for _, c := range candidates {
+		if c.healthy {
+			healthy = append(healthy, c)
+		} else {
+			unhealthy = append(unhealthy, c.target)
+		}
+	}
+
+	// 延迟越低被选中的概率越高
+	for len(healthy) > 0 {
+		total := 0.0
+		for _, c := range healthy {
+			total += c.weight
+		}
+		pick := rand.Float64() * total
+		i := 0
+		for ; i < len(healthy)-1; i++ {
+			pick -= healthy[i].weight
+			if pick < 0 {
+				break
+			}
+		}
+		ordered = append(ordered, healthy[i].target)
+		healthy = append(healthy[:i], healthy[i+1:]...)
+	}
+	return append(ordered, unhealthy...)
+}
+
+// 记录上游请求结果
+func recordUpstreamResult(probe string, latency time.Duration, err error) {
+	if probe == "" {
+		return
+	}
+
+	upstreamStatesLock.Lock()
+	defer upstreamStatesLock.Unlock()
+
+	state, ok := upstreamStates[probe]
+	if !ok {
+		return
+	}
+	state.lastCheck = time.Now()
+	if err != nil {
+		state.healthy = false
+		state.lastError = err.Error()
+		return
+	}
+	state.healthy = true
+	state.lastError = ""
+	// 使用指数加权平均平滑延迟
+	if state.latency == 0 {
+		state.latency = latency
+	} else {
+		state.latency = (state.latency*7 + latency*3) / 10
+	}
+}
+
+// 依次尝试候选上游，失败时切换到下一个上游
+// 非幂等请求的请求体无法重放，只尝试第一个上游
+func doWithFailover(req *http.Request, targets []upstreamTarget) (*http.Response, upstreamTarget, error) {
+	if !isIdempotent(req.Method) {
+		targets = targets[:1]
+	}
+
+	var lastErr error
+	for i, target := range targets {
+		targetURL, err := url.Parse(target.url)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		upstreamReq := req.Clone(req.Context())
+		upstreamReq.URL = targetURL
+		upstreamReq.Host = ""
+
+		start := time.Now()
+		resp, err := doWithRetry(upstreamReq)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			recordUpstreamResult(target.probe, time.Since(start), nil)
+			if !mirrorMissing(target, resp) || i == len(targets)-1 {
+				return resp, target, nil
+			}
+			// 备用上游可能尚未同步该文件，上游本身是健康的，切换到下一个上游
+			resp.Body.Close()
+			logWarn("备用上游没有该文件，切换到下一个上游", requestLogFields(req.Context(), "upstream", target.name, "status", resp.StatusCode)...)
+			lastErr = fmt.Errorf("上游返回状态码 %d", resp.StatusCode)
+			continue
+		}
+		if req.Context().Err() != nil {
+			return resp, target, err
+		}
+
+		failure := err
+		if failure == nil {
+			failure = fmt.Errorf("上游返回状态码 %d", resp.StatusCode)
+		}
+		recordUpstreamResult(target.probe, 0, failure)
+
+		// 最后一个上游的结果直接返回，5xx响应原样转发给客户端
+		if i == len(targets)-1 {
+			return resp, target, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		logWarn("上游请求失败，切换到下一个上游", requestLogFields(req.Context(), "upstream", target.name, "error", failure)...)
+		lastErr = failure
+	}
+	return nil, upstreamTarget{}, lastErr
+}
+
+// 判断备用上游是否没有请求的文件，源站的404/410原样返回给客户端
+func mirrorMissing(target upstreamTarget, resp *http.Response) bool {
+	if target.name == originUpstreamName {
+		return false
+	}
+	return resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone
+}
+
+// 定期检查已登记上游的健康状态
+func autoCheckUpstreams() {
+	ticker := time.NewTicker(upstreamCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		checkUpstreams()
+	}
+}
+
+// 检查所有上游的健康状态
+func checkUpstreams() {
+	upstreamStatesLock.Lock()
+	var states []upstreamState
+	for probe, state := range upstreamStates {
+		if time.Since(state.lastUsed) > upstreamStateTTL {
+			delete(upstreamStates, probe)
+			continue
+		}
+		states = append(states, *state)
+	}
+	upstreamStatesLock.Unlock()
+
+	var wg sync.WaitGroup
+	for _, state := range states {
+		wg.Add(1)
+		go func(state upstreamState) {
+			defer wg.Done()
+			latency, err := probeUpstream(state.rule, state.probe)
+			recordUpstreamResult(state.probe, latency, err)
+		}(state)
+	}
+	wg.Wait()
+}
+
+// 探测上游，返回响应延迟
+func probeUpstream(rule, probe string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(withRule(context.Background(), rule), upstreamCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, probe, nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := currentHTTPClient().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return 0, fmt.Errorf("健康检查返回状态码 %d", resp.StatusCode)
+	}
+	return time.Since(start), nil
+}
+
+// 校验备用上游配置
+func validateMirrorsConfig(cfg *Config) error {
+	for ruleName, rule := range cfg.Rules {
+		names := map[string]bool{originUpstreamName: true}
+		field := "rules." + ruleName + ".mirrors"
+		for _, mirror := range rule.Mirrors {
+			if mirror.Name == "" || names[mirror.Name] {
+				return &configValidationError{field, fmt.Sprintf("备用上游名称无效或重复: %q", mirror.Name)}
+			}
+			names[mirror.Name] = true
+
+			u, err := url.Parse(expandMirrorURL(mirror.URL, &url.URL{}))
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return &configValidationError{field, fmt.Sprintf("备用上游 %s 的URL模板无效: %s", mirror.Name, mirror.URL)}
+			}
+			if mirror.HealthCheck != "" {
+				if u, err := url.Parse(mirror.HealthCheck); err != nil || u.Host == "" {
+					return &configValidationError{field, fmt.Sprintf("备用上游 %s 的健康检查地址无效: %s", mirror.Name, mirror.HealthCheck)}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// 查看上游健康状态
+func getUpstreams(c *gin.Context) {
+	upstreamStatesLock.Lock()
+	result := make([]gin.H, 0, len(upstreamStates))
+	for _, state := range upstreamStates {
+		result = append(result, gin.H{
+			"name":      state.name,
+			"rule":      state.rule,
+			"probe":     state.probe,
+			"healthy":   state.healthy,
+			"latencyMs": state.latency.Milliseconds(),
+			"lastError": state.lastError,
+			"lastCheck": state.lastCheck,
+		})
+	}
+	upstreamStatesLock.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i]["probe"].(string) < result[j]["probe"].(string)
+	})
+	c.JSON(http.StatusOK, result)
+}
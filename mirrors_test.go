@@ -0,0 +1,258 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// 在测试期间使用独立的上游健康状态
+func resetUpstreamStates(t *testing.T) {
+	t.Helper()
+	upstreamStatesLock.Lock()
+	oldStates := upstreamStates
+	upstreamStates = map[string]*upstreamState{}
+	upstreamStatesLock.Unlock()
+	t.Cleanup(func() {
+		upstreamStatesLock.Lock()
+		upstreamStates = oldStates
+		upstreamStatesLock.Unlock()
+	})
+}
+
+func TestExpandMirrorURL(t *testing.T) {
+	target, _ := url.Parse("https://github.com/owner/repo/releases/download/v1/app.zip?raw=1")
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"https://mirror.example.com/{url}", "https://mirror.example.com/https://github.com/owner/repo/releases/download/v1/app.zip?raw=1"},
+		{"https://mirror.example.com/{host}/{path}", "https://mirror.example.com/github.com/owner/repo/releases/download/v1/app.zip?raw=1"},
+		{"https://mirror.example.com/static", "https://mirror.example.com/static"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			if got := expandMirrorURL(tt.template, target); got != tt.want {
+				t.Errorf("expandMirrorURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMirrorRoot(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"https://mirror.example.com/{url}", "https://mirror.example.com/"},
+		{"http://mirror.example.com:8080/gh/{path}", "http://mirror.example.com:8080/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			if got := mirrorRoot(tt.template); got != tt.want {
+				t.Errorf("mirrorRoot() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateMirrorsConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		mirrors []MirrorConfig
+		wantErr bool
+	}{
+		{"有效配置", []MirrorConfig{{Name: "a", URL: "https://a.example.com/{url}"}, {Name: "b", URL: "http://b.example.com/{path}", HealthCheck: "http://b.example.com/ping"}}, false},
+		{"名称为空", []MirrorConfig{{URL: "https://a.example.com/{url}"}}, true},
+		{"名称重复", []MirrorConfig{{Name: "a", URL: "https://a.example.com/{url}"}, {Name: "a", URL: "https://b.example.com/{url}"}}, true},
+		{"与原始地址同名", []MirrorConfig{{Name: originUpstreamName, URL: "https://a.example.com/{url}"}}, true},
+		{"URL模板不是HTTP地址", []MirrorConfig{{Name: "a", URL: "ftp://a.example.com/{url}"}}, true},
+		{"URL模板缺少主机", []MirrorConfig{{Name: "a", URL: "{url}"}}, true},
+		{"健康检查地址无效", []MirrorConfig{{Name: "a", URL: "https://a.example.com/{url}", HealthCheck: "/ping"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Rules = map[string]RuleConfig{"release": {Mirrors: tt.mirrors}}
+			if err := validateMirrorsConfig(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validateMirrorsConfig() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOrderTargets(t *testing.T) {
+	resetUpstreamStates(t)
+	targets := []upstreamTarget{
+		{name: "down", probe: "https://down.example.com/"},
+		{name: "slow", probe: "https://slow.example.com/"},
+		{name: "fast", probe: "https://fast.example.com/"},
+	}
+	upstreamStates["https://down.example.com/"] = &upstreamState{healthy: false, latency: time.Millisecond}
+	upstreamStates["https://slow.example.com/"] = &upstreamState{healthy: true, latency: time.Second}
+	upstreamStates["https://fast.example.com/"] = &upstreamState{healthy: true, latency: 10 * time.Millisecond}
+
+	// 不健康的上游始终排在最后，延迟低的上游大多数时候排在最前
+	fastFirst := 0
+	for i := 0; i < 200; i++ {
+		ordered := orderTargets(targets)
+		if len(ordered) != 3 || ordered[2].name != "down" {
+			t.Fatalf("orderTargets() = %+v", ordered)
+		}
+		if ordered[0].name == "fast" {
+			fastFirst++
+		}
+	}
+	if fastFirst < 150 {
+		t.Errorf("低延迟上游排在最前的次数 = %d/200", fastFirst)
+	}
+}
+
+func TestRecordUpstreamResult(t *testing.T) {
+	resetUpstreamStates(t)
+	probe := "https://mirror.example.com/"
+	upstreamStates[probe] = &upstreamState{healthy: true}
+
+	recordUpstreamResult(probe, 100*time.Millisecond, nil)
+	if state := upstreamStates[probe]; state.latency != 100*time.Millisecond {
+		t.Errorf("首次记录的延迟 = %v", state.latency)
+	}
+	recordUpstreamResult(probe, 200*time.Millisecond, nil)
+	if state := upstreamStates[probe]; state.latency != 130*time.Millisecond {
+		t.Errorf("加权平均后的延迟 = %v, want 130ms", state.latency)
+	}
+	recordUpstreamResult(probe, 0, io.ErrUnexpectedEOF)
+	if state := upstreamStates[probe]; state.healthy || state.lastError == "" {
+		t.Errorf("失败后应标记为不健康: %+v", state)
+	}
+	recordUpstreamResult(probe, 100*time.Millisecond, nil)
+	if state := upstreamStates[probe]; !state.healthy || state.lastError != "" {
+		t.Errorf("成功后应恢复健康: %+v", state)
+	}
+	// 未登记的上游不记录
+	recordUpstreamResult("https://other.example.com/", time.Millisecond, nil)
+	if _, ok := upstreamStates["https://other.example.com/"]; ok {
+		t.Error("不应登记未使用的上游")
+	}
+}
+
+func TestDoWithFailover(t *testing.T) {
+	resetUpstreamStates(t)
+	cfg := testConfig()
+	cfg.Retry.MaxAttempts = 1
+	setTestConfig(t, cfg)
+	initTestHTTPClient(t)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer working.Close()
+
+	targets := []upstreamTarget{
+		{name: originUpstreamName, url: failing.URL + "/file", probe: failing.URL + "/"},
+		{name: "mirror", url: working.URL + "/file", probe: working.URL + "/"},
+	}
+	for _, target := range targets {
+		upstreamStates[target.probe] = &upstreamState{healthy: true}
+	}
+
+	tests := []struct {
+		method     string
+		wantName   string
+		wantStatus int
+	}{
+		// 幂等请求切换到下一个上游
+		{http.MethodGet, "mirror", http.StatusOK},
+		// 非幂等请求只尝试第一个上游，5xx响应原样返回
+		{http.MethodPost, originUpstreamName, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, targets[0].url, nil)
+			resp, target, err := doWithFailover(req, targets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if target.name != tt.wantName || resp.StatusCode != tt.wantStatus {
+				t.Errorf("doWithFailover() = %s %d, want %s %d", target.name, resp.StatusCode, tt.wantName, tt.wantStatus)
+			}
+		})
+	}
+	if upstreamStates[failing.URL+"/"].healthy {
+		t.Error("失败的上游应标记为不健康")
+	}
+}
+
+func TestDoWithFailoverMirrorMissing(t *testing.T) {
+	resetUpstreamStates(t)
+	cfg := testConfig()
+	cfg.Retry.MaxAttempts = 1
+	setTestConfig(t, cfg)
+	initTestHTTPClient(t)
+
+	missing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer missing.Close()
+	gone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer gone.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer working.Close()
+
+	tests := []struct {
+		name       string
+		targets    []upstreamTarget
+		wantName   string
+		wantStatus int
+	}{
+		{"备用上游404时切换", []upstreamTarget{
+			{name: "mirror", url: missing.URL + "/file", probe: missing.URL + "/"},
+			{name: originUpstreamName, url: working.URL + "/file"},
+		}, originUpstreamName, http.StatusOK},
+		{"备用上游410时切换", []upstreamTarget{
+			{name: "mirror", url: gone.URL + "/file", probe: gone.URL + "/"},
+			{name: originUpstreamName, url: working.URL + "/file"},
+		}, originUpstreamName, http.StatusOK},
+		{"源站404原样返回", []upstreamTarget{
+			{name: originUpstreamName, url: missing.URL + "/file"},
+			{name: "mirror", url: working.URL + "/file", probe: working.URL + "/"},
+		}, originUpstreamName, http.StatusNotFound},
+		{"最后一个备用上游404原样返回", []upstreamTarget{
+			{name: "mirror", url: missing.URL + "/file", probe: missing.URL + "/"},
+		}, "mirror", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, target := range tt.targets {
+				if target.probe != "" {
+					upstreamStates[target.probe] = &upstreamState{healthy: true}
+				}
+			}
+			req, _ := http.NewRequest(http.MethodGet, tt.targets[0].url, nil)
+			resp, target, err := doWithFailover(req, tt.targets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if target.name != tt.wantName || resp.StatusCode != tt.wantStatus {
+				t.Errorf("doWithFailover() = %s %d, want %s %d", target.name, resp.StatusCode, tt.wantName, tt.wantStatus)
+			}
+			// 没有文件的备用上游仍然是健康的
+			if state := upstreamStates[tt.targets[0].probe]; state != nil && !state.healthy {
+				t.Error("返回404的备用上游不应标记为不健康")
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	netproxy "golang.org/x/net/proxy"
+)
+
+// 表示直连的出站代理名称
+const directProxyName = "direct"
+
+// 根据请求匹配的规则选择出站代理
+func outboundProxy(req *http.Request) (*url.URL, error) {
+	configLock.RLock()
+	rule := ruleConfig(config, ruleFromContext(req.Context()))
+	outbound := config.Outbound
+	configLock.RUnlock()
+
+	return ruleProxy(rule, outbound, req.URL)
+}
+
+// 获取规则访问该地址使用的出站代理，直连时返回nil
+func ruleProxy(rule RuleConfig, outbound OutboundConfig, u *url.URL) (*url.URL, error) {
+	if rule.Proxy == "" || rule.Proxy == directProxyName {
+		return nil, nil
+	}
+	if bypassProxy(u, outbound.NoProxy) {
+		return nil, nil
+	}
+	for _, p := range outbound.Proxies {
+		if p.Name == rule.Proxy {
+			return url.Parse(p.URL)
+		}
+	}
+	return nil, fmt.Errorf("出站代理 %s 不存在", rule.Proxy)
+}
+
+// 建立隧道到目标地址的连接，与代理请求一样使用default规则的出站代理，并按策略轮换出站本地地址
+func dialTunnel(ctx context.Context, target string) (net.Conn, error) {
+	configLock.RLock()
+	rule := ruleConfig(config, defaultRuleName)
+	outbound := config.Outbound
+	dialTimeout := seconds(config.Timeouts.Dial)
+	configLock.RUnlock()
+
+	proxyURL, err := ruleProxy(rule, outbound, &url.URL{Scheme: "https", Host: target})
+	if err != nil {
+		return nil, err
+	}
+	dial := func(localAddr net.Addr) (net.Conn, error) {
+		dialer := dialWithResolver(&net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second, LocalAddr: localAddr})
+		if proxyURL == nil {
+			return dialer(ctx, "tcp", target)
+		}
+		return dialViaProxy(ctx, dialer, proxyURL, target, dialTimeout)
+	}
+
+	if len(outbound.LocalAddresses) == 0 {
+		return dial(nil)
+	}
+	var lastErr error
+	for _, i := range egressOrder(outbound.LocalAddresses) {
+		addr := outbound.LocalAddresses[i]
+		conn, err := dial(&net.TCPAddr{IP: net.ParseIP(addr)})
+		// 协议族不同时换一个本地地址
+		if errors.Is(err, errAddressFamily) {
+			lastErr = err
+			continue
+		}
+		recordEgressResult(addr, nil, err)
+		return conn, err
+	}
+	return nil, lastErr
+}
+
+// 通过出站代理连接目标地址，HTTP(S)代理使用CONNECT方法，SOCKS5代理由代理解析域名
+func dialViaProxy(ctx context.Context, dial func(ctx context.Context, network, addr string) (net.Conn, error), proxyURL *url.URL, target string, timeout time.Duration) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		defaultPorts := map[string]string{"http": "80", "https": "443", "socks5": "1080"}
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), defaultPorts[proxyURL.Scheme])
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5":
+		var auth *netproxy.Auth
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			auth = &netproxy.Auth{User: proxyURL.User.Username(), Password: password}
+		}
+		dialer, err := netproxy.SOCKS5("tcp", proxyAddr, auth, contextDialer(dial))
+		if err != nil {
+			return nil, err
+		}
+		return dialer.(netproxy.ContextDialer).DialContext(ctx, "tcp", target)
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("出站代理的协议不支持: %s", proxyURL.Scheme)
+	}
+
+	conn, err := dial(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	// 与代理握手的时间计入连接超时
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: target},
+		Host:   target,
+		Header: http.Header{},
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("出站代理拒绝建立隧道: %s", resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+
+	// 代理可能已经发送了目标返回的数据
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// 将拨号函数转换为netproxy.ContextDialer
+type contextDialer func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func (d contextDialer) Dial(network, addr string) (net.Conn, error) {
+	return d(context.Background(), network, addr)
+}
+
+func (d contextDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d(ctx, network, addr)
+}
+
+// 先读取缓冲区中已读到的数据的连接
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// 判断地址是否绕过出站代理，规则与NO_PROXY环境变量一致：
+// * 匹配所有地址，example.com 匹配该域名及其子域名，.example.com 只匹配子域名，
+// 也支持IP、CIDR和带端口的写法
+func bypassProxy(u *url.URL, noProxy []string) bool {
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if port == "" {
+		if u.Scheme == "https" {
+			port = "443"
+		} else {
+			port = "80"
+		}
+	}
+	ip := net.ParseIP(host)
+
+	for _, item := range noProxy {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		if item == "*" {
+			return true
+		}
+		if _, ipNet, err := net.ParseCIDR(item); err == nil {
+			if ip != nil && ipNet.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		// 带端口的写法要求端口一致
+		itemHost, itemPort := item, ""
+		if h, p, err := net.SplitHostPort(item); err == nil {
+			itemHost, itemPort = h, p
+		}
+		if itemPort != "" && itemPort != port {
+			continue
+		}
+		itemHost = strings.Trim(itemHost, "[]")
+
+		if itemIP := net.ParseIP(itemHost); itemIP != nil {
+			if ip != nil && itemIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		if strings.HasPrefix(itemHost, ".") {
+			if strings.HasSuffix(host, itemHost) {
+				return true
+			}
+			continue
+		}
+		if host == itemHost || strings.HasSuffix(host, "."+itemHost) {
+			return true
+		}
+	}
+	return false
+}
+
+// 校验出站连接配置
+func validateOutboundConfig(cfg *Config) error {
+	names := map[string]bool{}
+	for _, p := range cfg.Outbound.Proxies {
+		if p.Name == "" || p.Name == directProxyName {
+			return &configValidationError{"outbound.proxies", fmt.Sprintf("出站代理名称无效: %q", p.Name)}
+		}
+		if names[p.Name] {
+			return &configValidationError{"outbound.proxies", fmt.Sprintf("出站代理名称重复: %s", p.Name)}
+		}
+		names[p.Name] = true
+
+		proxyURL, err := url.Parse(p.URL)
+		if err != nil || proxyURL.Host == "" {
+			return &configValidationError{"outbound.proxies", fmt.Sprintf("出站代理 %s 的地址无效: %s", p.Name, p.URL)}
+		}
+		// socks5://已由代理解析域名，Go 1.22之前的net/http不支持socks5h://
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return &configValidationError{"outbound.proxies", fmt.Sprintf("出站代理 %s 的协议不支持: %s", p.Name, proxyURL.Scheme)}
+		}
+	}
+
+	for name, rule := range cfg.Rules {
+		if !isKnownRule(name) {
+			return &configValidationError{"rules." + name, fmt.Sprintf("未知的规则名称: %s", name)}
+		}
+		if rule.Proxy != "" && rule.Proxy != directProxyName && !names[rule.Proxy] {
+			return &configValidationError{"rules." + name + ".proxy", fmt.Sprintf("出站代理 %s 不存在", rule.Proxy)}
+		}
+	}
+	return validateEgressConfig(cfg)
+}
+
+// 隐藏代理地址中的密码
+func redactProxyURL(rawURL string) string {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil || proxyURL.User == nil {
+		return rawURL
+	}
+	if _, ok := proxyURL.User.Password(); !ok {
+		return rawURL
+	}
+	username := proxyURL.User.String()
+	if i := strings.Index(username, ":"); i >= 0 {
+		username = username[:i]
+	}
+	proxyURL.User = nil
+	return strings.Replace(proxyURL.String(), "//", "//"+username+":"+redactedValue+"@", 1)
+}
+
+// 还原代理地址中未修改的密码
+func restoreProxyURL(rawURL, originalURL string) string {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil || proxyURL.User == nil {
+		return rawURL
+	}
+	if password, ok := proxyURL.User.Password(); !ok || password != redactedValue {
+		return rawURL
+	}
+	original, err := url.Parse(originalURL)
+	if err != nil || original.User == nil {
+		return rawURL
+	}
+	originalPassword, ok := original.User.Password()
+	if !ok {
+		return rawURL
+	}
+	proxyURL.User = url.UserPassword(proxyURL.User.Username(), originalPassword)
+	return proxyURL.String()
+}
+
+// 判断代理地址中的密码是否仍为脱敏占位值
+func proxyURLRedacted(rawURL string) bool {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil || proxyURL.User == nil {
+		return false
+	}
+	password, ok := proxyURL.User.Password()
+	return ok && password == redactedValue
+}
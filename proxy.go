@@ -1,8 +1,8 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
 	"os"
@@ -10,6 +10,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -28,23 +29,95 @@ var (
 		regexp.MustCompile(`^(?:https?://)?github\.com/api/.*$`),
 	}
 
-	httpClient *http.Client
+	// URL匹配规则名称，与exps一一对应
+	ruleNames = []string{
+		"release",
+		"blob",
+		"git",
+		"raw",
+		"gist",
+		"api",
+		"api",
+	}
+
+	httpClient     *http.Client
+	httpClientLock sync.RWMutex
+	// 创建当前HTTP客户端时使用的超时配置和本地地址
+	clientTimeouts   TimeoutsConfig
+	clientLocalAddrs []string
 )
 
+// 非GitHub地址使用的规则名称
+const otherRuleName = "other"
+
 // 初始化HTTP客户端
 func initHTTPClient() {
-	httpClient = &http.Client{
-		Transport: &http.Transport{
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
+	configLock.RLock()
+	timeouts := config.Timeouts
+	localAddrs := config.Outbound.LocalAddresses
+	configLock.RUnlock()
+
+	newTransport := func(localAddr net.Addr) *http.Transport {
+		return &http.Transport{
+			Proxy: outboundProxy,
+			DialContext: dialWithResolver(&net.Dialer{
+				Timeout:   seconds(timeouts.Dial),
 				KeepAlive: 30 * time.Second,
-			}).DialContext,
+				LocalAddr: localAddr,
+			}),
 			MaxIdleConns:          1000,
 			MaxIdleConnsPerHost:   1000,
 			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
+			TLSHandshakeTimeout:   seconds(timeouts.TLSHandshake),
+			ResponseHeaderTimeout: seconds(timeouts.ResponseHeader),
 			ExpectContinueTimeout: 1 * time.Second,
-		},
+		}
+	}
+
+	// 配置了本地地址时按策略轮换使用
+	var transport http.RoundTripper = newTransport(nil)
+	if len(localAddrs) > 0 {
+		transport = newEgressTransport(localAddrs, newTransport)
+	}
+	client := &http.Client{Transport: transport}
+
+	httpClientLock.Lock()
+	oldClient := httpClient
+	httpClient = client
+	clientTimeouts = timeouts
+	clientLocalAddrs = localAddrs
+	httpClientLock.Unlock()
+
+	// 关闭旧客户端的空闲连接，进行中的请求不受影响
+	if oldClient != nil {
+		oldClient.CloseIdleConnections()
+	}
+}
+
+// 获取当前HTTP客户端
+func currentHTTPClient() *http.Client {
+	httpClientLock.RLock()
+	defer httpClientLock.RUnlock()
+	return httpClient
+}
+
+// 超时或本地地址配置变化时重建HTTP客户端
+func refreshHTTPClient(cfg *Config) {
+	httpClientLock.RLock()
+	initialized := httpClient != nil
+	timeoutsChanged := clientTimeouts != cfg.Timeouts
+	localAddrsChanged := strings.Join(clientLocalAddrs, ",") != strings.Join(cfg.Outbound.LocalAddresses, ",")
+	httpClientLock.RUnlock()
+
+	if !initialized || (!timeoutsChanged && !localAddrsChanged) {
+		return
+	}
+	initHTTPClient()
+	if timeoutsChanged {
+		logInfo("上游超时配置已更新")
+	}
+	if localAddrsChanged {
+		logInfo("出站本地地址配置已更新", "addrs", strings.Join(cfg.Outbound.LocalAddresses, ","))
 	}
 }
 
@@ -61,7 +134,7 @@ func handler(c *gin.Context) {
 	// 获取可执行文件路径
 	execPath, err := os.Executable()
 	if err != nil {
-		printfWithTime("获取可执行文件路径失败: %v\n", err)
+		logError("获取可执行文件路径失败", "error", err)
 		// 失败时使用当前目录作为备选
 		execPath = "."
 	}
@@ -89,45 +162,73 @@ func handler(c *gin.Context) {
 		targetURL = "https://" + rawPath
 	}
 
-	// 检查URL是否符合规则
-	matches := checkURL(targetURL)
+	// 记录代理请求的span，请求带有traceparent时加入调用方的追踪
+	ctx, serverSpan := startServerSpan(c.Request, c.Request.Method)
+	if serverSpan != nil {
+		c.Request = c.Request.WithContext(ctx)
+		serverSpan.setAttr("http.request.method", c.Request.Method)
+		serverSpan.setAttr("fastcode.request_id", requestIDFromContext(ctx))
+		serverSpan.setAttr("url.full", redactURL(targetURL))
+		serverSpan.setAttr("client.address", c.ClientIP())
+		serverSpan.setAttr("user_agent.original", c.Request.UserAgent())
+		defer func() {
+			status := c.Writer.Status()
+			serverSpan.setAttr("http.response.status_code", status)
+			if status >= http.StatusInternalServerError {
+				serverSpan.setError(fmt.Errorf("响应状态码 %d", status))
+			}
+			serverSpan.finish()
+		}()
+	}
+
+	// 检查URL是否符合规则，名单和限制使用请求所属监听的策略
+	policy := policyFromContext(c.Request.Context())
+	rule, matches := matchRule(targetURL)
+	c.Set(ruleKey, rule)
+	serverSpan.setAttr("fastcode.rule", rule)
+	if !policy.ruleAllowed(rule) {
+		recordBlocked(blockedRule)
+		respondError(c, http.StatusForbidden, "该类型的地址不允许通过此监听代理")
+		return
+	}
 	if matches == nil {
 		// 检查是否允许代理所有地址
-		configLock.RLock()
-		allowAll := config.AllowProxyAll
-		otherWhiteList := config.OtherWhiteList
-		otherBlackList := config.OtherBlackList
-		configLock.RUnlock()
+		allowAll := policy.AllowProxyAll
+		otherWhiteList := policy.OtherWhiteList
+		otherBlackList := policy.OtherBlackList
 
 		if !allowAll {
-			c.String(http.StatusForbidden, "无效的URL，不允许代理该地址")
+			recordBlocked(blockedNotProxy)
+			respondError(c, http.StatusForbidden, "无效的URL，不允许代理该地址")
 			return
 		}
 
 		// 检查其他地址的白名单和黑名单
 		if len(otherBlackList) > 0 && checkOtherList(targetURL, otherBlackList) {
-			c.String(http.StatusForbidden, "该地址已被列入黑名单")
+			recordBlocked(blockedBlackList)
+			respondError(c, http.StatusForbidden, "该地址已被列入黑名单")
 			return
 		}
 
 		if len(otherWhiteList) > 0 && !checkOtherList(targetURL, otherWhiteList) {
-			c.String(http.StatusForbidden, "该地址未被列入白名单")
+			recordBlocked(blockedWhiteList)
+			respondError(c, http.StatusForbidden, "该地址未被列入白名单")
 			return
 		}
 	} else {
 		// 检查GitHub地址的白名单和黑名单
-		configLock.RLock()
-		whiteList := config.WhiteList
-		blackList := config.BlackList
-		configLock.RUnlock()
+		whiteList := policy.WhiteList
+		blackList := policy.BlackList
 
 		if len(blackList) > 0 && checkList(matches, blackList) {
-			c.String(http.StatusForbidden, "该GitHub地址已被列入黑名单")
+			recordBlocked(blockedBlackList)
+			respondError(c, http.StatusForbidden, "该GitHub地址已被列入黑名单")
 			return
 		}
 
 		if len(whiteList) > 0 && !checkList(matches, whiteList) {
-			c.String(http.StatusForbidden, "该GitHub地址未被列入白名单")
+			recordBlocked(blockedWhiteList)
+			respondError(c, http.StatusForbidden, "该GitHub地址未被列入白名单")
 			return
 		}
 	}
@@ -138,15 +239,52 @@ func handler(c *gin.Context) {
 	}
 
 	// 调用代理函数
-	proxy(c, targetURL)
+	proxy(c, targetURL, rule)
 }
 
 // 代理函数
-func proxy(c *gin.Context, u string) {
+func proxy(c *gin.Context, u string, rule string) {
+	// 记录进行中的传输，关闭服务时等待其完成
+	defer trackTransfer()()
+
+	// 传输结束后写入访问日志
+	entry := newAccessEntry(c, u, rule)
+	defer func() {
+		entry.status = c.Writer.Status()
+		if size := c.Writer.Size(); size > 0 {
+			entry.bytesOut = int64(size)
+		}
+		entry.bytesIn = requestBodyBytes(c)
+		writeAccessLog(entry)
+		recordUsage(u, rule, entry.status, entry.bytesOut)
+	}()
+
+	// 限制单次请求的总时长
+	configLock.RLock()
+	timeout := seconds(ruleConfig(config, rule).Timeout)
+	configLock.RUnlock()
+
+	ctx := withRule(c.Request.Context(), rule)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// 登记进行中的传输，可通过管理API查看和取消
+	ctx, cancelTransfer := context.WithCancel(ctx)
+	defer cancelTransfer()
+	t := registerTransfer(entry, cancelTransfer)
+	defer t.unregister()
+
+	// 上游请求的span，记录DNS解析、建立连接、TLS握手和等待首字节的耗时
+	ctx, upstreamSpan := startSpan(ctx, "upstream", spanKindClient)
+	ctx = withUpstreamTrace(ctx, upstreamSpan)
+
 	// 创建请求
-	req, err := http.NewRequest(c.Request.Method, u, c.Request.Body)
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, u, c.Request.Body)
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("创建请求失败: %v", err))
+		respondError(c, http.StatusInternalServerError, fmt.Sprintf("创建请求失败: %v", err))
 		return
 	}
 
@@ -158,23 +296,49 @@ func proxy(c *gin.Context, u string) {
 	}
 	// 删除Host头，让HTTP客户端自动添加
 	req.Header.Del("Host")
+	// 访问密钥只用于本服务的认证，逐跳请求头不发送给上游
+	req.Header.Del(apiKeyHeader)
+	req.Header.Del("Proxy-Authorization")
+	req.Header.Del("Proxy-Connection")
+	// 统一向上游请求gzip，按客户端支持的编码返回
+	setUpstreamEncoding(req)
+	// 设置转发头
+	setForwardedHeaders(c, req)
+	// 上游以本次请求的span为父span
+	if upstreamSpan != nil {
+		req.Header.Set(traceparentHeader, upstreamSpan.traceparent())
+	}
 
-	// 发送请求
-	resp, err := httpClient.Do(req)
+	// 发送请求，幂等请求失败时自动重试，配置了备用上游时自动切换
+	resp, upstream, err := doWithFailover(req, upstreamTargets(rule, u))
+	entry.upstream = upstream.name
+	entry.upstreamTime = time.Since(entry.start)
+	upstreamLatency.observe(entry.upstreamTime.Seconds(), rule)
+	upstreamSpan.setAttr("url.full", entry.target)
+	upstreamSpan.setAttr("fastcode.upstream", upstream.name)
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("请求GitHub失败: %v", err))
+		upstreamSpan.setError(err)
+		upstreamSpan.finish()
+		spanFromContext(c.Request.Context()).setError(err)
+		if t.isCancelled() {
+			respondError(c, http.StatusServiceUnavailable, "传输已被管理员取消")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, fmt.Sprintf("请求GitHub失败: %v", err))
 		return
 	}
+	entry.upstreamStatus = resp.StatusCode
+	upstreamSpan.setAttr("http.response.status_code", resp.StatusCode)
+	upstreamSpan.finish()
 	defer resp.Body.Close()
 
 	// 检查文件大小
-	configLock.RLock()
-	sizeLimit := config.SizeLimit
-	configLock.RUnlock()
+	sizeLimit := policyFromContext(c.Request.Context()).SizeLimit
 
 	if contentLength, ok := resp.Header["Content-Length"]; ok {
 		if size, err := strconv.ParseInt(contentLength[0], 10, 64); err == nil && size > sizeLimit {
-			c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("文件过大，超过限制大小: %d GB", sizeLimit/(1024*1024*1024)))
+			recordBlocked(blockedSizeLimit)
+			respondError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("文件过大，超过限制大小: %d GB", sizeLimit/(1024*1024*1024)))
 			return
 		}
 	}
@@ -191,8 +355,8 @@ func proxy(c *gin.Context, u string) {
 		}
 	}
 
-	// 处理重定向
-	if location := resp.Header.Get("Location"); location != "" {
+	// 处理重定向，正向代理的客户端直接访问原始地址
+	if location := resp.Header.Get("Location"); location != "" && !isForwardProxyRequest(c.Request.Context()) {
 		if checkURL(location) != nil {
 			// 如果是GitHub地址，重定向到代理地址
 			c.Header("Location", "/"+location)
@@ -202,24 +366,59 @@ func proxy(c *gin.Context, u string) {
 		}
 	}
 
+	// 记录实际使用的上游
+	c.Header(upstreamHeader, upstream.name)
+
+	// 按客户端支持的编码压缩或解压响应体
+	encoder, err := responseEncoder(c, resp)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, fmt.Sprintf("创建压缩写入器失败: %v", err))
+		return
+	}
+	body := &firstByteWriter{compressWriter: encoder, start: entry.start, rule: rule}
+	// 未压缩或解压时响应体大小即为上游的Content-Length
+	size := int64(-1)
+	if c.Writer.Header().Get("Content-Length") != "" {
+		size = resp.ContentLength
+	}
+	t.setResponse(upstream.name, size)
+
 	// 设置响应状态码
 	c.Status(resp.StatusCode)
 
-	// 流式返回响应体
-	_, err = io.Copy(c.Writer, resp.Body)
-	if err != nil {
-		printfWithTime("响应数据复制失败: %v\n", err)
+	// 流式返回响应体，上游连接中断时尝试断点续传
+	// 分别记录等待上游和写入客户端的耗时，区分上游慢和客户端接收慢
+	bodySpan := spanFromContext(c.Request.Context()).child("response body", spanKindInternal)
+	copyStart := time.Now()
+	out := &timedWriter{Writer: t.writer(body)}
+	err = copyResponseBody(out, resp)
+	if closeErr := body.Close(); err == nil {
+		err = closeErr
+	}
+	bodySpan.setAttr("fastcode.response.bytes", int64(c.Writer.Size()))
+	bodySpan.setAttr("fastcode.client_write_ms", out.elapsed.Milliseconds())
+	bodySpan.setAttr("fastcode.upstream_read_ms", (time.Since(copyStart) - out.elapsed).Milliseconds())
+	bodySpan.setError(err)
+	bodySpan.finish()
+	if err != nil && !t.isCancelled() {
+		logWarn("响应数据复制失败", requestLogFields(ctx, "url", u, "error", err)...)
 	}
 }
 
 // 检查URL是否符合GitHub相关规则
 func checkURL(u string) []string {
-	for _, exp := range exps {
+	_, matches := matchRule(u)
+	return matches
+}
+
+// 匹配URL规则，返回规则名称和匹配结果，未匹配时规则名称为other
+func matchRule(u string) (string, []string) {
+	for i, exp := range exps {
 		if matches := exp.FindStringSubmatch(u); matches != nil {
-			return matches[1:]
+			return ruleNames[i], matches[1:]
 		}
 	}
-	return nil
+	return otherRuleName, nil
 }
 
 // 检查白名单/黑名单
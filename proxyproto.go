@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 读取PROXY protocol头的超时时间
+	proxyHeaderTimeout = 10 * time.Second
+	// v1头的最大长度
+	proxyV1MaxLength = 107
+)
+
+// v2头的签名
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// 解析PROXY protocol头的监听
+type proxyProtocolListener struct {
+	net.Listener
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyProtocolConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// 在首次读取或获取地址时解析PROXY protocol头的连接，解析在处理连接的协程中进行，不会阻塞Accept
+type proxyProtocolConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+}
+
+func (c *proxyProtocolConn) init() {
+	c.once.Do(func() {
+		c.remoteAddr = c.Conn.RemoteAddr()
+		// 只接受可信代理发送的头，其他客户端无法伪造地址
+		tcpAddr, ok := c.remoteAddr.(*net.TCPAddr)
+		if !ok || !isTrustedProxy(tcpAddr.IP) {
+			return
+		}
+
+		c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		addr, err := readProxyHeader(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				logWarn("解析PROXY protocol头失败", "peer", c.remoteAddr, "error", err)
+			}
+			c.err = err
+			return
+		}
+		if addr != nil {
+			c.remoteAddr = addr
+		}
+	})
+}
+
+func (c *proxyProtocolConn) Read(p []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.init()
+	return c.remoteAddr
+}
+
+// 读取PROXY protocol头，返回客户端地址；没有头或头中没有地址时返回nil
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	switch first[0] {
+	case 'P':
+		if prefix, err := r.Peek(6); err != nil || string(prefix) != "PROXY " {
+			return nil, nil
+		}
+		return readProxyV1(r)
+	case '\r':
+		if prefix, err := r.Peek(len(proxyV2Signature)); err != nil || !bytes.Equal(prefix, proxyV2Signature) {
+			return nil, nil
+		}
+		return readProxyV2(r)
+	}
+	return nil, nil
+}
+
+// 解析v1文本头，如 "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyV1MaxLength {
+			return nil, errors.New("v1头过长")
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("v1头没有以CRLF结尾")
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("v1头格式无效: %q", strings.TrimSpace(string(line)))
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("v1头中的地址无效: %q", strings.TrimSpace(string(line)))
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// 解析v2二进制头
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("不支持的v2版本: %d", header[12]>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	// LOCAL命令为代理自身的连接（如健康检查），使用连接地址
+	switch header[12] & 0x0f {
+	case 0x0:
+		return nil, nil
+	case 0x1:
+	default:
+		return nil, fmt.Errorf("不支持的v2命令: %d", header[12]&0x0f)
+	}
+
+	switch header[13] >> 4 {
+	case 0x1:
+		if len(payload) < 12 {
+			return nil, errors.New("v2头中的IPv4地址长度不足")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x2:
+		if len(payload) < 36 {
+			return nil, errors.New("v2头中的IPv6地址长度不足")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	}
+	// 其他地址族（如UNIX套接字）使用连接地址
+	return nil, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// 构造v2头，command为0x0（LOCAL）或0x1（PROXY），family为地址族和协议
+func proxyV2Header(command, family byte, payload []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:16], uint16(len(payload)))
+	return append(header, payload...)
+}
+
+// 构造v2头中的地址部分
+func proxyV2Addresses(src, dst net.IP, srcPort, dstPort uint16) []byte {
+	payload := append(append([]byte{}, src...), dst...)
+	ports := make([]byte, 4)
+	binary.BigEndian.PutUint16(ports[0:2], srcPort)
+	binary.BigEndian.PutUint16(ports[2:4], dstPort)
+	return append(payload, ports...)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	const request = "GET / HTTP/1.1\r\n\r\n"
+	ipv4 := proxyV2Addresses(net.ParseIP("192.0.2.1").To4(), net.ParseIP("192.0.2.2").To4(), 56324, 443)
+	ipv6 := proxyV2Addresses(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), 56324, 443)
+
+	tests := []struct {
+		name    string
+		header  []byte
+		want    string
+		wantErr bool
+	}{
+		{"没有头", nil, "", false},
+		{"v1 TCP4", []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"), "192.0.2.1:56324", false},
+		{"v1 TCP6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"), "[2001:db8::1]:56324", false},
+		{"v1 UNKNOWN", []byte("PROXY UNKNOWN\r\n"), "", false},
+		{"v1 缺少字段", []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324\r\n"), "", true},
+		{"v1 协议无效", []byte("PROXY UDP4 192.0.2.1 192.0.2.2 56324 443\r\n"), "", true},
+		{"v1 地址无效", []byte("PROXY TCP4 192.0.2.300 192.0.2.2 56324 443\r\n"), "", true},
+		{"v1 端口无效", []byte("PROXY TCP4 192.0.2.1 192.0.2.2 65536 443\r\n"), "", true},
+		{"v1 没有CRLF", []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\n"), "", true},
+		{"v1 过长", []byte("PROXY TCP4 " + strings.Repeat("1", proxyV1MaxLength) + "\r\n"), "", true},
+		{"v2 IPv4", proxyV2Header(0x1, 0x11, ipv4), "192.0.2.1:56324", false},
+		{"v2 IPv6", proxyV2Header(0x1, 0x21, ipv6), "[2001:db8::1]:56324", false},
+		{"v2 LOCAL", proxyV2Header(0x0, 0x00, nil), "", false},
+		{"v2 UNIX地址族", proxyV2Header(0x1, 0x31, make([]byte, 216)), "", false},
+		{"v2 附加TLV", proxyV2Header(0x1, 0x11, append(ipv4, 0x04, 0x00, 0x01, 0x00)), "192.0.2.1:56324", false},
+		{"v2 IPv4地址长度不足", proxyV2Header(0x1, 0x11, ipv4[:8]), "", true},
+		{"v2 IPv6地址长度不足", proxyV2Header(0x1, 0x21, ipv6[:32]), "", true},
+		{"v2 命令无效", proxyV2Header(0x2, 0x11, ipv4), "", true},
+		{"v2 版本无效", append(append(append([]byte{}, proxyV2Signature...), 0x11, 0x11, 0, 12), ipv4...), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(bytes.NewReader(append(append([]byte{}, tt.header...), request...)))
+			addr, err := readProxyHeader(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("应返回错误，got %v", addr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			if addr != nil {
+				got = addr.String()
+			}
+			if got != tt.want {
+				t.Errorf("readProxyHeader() = %q, want %q", got, tt.want)
+			}
+			// 头之后的数据原样保留
+			if rest, _ := io.ReadAll(r); string(rest) != request {
+				t.Errorf("剩余数据 = %q, want %q", rest, request)
+			}
+		})
+	}
+}
+
+func TestReadProxyHeaderTruncated(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+	}{
+		{"空连接", nil},
+		{"v1 未结束", []byte("PROXY TCP4 192.0.2.1")},
+		{"v2 头不完整", proxyV2Signature},
+		{"v2 地址不完整", proxyV2Header(0x1, 0x11, make([]byte, 12))[:20]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readProxyHeader(bufio.NewReader(bytes.NewReader(tt.header))); err == nil {
+				t.Error("应返回错误")
+			}
+		})
+	}
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	tests := []struct {
+		name     string
+		trusted  []string
+		want     string
+		wantData string
+	}{
+		{"可信代理使用头中的地址", []string{"127.0.0.1"}, "192.0.2.1", "ping"},
+		{"其他客户端忽略头", []string{"192.0.2.0/24"}, "127.0.0.1", "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\nping"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldNets := trustedProxyNets
+			t.Cleanup(func() { trustedProxyNets = oldNets })
+			trustedProxyNets = nil
+			for _, item := range tt.trusted {
+				ipNet, err := parseTrustedProxy(item)
+				if err != nil {
+					t.Fatal(err)
+				}
+				trustedProxyNets = append(trustedProxyNets, ipNet)
+			}
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			go func() {
+				conn, err := net.Dial("tcp", ln.Addr().String())
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				conn.Write([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\nping"))
+			}()
+
+			conn, err := (&proxyProtocolListener{Listener: ln}).Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if got := conn.RemoteAddr().(*net.TCPAddr).IP.String(); got != tt.want {
+				t.Errorf("RemoteAddr() = %s, want %s", got, tt.want)
+			}
+			// 不可信的客户端发送的头作为普通数据交给后续处理
+			if data, _ := io.ReadAll(conn); string(data) != tt.wantData {
+				t.Errorf("读取的数据 = %q, want %q", data, tt.wantData)
+			}
+		})
+	}
+}
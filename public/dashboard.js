@@ -0,0 +1,334 @@
+// 主题切换功能，与首页共用本地存储中的主题
+const themeToggle = document.getElementById('theme-toggle');
+const themeIcon = document.getElementById('theme-icon');
+const html = document.documentElement;
+
+const savedTheme = localStorage.getItem('theme');
+const prefersDark = window.matchMedia('(prefers-color-scheme: dark)').matches;
+const initialTheme = savedTheme || (prefersDark ? 'dark' : 'light');
+html.setAttribute('data-theme', initialTheme);
+updateThemeIcon(initialTheme);
+
+themeToggle.addEventListener('click', () => {
+    const newTheme = html.getAttribute('data-theme') === 'light' ? 'dark' : 'light';
+    html.setAttribute('data-theme', newTheme);
+    localStorage.setItem('theme', newTheme);
+    updateThemeIcon(newTheme);
+});
+
+function updateThemeIcon(theme) {
+    if (theme === 'dark') {
+        themeIcon.innerHTML = '<path d="M12 3a9 9 0 0 0-9 9 9.75 9.75 0 0 0 6.74 9A9.75 9.75 0 0 0 12 21h.75a.75.75 0 0 0 .75-.75v-1.5a.75.75 0 0 0-.75-.75H12a8.25 8.25 0 0 1-8.25-8.25A8.25 8.25 0 0 1 12 4.5h.75a.75.75 0 0 0 .75-.75V2.25a.75.75 0 0 0-.75-.75H12Zm-9 9a9 9 0 0 0 4.5 7.74V18a.75.75 0 0 0-.75-.75H12A9 9 0 0 0 3 12Zm9 0a9 9 0 0 0-4.5-7.74V6a.75.75 0 0 0 .75-.75H12a9 9 0 0 0 9 9Z" fill="currentColor"></path>';
+    } else {
+        themeIcon.innerHTML = '<path d="M12 2.5a9.5 9.5 0 1 0 9.5 9.5A9.51 9.51 0 0 0 12 2.5zm0 17a7.5 7.5 0 1 1 7.5-7.5 7.5 7.5 0 0 1-7.5 7.5z" fill="currentColor"></path>';
+    }
+}
+
+// 刷新间隔（毫秒）
+const refreshInterval = 10000;
+// 当前的流量图表时间粒度
+let trafficInterval = 'hour';
+
+// 拒绝原因的中文名称
+const blockedReasons = {
+    whitelist: '不在白名单',
+    blacklist: '命中黑名单',
+    size_limit: '超过大小限制',
+    rule: '不匹配规则',
+    not_allowed: '不允许代理',
+    auth: '认证失败',
+    tunnel: '隧道被拒绝',
+};
+
+// 请求JSON接口，浏览器会自动带上控制台页面的认证信息
+async function fetchJSON(url) {
+    const resp = await fetch(url, { cache: 'no-store' });
+    if (!resp.ok) {
+        throw new Error(`${url}: ${resp.status}`);
+    }
+    return resp.json();
+}
+
+// 格式化字节数
+function formatBytes(bytes) {
+    const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+    let value = bytes;
+    let i = 0;
+    while (value >= 1024 && i < units.length - 1) {
+        value /= 1024;
+        i++;
+    }
+    return `${value.toFixed(i === 0 ? 0 : 1)} ${units[i]}`;
+}
+
+// 格式化运行时间
+function formatUptime(seconds) {
+    const days = Math.floor(seconds / 86400);
+    const hours = Math.floor(seconds % 86400 / 3600);
+    const minutes = Math.floor(seconds % 3600 / 60);
+    if (days > 0) {
+        return `${days}天${hours}小时`;
+    }
+    if (hours > 0) {
+        return `${hours}小时${minutes}分`;
+    }
+    return `${minutes}分`;
+}
+
+// 创建带文本的元素，文本不作为HTML解析
+function element(tag, text, className) {
+    const el = document.createElement(tag);
+    if (text !== undefined) {
+        el.textContent = text;
+    }
+    if (className) {
+        el.className = className;
+    }
+    return el;
+}
+
+// 表格为空时显示提示
+function renderEmpty(table, colspan) {
+    const row = table.insertRow();
+    const cell = row.appendChild(element('td', '暂无数据', 'empty'));
+    cell.colSpan = colspan;
+}
+
+// 渲染排行表格，每行显示名称和带比例条的数值
+function renderRanking(table, items, label, format) {
+    table.replaceChildren();
+    if (items.length === 0) {
+        renderEmpty(table, 2);
+        return;
+    }
+    const max = Math.max(...items.map(item => item.value), 1);
+    for (const item of items) {
+        const row = table.insertRow();
+        const name = row.appendChild(element('td', label(item), 'name'));
+        name.title = label(item);
+        const meter = row.appendChild(element('td', undefined, 'meter'));
+        const bar = meter.appendChild(element('div', undefined, 'meter-bar'));
+        bar.style.width = `${item.value / max * 100}%`;
+        meter.appendChild(element('span', format(item), 'meter-text'));
+    }
+}
+
+// 渲染流量柱状图
+function renderTraffic(points) {
+    const chart = document.getElementById('traffic-chart');
+    chart.replaceChildren();
+    if (points.length === 0) {
+        chart.appendChild(element('p', '暂无数据', 'empty'));
+        return;
+    }
+
+    const ns = 'http://www.w3.org/2000/svg';
+    const width = 1000;
+    const height = 220;
+    const padding = { top: 10, right: 10, bottom: 24, left: 70 };
+    const plotWidth = width - padding.left - padding.right;
+    const plotHeight = height - padding.top - padding.bottom;
+    const max = Math.max(...points.map(p => p.bytes), 1);
+
+    const svg = document.createElementNS(ns, 'svg');
+    svg.setAttribute('viewBox', `0 0 ${width} ${height}`);
+    svg.setAttribute('preserveAspectRatio', 'none');
+
+    // 纵轴刻度
+    for (let i = 0; i <= 4; i++) {
+        const y = padding.top + plotHeight * (1 - i / 4);
+        const line = document.createElementNS(ns, 'line');
+        line.setAttribute('x1', padding.left);
+        line.setAttribute('x2', width - padding.right);
+        line.setAttribute('y1', y);
+        line.setAttribute('y2', y);
+        line.setAttribute('class', 'grid-line');
+        svg.appendChild(line);
+        const text = document.createElementNS(ns, 'text');
+        text.setAttribute('x', padding.left - 6);
+        text.setAttribute('y', y + 4);
+        text.setAttribute('text-anchor', 'end');
+        text.setAttribute('class', 'axis');
+        text.textContent = formatBytes(max * i / 4);
+        svg.appendChild(text);
+    }
+
+    // 柱子，横轴最多显示约8个时间标签
+    const step = plotWidth / points.length;
+    const labelEvery = Math.ceil(points.length / 8);
+    points.forEach((point, i) => {
+        const start = new Date(point.start);
+        const label = trafficInterval === 'hour'
+            ? `${start.getMonth() + 1}/${start.getDate()} ${start.getHours()}:00`
+            : `${start.getMonth() + 1}/${start.getDate()}`;
+        const barHeight = point.bytes / max * plotHeight;
+        const rect = document.createElementNS(ns, 'rect');
+        rect.setAttribute('x', padding.left + i * step + step * 0.1);
+        rect.setAttribute('y', padding.top + plotHeight - barHeight);
+        rect.setAttribute('width', Math.max(step * 0.8, 1));
+        rect.setAttribute('height', barHeight);
+        rect.setAttribute('class', 'bar-rect');
+        const title = document.createElementNS(ns, 'title');
+        title.textContent = `${label}  ${formatBytes(point.bytes)}，${point.requests} 次请求`;
+        rect.appendChild(title);
+        svg.appendChild(rect);
+
+        if (i % labelEvery === 0) {
+            const text = document.createElementNS(ns, 'text');
+            text.setAttribute('x', padding.left + i * step + step / 2);
+            text.setAttribute('y', height - 6);
+            text.setAttribute('text-anchor', 'middle');
+            text.setAttribute('class', 'axis');
+            text.textContent = label;
+            svg.appendChild(text);
+        }
+    });
+    chart.appendChild(svg);
+}
+
+// 格式化秒数
+function formatDuration(seconds) {
+    if (seconds < 60) {
+        return `${Math.floor(seconds)}秒`;
+    }
+    if (seconds < 3600) {
+        return `${Math.floor(seconds / 60)}分${Math.floor(seconds % 60)}秒`;
+    }
+    return `${Math.floor(seconds / 3600)}小时${Math.floor(seconds % 3600 / 60)}分`;
+}
+
+// 取消进行中的传输
+async function cancelTransfer(id) {
+    if (!confirm(`确定要取消传输 #${id} 吗？`)) {
+        return;
+    }
+    const resp = await fetch(`/api/admin/transfers/${id}`, { method: 'DELETE' });
+    if (!resp.ok && resp.status !== 404) {
+        alert(`取消失败: ${resp.status}`);
+    }
+    refresh();
+}
+
+// 渲染进行中的传输
+function renderTransfers(transfers) {
+    const table = document.getElementById('transfers');
+    table.replaceChildren();
+    const header = table.createTHead().insertRow();
+    for (const title of ['客户端', '地址', '已传输', '速度', '时长', '']) {
+        header.appendChild(element('th', title));
+    }
+    const body = table.createTBody();
+    if (transfers.length === 0) {
+        renderEmpty(body, 6);
+        return;
+    }
+    for (const t of transfers) {
+        const row = body.insertRow();
+        row.appendChild(element('td', t.client));
+        row.appendChild(element('td', t.url)).title = t.url;
+        const progress = t.size > 0 ? `${formatBytes(t.bytes)} / ${formatBytes(t.size)}` : formatBytes(t.bytes);
+        row.appendChild(element('td', progress));
+        row.appendChild(element('td', `${formatBytes(t.bytesPerSecond)}/s`));
+        row.appendChild(element('td', formatDuration(t.duration)));
+        const action = row.appendChild(element('td'));
+        const button = action.appendChild(element('button', '取消', 'cancel-btn'));
+        button.addEventListener('click', () => cancelTransfer(t.id));
+    }
+}
+
+// 渲染进行中的隧道
+function renderTunnels(tunnels) {
+    const table = document.getElementById('tunnels');
+    table.replaceChildren();
+    const header = table.createTHead().insertRow();
+    for (const title of ['客户端', '目标', '开始时间', '上行', '下行']) {
+        header.appendChild(element('th', title));
+    }
+    const body = table.createTBody();
+    if (tunnels.length === 0) {
+        renderEmpty(body, 5);
+        return;
+    }
+    for (const t of tunnels) {
+        const row = body.insertRow();
+        row.appendChild(element('td', t.client));
+        row.appendChild(element('td', t.target));
+        row.appendChild(element('td', new Date(t.start).toLocaleString()));
+        row.appendChild(element('td', formatBytes(t.sent)));
+        row.appendChild(element('td', formatBytes(t.received)));
+    }
+}
+
+// 渲染概览卡片和状态统计
+function renderOverview(overview, stats) {
+    document.getElementById('total-requests').textContent = stats.requests.toLocaleString();
+    document.getElementById('total-bytes').textContent = formatBytes(stats.bytes);
+    document.getElementById('active-transfers').textContent = overview.activeTransfers;
+    document.getElementById('uptime').textContent = formatUptime(overview.uptime);
+
+    const cache = overview.cache;
+    const hitRatio = document.getElementById('cache-hit-ratio');
+    if (cache.enabled && cache.hits + cache.misses > 0) {
+        hitRatio.textContent = `${(cache.hits / (cache.hits + cache.misses) * 100).toFixed(1)}%`;
+    } else {
+        hitRatio.textContent = cache.enabled ? '-' : '未启用';
+    }
+
+    const statusItems = Object.entries(overview.statusClasses)
+        .sort(([a], [b]) => a.localeCompare(b))
+        .map(([name, value]) => ({ name, value }));
+    renderRanking(document.getElementById('status-classes'), statusItems,
+        item => item.name, item => item.value.toLocaleString());
+
+    const blockedItems = Object.entries(overview.blocked)
+        .sort(([, a], [, b]) => b - a)
+        .map(([name, value]) => ({ name: blockedReasons[name] || name, value }));
+    renderRanking(document.getElementById('blocked'), blockedItems,
+        item => item.name, item => item.value.toLocaleString());
+}
+
+// 加载并渲染全部数据
+async function refresh() {
+    const status = document.getElementById('status');
+    try {
+        const [overview, stats, traffic, repos, files, transfers, tunnels] = await Promise.all([
+            fetchJSON('/api/admin/overview'),
+            fetchJSON('/api/admin/stats'),
+            fetchJSON(`/api/admin/stats/traffic?interval=${trafficInterval}`),
+            fetchJSON('/api/admin/stats/repos?days=7&limit=10'),
+            fetchJSON('/api/admin/stats/files?limit=10'),
+            fetchJSON('/api/admin/transfers'),
+            fetchJSON('/api/admin/tunnels'),
+        ]);
+
+        renderOverview(overview, stats);
+        renderTraffic(traffic);
+        renderRanking(document.getElementById('top-repos'),
+            repos.map(r => ({ ...r, value: r.requests })),
+            item => item.repo, item => `${item.requests.toLocaleString()} 次 / ${formatBytes(item.bytes)}`);
+        renderRanking(document.getElementById('top-files'),
+            files.map(f => ({ ...f, value: f.requests })),
+            item => item.file, item => `${item.requests.toLocaleString()} 次 / ${formatBytes(item.bytes)}`);
+        renderTransfers(transfers);
+        renderTunnels(tunnels);
+
+        status.className = 'dashboard-status';
+        status.textContent = `FastCode ${overview.version}，更新于 ${new Date().toLocaleTimeString()}`;
+    } catch (err) {
+        status.className = 'dashboard-status error';
+        status.textContent = `加载失败: ${err.message}`;
+    }
+}
+
+// 切换流量图表的时间粒度
+for (const tab of document.querySelectorAll('.tab')) {
+    tab.addEventListener('click', () => {
+        document.querySelectorAll('.tab').forEach(t => t.classList.remove('active'));
+        tab.classList.add('active');
+        trafficInterval = tab.dataset.interval;
+        refresh();
+    });
+}
+
+refresh();
+setInterval(refresh, refreshInterval);
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 请求ID的请求头和响应头
+	requestIDHeader = "X-Request-ID"
+	// 客户端提供的请求ID的最大长度
+	maxRequestIDLength = 128
+)
+
+type requestIDContextKey struct{}
+
+// 在上下文中记录请求ID
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// 获取上下文中的请求ID
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// 客户端提供的请求ID只允许字母、数字和常见符号，避免注入日志
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-' || r == '_' || r == '.' || r == ':' || r == '@' || r == '+' || r == '=' || r == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// 使用客户端提供的有效请求ID，没有时生成新的
+func newRequestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); validRequestID(id) {
+		return id
+	}
+	return generateUUID()
+}
+
+// 为每个请求分配请求ID，写入响应头并记录到请求的上下文中
+func requestIDMiddleware(c *gin.Context) {
+	id := newRequestID(c.Request)
+	c.Header(requestIDHeader, id)
+	c.Request = c.Request.WithContext(withRequestID(c.Request.Context(), id))
+	c.Next()
+}
+
+// 在日志字段前加上请求ID
+func requestLogFields(ctx context.Context, fields ...interface{}) []interface{} {
+	id := requestIDFromContext(ctx)
+	if id == "" {
+		return fields
+	}
+	return append([]interface{}{"requestId", id}, fields...)
+}
+
+// 返回错误信息并附带请求ID，用户反馈问题时可据此查找日志
+func respondError(c *gin.Context, code int, msg string) {
+	c.String(code, "%s\n请求ID: %s", msg, requestIDFromContext(c.Request.Context()))
+}
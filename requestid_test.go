@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"abc-123", true},
+		{"1f0e7a2c-8d9b-4c3a-9e1f-2b3c4d5e6f70", true},
+		{"trace:span/1+2=3@host_a.b", true},
+		{strings.Repeat("a", maxRequestIDLength), true},
+		{"", false},
+		{strings.Repeat("a", maxRequestIDLength+1), false},
+		{"abc def", false},
+		{"abc\nlevel=ERROR", false},
+		{"abc\r\n", false},
+		{`abc"`, false},
+		{"请求", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if got := validRequestID(tt.id); got != tt.want {
+				t.Errorf("validRequestID(%q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		clientID string
+		keep     bool
+	}{
+		{"使用客户端的请求ID", "client-id-1", true},
+		{"没有请求ID时生成", "", false},
+		{"无效的请求ID重新生成", "bad id\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(requestIDMiddleware)
+			router.GET("/", func(c *gin.Context) {
+				c.String(http.StatusOK, requestIDFromContext(c.Request.Context()))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.clientID != "" {
+				req.Header.Set(requestIDHeader, tt.clientID)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			id := w.Header().Get(requestIDHeader)
+			if !validRequestID(id) {
+				t.Fatalf("响应头中的请求ID无效: %q", id)
+			}
+			if w.Body.String() != id {
+				t.Errorf("上下文中的请求ID = %q, 响应头 = %q", w.Body.String(), id)
+			}
+			if (id == tt.clientID) != tt.keep {
+				t.Errorf("请求ID = %q, 客户端提供 %q", id, tt.clientID)
+			}
+		})
+	}
+}
+
+func TestRequestLogFields(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := requestLogFields(req.Context(), "url", "/"); len(got) != 2 {
+		t.Errorf("没有请求ID时不应添加字段: %v", got)
+	}
+	ctx := withRequestID(req.Context(), "abc")
+	got := requestLogFields(ctx, "url", "/")
+	if len(got) != 4 || got[0] != "requestId" || got[1] != "abc" {
+		t.Errorf("requestLogFields() = %v", got)
+	}
+}
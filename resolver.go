@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DNS服务器的默认端口
+	defaultDNSPort = "53"
+	// 探测单个IP的超时时间
+	resolverProbeTimeout = 5 * time.Second
+	// 域名超过此时间未被使用时停止探测
+	resolverProbeTTL = time.Hour
+	// 延迟在最快IP的此比例以内的IP视为同样快，轮流使用
+	fastIPTolerance = 1.2
+)
+
+// IP探测结果
+type ipProbe struct {
+	reachable bool
+	latency   time.Duration
+}
+
+// 域名的解析结果和探测状态
+type hostEntry struct {
+	ips      []net.IP
+	expires  time.Time // 缓存过期时间，静态解析为零值
+	next     int       // 轮换位置
+	port     string    // 最近一次连接使用的端口，用于探测
+	lastUsed time.Time
+	probes   map[string]ipProbe
+	fastest  string
+}
+
+var (
+	hostEntries  = map[string]*hostEntry{}
+	resolverLock sync.Mutex
+	// 当前缓存对应的解析配置
+	resolverHosts   map[string][]string
+	resolverServers []string
+)
+
+// 使用默认值填充未配置的解析项，返回是否有更新
+func fillResolverDefaults(resolver *ResolverConfig) bool {
+	defaults := defaultConfig.Resolver
+	updated := false
+	if resolver.Hosts == nil {
+		resolver.Hosts = map[string][]string{}
+		updated = true
+	}
+	if resolver.Servers == nil {
+		resolver.Servers = []string{}
+		updated = true
+	}
+	if resolver.CacheTTL <= 0 {
+		resolver.CacheTTL = defaults.CacheTTL
+		updated = true
+	}
+	if resolver.ProbeInterval <= 0 {
+		resolver.ProbeInterval = defaults.ProbeInterval
+		updated = true
+	}
+	return updated
+}
+
+// 校验域名解析配置
+func validateResolverConfig(cfg *Config) error {
+	for host, ips := range cfg.Resolver.Hosts {
+		if host == "" || len(ips) == 0 {
+			return &configValidationError{"resolver.hosts", fmt.Sprintf("静态解析 %q 未配置IP", host)}
+		}
+		for _, ip := range ips {
+			if net.ParseIP(ip) == nil {
+				return &configValidationError{"resolver.hosts", fmt.Sprintf("静态解析 %s 的IP无效: %s", host, ip)}
+			}
+		}
+	}
+	for _, server := range cfg.Resolver.Servers {
+		if _, _, err := parseDNSServer(server); err != nil {
+			return &configValidationError{"resolver.servers", err.Error()}
+		}
+	}
+	if cfg.Resolver.CacheTTL <= 0 {
+		return &configValidationError{"resolver.cacheTTL", "必须大于0"}
+	}
+	if cfg.Resolver.ProbeInterval <= 0 {
+		return &configValidationError{"resolver.probeInterval", "必须大于0"}
+	}
+	return nil
+}
+
+// 解析DNS服务器地址，返回协议和带端口的地址
+func parseDNSServer(server string) (network, addr string, err error) {
+	network, addr = "udp", server
+	if scheme, rest, found := strings.Cut(server, "://"); found {
+		network, addr = scheme, rest
+	}
+	if network != "udp" && network != "tcp" {
+		return "", "", fmt.Errorf("DNS服务器 %s 的协议不支持: %s", server, network)
+	}
+	if _, _, splitErr := net.SplitHostPort(addr); splitErr != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), defaultDNSPort)
+	}
+	if host, _, _ := net.SplitHostPort(addr); host == "" {
+		return "", "", fmt.Errorf("DNS服务器地址无效: %s", server)
+	}
+	return network, addr, nil
+}
+
+// 解析配置变化时清空缓存
+func refreshResolver(cfg *Config) {
+	resolverLock.Lock()
+	defer resolverLock.Unlock()
+
+	if reflect.DeepEqual(resolverHosts, cfg.Resolver.Hosts) && reflect.DeepEqual(resolverServers, cfg.Resolver.Servers) {
+		return
+	}
+	initialized := resolverHosts != nil
+	resolverHosts = cfg.Resolver.Hosts
+	resolverServers = cfg.Resolver.Servers
+	hostEntries = map[string]*hostEntry{}
+	if initialized {
+		logInfo("域名解析配置已更新")
+	}
+}
+
+// 为拨号器加上自定义解析：依次尝试域名的各个IP，优先使用探测到的最快IP
+func dialWithResolver(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			if !matchesLocalAddr(dialer, ip) {
+				return nil, fmt.Errorf("连接 %s 失败: %w", addr, errAddressFamily)
+			}
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		ips, err := lookupHost(ctx, host, port)
+		if err != nil {
+			return nil, err
+		}
+		lastErr := fmt.Errorf("连接 %s 失败: %w", addr, errAddressFamily)
+		for _, ip := range ips {
+			// 绑定本地地址时跳过协议族不同的IP
+			if !matchesLocalAddr(dialer, ip) {
+				continue
+			}
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+			recordIPProbe(host, ip.String(), ipProbe{})
+		}
+		return nil, lastErr
+	}
+}
+
+// 目标IP与拨号器绑定的本地地址是否属于同一协议族
+func matchesLocalAddr(dialer *net.Dialer, ip net.IP) bool {
+	local, ok := dialer.LocalAddr.(*net.TCPAddr)
+	if !ok || local.IP == nil {
+		return true
+	}
+	return (local.IP.To4() == nil) == (ip.To4() == nil)
+}
+
+// 获取域名的IP，按探测结果和轮换位置排序
+func lookupHost(ctx context.Context, host, port string) ([]net.IP, error) {
+	configLock.RLock()
+	resolver := config.Resolver
+	var static []string
+	for name, ips := range resolver.Hosts {
+		if strings.EqualFold(name, host) {
+			static = ips
+			break
+		}
+	}
+	configLock.RUnlock()
+
+	var ips []net.IP
+	if len(static) > 0 {
+		for _, ip := range static {
+			ips = append(ips, net.ParseIP(ip))
+		}
+	} else {
+		resolverLock.Lock()
+		entry, ok := hostEntries[host]
+		if ok && time.Now().Before(entry.expires) {
+			ips = entry.ips
+		}
+		resolverLock.Unlock()
+
+		if ips == nil {
+			resolved, err := resolveHost(ctx, host, resolver.Servers)
+			if err != nil {
+				return nil, err
+			}
+			ips = resolved
+		}
+	}
+
+	resolverLock.Lock()
+	defer resolverLock.Unlock()
+
+	entry, ok := hostEntries[host]
+	if !ok {
+		entry = &hostEntry{probes: map[string]ipProbe{}}
+		hostEntries[host] = entry
+	}
+	if len(static) == 0 && !time.Now().Before(entry.expires) {
+		entry.expires = time.Now().Add(seconds(resolver.CacheTTL))
+	}
+	entry.ips = ips
+	entry.port = port
+	entry.lastUsed = time.Now()
+	return entry.order(), nil
+}
+
+// 通过配置的DNS服务器解析域名，依次尝试各个服务器
+func resolveHost(ctx context.Context, host string, servers []string) ([]net.IP, error) {
+	if len(servers) == 0 {
+		return lookupIPs(ctx, net.DefaultResolver, host)
+	}
+
+	var lastErr error
+	for _, server := range servers {
+		network, addr, err := parseDNSServer(server)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resolver := &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+		ips, err := lookupIPs(ctx, resolver, host)
+		if err == nil {
+			return ips, nil
+		}
+		lastErr = err
+		logWarn("DNS服务器解析失败", requestLogFields(ctx, "server", server, "host", host, "error", err)...)
+	}
+	return nil, lastErr
+}
+
+func lookupIPs(ctx context.Context, resolver *net.Resolver, host string) ([]net.IP, error) {
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("%s 没有解析结果", host)
+	}
+	return ips, nil
+}
+
+// 按探测结果排列IP：与最快IP同样快的IP轮流使用，其次是较慢的IP和尚未探测的IP，不可达的IP排在最后
+func (e *hostEntry) order() []net.IP {
+	n := len(e.ips)
+	start := e.next % n
+	e.next++
+	ips := append(append([]net.IP{}, e.ips[start:]...), e.ips[:start]...)
+
+	var fastest time.Duration
+	for _, ip := range ips {
+		if p, ok := e.probes[ip.String()]; ok && p.reachable && (fastest == 0 || p.latency < fastest) {
+			fastest = p.latency
+		}
+	}
+	rank := func(ip net.IP) (int, time.Duration) {
+		p, ok := e.probes[ip.String()]
+		switch {
+		case !ok:
+			return 2, 0
+		case !p.reachable:
+			return 3, 0
+		case float64(p.latency) <= float64(fastest)*fastIPTolerance:
+			return 0, 0
+		default:
+			return 1, p.latency
+		}
+	}
+	sort.SliceStable(ips, func(i, j int) bool {
+		ri, li := rank(ips[i])
+		rj, lj := rank(ips[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return li < lj
+	})
+	return ips
+}
+
+// 记录IP的探测结果
+func recordIPProbe(host, ip string, probe ipProbe) {
+	resolverLock.Lock()
+	defer resolverLock.Unlock()
+
+	if entry, ok := hostEntries[host]; ok {
+		entry.probes[ip] = probe
+	}
+}
+
+// 定期探测有多个IP的域名，找出连接最快的IP
+func autoProbeHosts() {
+	for {
+		configLock.RLock()
+		interval := seconds(config.Resolver.ProbeInterval)
+		configLock.RUnlock()
+
+		time.Sleep(interval)
+		probeHosts()
+	}
+}
+
+// 探测所有域名的IP
+func probeHosts() {
+	type probeTarget struct {
+		host, ip, port string
+	}
+
+	resolverLock.Lock()
+	var targets []probeTarget
+	for host, entry := range hostEntries {
+		if time.Since(entry.lastUsed) > resolverProbeTTL {
+			delete(hostEntries, host)
+			continue
+		}
+		if len(entry.ips) < 2 {
+			continue
+		}
+		// 清理已不在解析结果中的IP
+		current := map[string]bool{}
+		for _, ip := range entry.ips {
+			current[ip.String()] = true
+			targets = append(targets, probeTarget{host, ip.String(), entry.port})
+		}
+		for ip := range entry.probes {
+			if !current[ip] {
+				delete(entry.probes, ip)
+			}
+		}
+	}
+	resolverLock.Unlock()
+
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target probeTarget) {
+			defer wg.Done()
+			start := time.Now()
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort(target.ip, target.port), resolverProbeTimeout)
+			if err != nil {
+				recordIPProbe(target.host, target.ip, ipProbe{})
+				return
+			}
+			conn.Close()
+			recordIPProbe(target.host, target.ip, ipProbe{reachable: true, latency: time.Since(start)})
+		}(target)
+	}
+	wg.Wait()
+
+	// 最快IP变化时记录日志
+	resolverLock.Lock()
+	defer resolverLock.Unlock()
+	for host, entry := range hostEntries {
+		if len(entry.ips) < 2 {
+			continue
+		}
+		fastest, latency := "", time.Duration(0)
+		for ip, p := range entry.probes {
+			if p.reachable && (fastest == "" || p.latency < latency) {
+				fastest, latency = ip, p.latency
+			}
+		}
+		if fastest != "" && fastest != entry.fastest {
+			logDebug("当前最快的IP已变化", "host", host, "ip", fastest, "latency", latency.Round(time.Microsecond))
+		}
+		entry.fastest = fastest
+	}
+}
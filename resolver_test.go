@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 在测试期间使用独立的解析缓存
+func resetHostEntries(t *testing.T) {
+	t.Helper()
+	resolverLock.Lock()
+	oldEntries := hostEntries
+	hostEntries = map[string]*hostEntry{}
+	resolverLock.Unlock()
+	t.Cleanup(func() {
+		resolverLock.Lock()
+		hostEntries = oldEntries
+		resolverLock.Unlock()
+	})
+}
+
+func TestParseDNSServer(t *testing.T) {
+	tests := []struct {
+		server      string
+		wantNetwork string
+		wantAddr    string
+		wantErr     bool
+	}{
+		{"1.1.1.1", "udp", "1.1.1.1:53", false},
+		{"1.1.1.1:5353", "udp", "1.1.1.1:5353", false},
+		{"tcp://8.8.8.8", "tcp", "8.8.8.8:53", false},
+		{"udp://[2606:4700::1111]:53", "udp", "[2606:4700::1111]:53", false},
+		{"2606:4700::1111", "udp", "[2606:4700::1111]:53", false},
+		{"dns.example.com", "udp", "dns.example.com:53", false},
+		{"https://1.1.1.1", "", "", true},
+		{"tcp://", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.server, func(t *testing.T) {
+			network, addr, err := parseDNSServer(tt.server)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDNSServer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if network != tt.wantNetwork || addr != tt.wantAddr {
+				t.Errorf("parseDNSServer() = %q, %q, want %q, %q", network, addr, tt.wantNetwork, tt.wantAddr)
+			}
+		})
+	}
+}
+
+func TestValidateResolverConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    func(resolver *ResolverConfig)
+		wantField string
+	}{
+		{"默认配置", func(resolver *ResolverConfig) {}, ""},
+		{"静态解析", func(resolver *ResolverConfig) {
+			resolver.Hosts = map[string][]string{"github.com": {"140.82.112.3", "::1"}}
+		}, ""},
+		{"静态解析没有IP", func(resolver *ResolverConfig) { resolver.Hosts = map[string][]string{"github.com": {}} }, "resolver.hosts"},
+		{"静态解析IP无效", func(resolver *ResolverConfig) { resolver.Hosts = map[string][]string{"github.com": {"github.io"}} }, "resolver.hosts"},
+		{"DNS服务器无效", func(resolver *ResolverConfig) { resolver.Servers = []string{"https://1.1.1.1"} }, "resolver.servers"},
+		{"缓存时间为0", func(resolver *ResolverConfig) { resolver.CacheTTL = 0 }, "resolver.cacheTTL"},
+		{"探测间隔为0", func(resolver *ResolverConfig) { resolver.ProbeInterval = 0 }, "resolver.probeInterval"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			tt.modify(&cfg.Resolver)
+			err := validateResolverConfig(cfg)
+			field := ""
+			if validationErr, ok := err.(*configValidationError); ok {
+				field = validationErr.Field
+			}
+			if field != tt.wantField {
+				t.Errorf("validateResolverConfig() = %v, want field %q", err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestHostEntryOrder(t *testing.T) {
+	ips := []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.3"), net.ParseIP("10.0.0.4")}
+	tests := []struct {
+		name   string
+		probes map[string]ipProbe
+		next   int
+		want   []string
+	}{
+		{"未探测时轮换", nil, 1, []string{"10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.1"}},
+		{"最快的IP在前，不可达的在后", map[string]ipProbe{
+			"10.0.0.1": {reachable: false},
+			"10.0.0.2": {reachable: true, latency: 100 * time.Millisecond},
+			"10.0.0.3": {reachable: true, latency: 10 * time.Millisecond},
+		}, 0, []string{"10.0.0.3", "10.0.0.2", "10.0.0.4", "10.0.0.1"}},
+		{"同样快的IP轮换", map[string]ipProbe{
+			"10.0.0.1": {reachable: true, latency: 10 * time.Millisecond},
+			"10.0.0.2": {reachable: true, latency: 11 * time.Millisecond},
+			"10.0.0.3": {reachable: true, latency: 50 * time.Millisecond},
+			"10.0.0.4": {reachable: true, latency: 30 * time.Millisecond},
+		}, 1, []string{"10.0.0.2", "10.0.0.1", "10.0.0.4", "10.0.0.3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := &hostEntry{ips: ips, probes: tt.probes, next: tt.next}
+			var got []string
+			for _, ip := range entry.order() {
+				got = append(got, ip.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDialWithResolverStaticHosts(t *testing.T) {
+	resetHostEntries(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	// 127.0.0.2上没有监听，连接失败后使用下一个IP
+	cfg := testConfig()
+	cfg.Resolver.Hosts = map[string][]string{"Git.Example": {"127.0.0.2", "127.0.0.1"}}
+	setTestConfig(t, cfg)
+
+	dial := dialWithResolver(&net.Dialer{Timeout: time.Second})
+	conn, err := dial(context.Background(), "tcp", net.JoinHostPort("git.example.", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if got := conn.RemoteAddr().(*net.TCPAddr).IP.String(); got != "127.0.0.1" {
+		t.Errorf("连接的IP = %s, want 127.0.0.1", got)
+	}
+
+	resolverLock.Lock()
+	probe, ok := hostEntries["git.example"].probes["127.0.0.2"]
+	resolverLock.Unlock()
+	if !ok || probe.reachable {
+		t.Errorf("连接失败的IP应标记为不可达: %+v", probe)
+	}
+
+	// 绑定IPv6本地地址时不能连接IPv4地址
+	dial = dialWithResolver(&net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP("::1")}})
+	if _, err := dial(context.Background(), "tcp", net.JoinHostPort("git.example", port)); err == nil {
+		t.Error("协议族不同时应返回错误")
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// 当前平台不支持通过信号触发平滑重启
+var restartSignals []os.Signal
+
+// 当前平台不支持继承监听
+func inheritedListener(addr string) net.Listener {
+	return nil
+}
+
+// 当前平台不支持平滑重启，无需通知父进程
+func notifyParentReady() {}
+
+// 当前平台不支持平滑重启
+func restartProcess() error {
+	return errors.New("当前平台不支持平滑重启")
+}
@@ -0,0 +1,183 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// 新进程就绪通知管道的文件描述符
+	envReadyFD = "FASTCODE_READY_FD"
+	// 继承的监听地址列表，按文件描述符顺序以逗号分隔
+	envListeners = "FASTCODE_LISTENERS"
+
+	// 新进程中的文件描述符：3为就绪通知管道，监听从4开始
+	readyFD         = 3
+	firstListenerFD = 4
+
+	// 等待新进程就绪的最长时间
+	restartReadyTimeout = 30 * time.Second
+)
+
+// 触发平滑重启的信号
+var restartSignals = []os.Signal{syscall.SIGUSR2}
+
+var (
+	inheritedOnce      sync.Once
+	inheritedListeners map[string]net.Listener
+)
+
+// 获取从父进程继承的监听
+func inheritedListener(addr string) net.Listener {
+	inheritedOnce.Do(func() {
+		inheritedListeners = map[string]net.Listener{}
+		fds := parseListenerEnv(os.Getenv(envListeners))
+		os.Unsetenv(envListeners)
+		for inheritedAddr, fd := range fds {
+			file := os.NewFile(fd, inheritedAddr)
+			listener, err := net.FileListener(file)
+			file.Close()
+			if err != nil {
+				logError("恢复继承的监听失败", "address", inheritedAddr, "error", err)
+				continue
+			}
+			inheritedListeners[inheritedAddr] = listener
+		}
+	})
+
+	listener := inheritedListeners[addr]
+	delete(inheritedListeners, addr)
+	return listener
+}
+
+// 解析继承的监听地址列表，返回地址对应的文件描述符
+func parseListenerEnv(value string) map[string]uintptr {
+	fds := map[string]uintptr{}
+	if value == "" {
+		return fds
+	}
+	for i, addr := range strings.Split(value, ",") {
+		fds[addr] = uintptr(firstListenerFD + i)
+	}
+	return fds
+}
+
+// 生成新进程的环境变量，替换当前进程继承的重启相关变量
+func restartEnv(environ, addrs []string) []string {
+	var env []string
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, envReadyFD+"=") && !strings.HasPrefix(kv, envListeners+"=") {
+			env = append(env, kv)
+		}
+	}
+	return append(env, envReadyFD+"="+strconv.Itoa(readyFD), envListeners+"="+strings.Join(addrs, ","))
+}
+
+// 通知父进程新进程已就绪
+func notifyParentReady() {
+	fd, err := strconv.Atoi(os.Getenv(envReadyFD))
+	os.Unsetenv(envReadyFD)
+	if err != nil {
+		return
+	}
+
+	// 关闭未被使用的继承监听
+	for addr, listener := range inheritedListeners {
+		logInfo("继承的监听未被使用，已关闭", "address", addr)
+		listener.Close()
+	}
+
+	readyFile := os.NewFile(uintptr(fd), "ready")
+	defer readyFile.Close()
+	if _, err := readyFile.Write([]byte{1}); err != nil {
+		logError("通知父进程失败", "error", err)
+		return
+	}
+	logInfo("新进程已就绪，通知父进程退出")
+}
+
+// 启动新进程并传递监听，新进程就绪后返回
+func restartProcess() error {
+	execPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("获取可执行文件路径失败: %v", err)
+	}
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyReader.Close()
+
+	// 复制监听的文件描述符，按顺序传递给新进程，ExtraFiles中的第一个文件在新进程中为文件描述符3
+	files := []*os.File{readyWriter}
+	var addrs []string
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for _, l := range currentListeners() {
+		filer, ok := l.listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("监听 %s 不支持传递", l.addr)
+		}
+		file, err := filer.File()
+		if err != nil {
+			return fmt.Errorf("复制监听 %s 失败: %v", l.addr, err)
+		}
+		files = append(files, file)
+		addrs = append(addrs, l.addr)
+	}
+
+	cmd := exec.Command(execPath, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = restartEnv(os.Environ(), addrs)
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("启动新进程失败: %v", err)
+	}
+	logInfo("新进程已启动", "pid", cmd.Process.Pid)
+
+	// 关闭父进程中的写端，新进程退出时读取会立即返回
+	readyWriter.Close()
+	files = files[1:]
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, err := readyReader.Read(buf)
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			cmd.Process.Kill()
+			return errors.New("新进程未能就绪")
+		}
+		return nil
+	case err := <-exited:
+		return fmt.Errorf("新进程提前退出: %v", err)
+	case <-time.After(restartReadyTimeout):
+		cmd.Process.Kill()
+		return errors.New("等待新进程就绪超时")
+	}
+}
@@ -0,0 +1,77 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"reflect"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestRestartEnv(t *testing.T) {
+	environ := []string{"PATH=/usr/bin", envReadyFD + "=7", envListeners + "=:9090", "HOME=/root"}
+	got := restartEnv(environ, []string{"0.0.0.0:8080", "0.0.0.0:8443"})
+	want := []string{"PATH=/usr/bin", "HOME=/root", envReadyFD + "=3", envListeners + "=0.0.0.0:8080,0.0.0.0:8443"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("restartEnv() = %v, want %v", got, want)
+	}
+}
+
+func TestParseListenerEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  map[string]uintptr
+	}{
+		{"没有继承的监听", "", map[string]uintptr{}},
+		{"单个监听", "0.0.0.0:8080", map[string]uintptr{"0.0.0.0:8080": 4}},
+		{"多个监听按顺序编号", "0.0.0.0:8080,0.0.0.0:8443,[::1]:80", map[string]uintptr{"0.0.0.0:8080": 4, "0.0.0.0:8443": 5, "[::1]:80": 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseListenerEnv(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseListenerEnv(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	// 父进程生成的环境变量由新进程解析，就绪管道之后依次为各个监听
+	env := restartEnv(nil, []string{"0.0.0.0:8080", "0.0.0.0:8443"})
+	if env[0] != envReadyFD+"="+strconv.Itoa(readyFD) || readyFD != 3 {
+		t.Errorf("就绪管道 = %q, want fd 3", env[0])
+	}
+	fds := parseListenerEnv(env[1][len(envListeners)+1:])
+	if fds["0.0.0.0:8080"] != readyFD+1 || fds["0.0.0.0:8443"] != readyFD+2 {
+		t.Errorf("监听的文件描述符 = %v", fds)
+	}
+}
+
+func TestNotifyParentReady(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+
+	// notifyParentReady会关闭传入的文件描述符，传递复制的描述符
+	fd, err := syscall.Dup(int(writer.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(envReadyFD, strconv.Itoa(fd))
+	notifyParentReady()
+	if _, ok := os.LookupEnv(envReadyFD); ok {
+		t.Error("通知后应删除环境变量")
+	}
+
+	buf := make([]byte, 1)
+	if n, err := reader.Read(buf); err != nil || n != 1 || buf[0] != 1 {
+		t.Errorf("读取就绪通知 = %d, %v, %v", n, err, buf)
+	}
+
+	// 不是由父进程启动时不通知
+	notifyParentReady()
+}
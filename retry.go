@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 复制响应体时的缓冲区大小
+const copyBufferSize = 32 * 1024
+
+// 是否为可以安全重试的请求
+func isIdempotent(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// 发送请求，幂等请求遇到连接错误或5xx响应时按退避时间重试
+func doWithRetry(req *http.Request) (*http.Response, error) {
+	if !isIdempotent(req.Method) {
+		return currentHTTPClient().Do(req)
+	}
+
+	configLock.RLock()
+	retry := config.Retry
+	configLock.RUnlock()
+
+	ctx := req.Context()
+	backoff := time.Duration(retry.Backoff) * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		resp, err := currentHTTPClient().Do(req.Clone(ctx))
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			return resp, nil
+		}
+		if attempt >= retry.MaxAttempts || ctx.Err() != nil {
+			return resp, err
+		}
+
+		if err != nil {
+			logWarn("请求上游失败，稍后重试", requestLogFields(ctx, "url", req.URL.String(), "attempt", attempt, "backoff", backoff, "error", err)...)
+		} else {
+			logWarn("上游返回错误状态码，稍后重试", requestLogFields(ctx, "url", req.URL.String(), "status", resp.StatusCode, "attempt", attempt, "backoff", backoff)...)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// 读取上游响应体失败
+type upstreamReadError struct {
+	err error
+}
+
+func (e *upstreamReadError) Error() string {
+	return fmt.Sprintf("读取上游响应失败: %v", e.err)
+}
+
+func (e *upstreamReadError) Unwrap() error {
+	return e.err
+}
+
+// 复制响应体，区分读取上游失败和写入客户端失败
+func copyUpstream(dst io.Writer, src io.Reader) (int64, error) {
+	buf := make([]byte, copyBufferSize)
+	var written int64
+	for {
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			wn, writeErr := dst.Write(buf[:n])
+			written += int64(wn)
+			if writeErr != nil {
+				return written, writeErr
+			}
+		}
+		if readErr == io.EOF {
+			return written, nil
+		}
+		if readErr != nil {
+			return written, &upstreamReadError{readErr}
+		}
+	}
+}
+
+// 获取用于If-Range的校验值，弱ETag不能用于范围请求
+func resumeValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+// 解析Content-Range响应头，返回起止位置，end为-1表示到文件末尾
+func parseContentRange(value string) (start, end int64, ok bool) {
+	value = strings.TrimPrefix(value, "bytes ")
+	rangePart, _, found := strings.Cut(value, "/")
+	if !found {
+		return 0, 0, false
+	}
+	startPart, endPart, found := strings.Cut(rangePart, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(startPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	end, err = strconv.ParseInt(endPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// 流式返回响应体，上游连接中断时使用Range和If-Range请求剩余部分并继续写入同一个响应
+func copyResponseBody(dst io.Writer, resp *http.Response) error {
+	configLock.RLock()
+	idleTimeout := seconds(config.Timeouts.IdleRead)
+	configLock.RUnlock()
+
+	written, err := copyUpstream(dst, withIdleTimeout(resp.Body, idleTimeout))
+	if err == nil {
+		return nil
+	}
+
+	// 只有上游读取失败且资源带有校验值时才能续传
+	var readErr *upstreamReadError
+	req := resp.Request
+	if !errors.As(err, &readErr) || req == nil || req.Method != http.MethodGet || req.Context().Err() != nil {
+		return err
+	}
+	validator := resumeValidator(resp.Header)
+	if validator == "" || resp.Header.Get("Accept-Ranges") == "none" {
+		return err
+	}
+
+	start, end := int64(0), int64(-1)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusPartialContent:
+		var ok bool
+		if start, end, ok = parseContentRange(resp.Header.Get("Content-Range")); !ok {
+			return err
+		}
+	default:
+		return err
+	}
+
+	configLock.RLock()
+	maxResumes := config.Retry.MaxResumes
+	configLock.RUnlock()
+
+	offset := start + written
+	for resumes := 1; resumes <= maxResumes; resumes++ {
+		logWarn("上游连接中断，断点续传", requestLogFields(req.Context(), "url", req.URL.String(), "offset", offset, "resume", resumes, "error", err)...)
+
+		rangeReq := req.Clone(req.Context())
+		if end >= 0 {
+			rangeReq.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, end))
+		} else {
+			rangeReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		rangeReq.Header.Set("If-Range", validator)
+		rangeReq.Header.Del("If-None-Match")
+		rangeReq.Header.Del("If-Modified-Since")
+
+		rangeResp, reqErr := doWithRetry(rangeReq)
+		if reqErr != nil {
+			return fmt.Errorf("续传请求失败: %v", reqErr)
+		}
+		// 资源已变化或上游不支持范围请求时无法续传
+		rangeStart, _, ok := parseContentRange(rangeResp.Header.Get("Content-Range"))
+		if rangeResp.StatusCode != http.StatusPartialContent || !ok || rangeStart != offset {
+			rangeResp.Body.Close()
+			return fmt.Errorf("续传失败，上游返回状态码 %d", rangeResp.StatusCode)
+		}
+
+		n, copyErr := copyUpstream(dst, withIdleTimeout(rangeResp.Body, idleTimeout))
+		rangeResp.Body.Close()
+		offset += n
+		if copyErr == nil {
+			logInfo("续传完成", requestLogFields(req.Context(), "url", req.URL.String(), "bytes", offset-start)...)
+			return nil
+		}
+		if !errors.As(copyErr, &readErr) || req.Context().Err() != nil {
+			return copyErr
+		}
+		err = copyErr
+	}
+	return err
+}
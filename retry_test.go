@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		value      string
+		start, end int64
+		ok         bool
+	}{
+		{"bytes 0-99/200", 0, 99, true},
+		{"bytes 100-199/*", 100, 199, true},
+		{"bytes */200", 0, 0, false},
+		{"bytes 100/200", 0, 0, false},
+		{"bytes a-99/200", 0, 0, false},
+		{"bytes 0-b/200", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			start, end, ok := parseContentRange(tt.value)
+			if start != tt.start || end != tt.end || ok != tt.ok {
+				t.Errorf("parseContentRange(%q) = %d, %d, %v, want %d, %d, %v", tt.value, start, end, ok, tt.start, tt.end, tt.ok)
+			}
+		})
+	}
+}
+
+func TestResumeValidator(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   string
+	}{
+		{"强ETag", http.Header{"Etag": {`"abc"`}, "Last-Modified": {"Mon, 02 Jan 2006 15:04:05 GMT"}}, `"abc"`},
+		{"弱ETag使用Last-Modified", http.Header{"Etag": {`W/"abc"`}, "Last-Modified": {"Mon, 02 Jan 2006 15:04:05 GMT"}}, "Mon, 02 Jan 2006 15:04:05 GMT"},
+		{"只有弱ETag", http.Header{"Etag": {`W/"abc"`}}, ""},
+		{"没有校验值", http.Header{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resumeValidator(tt.header); got != tt.want {
+				t.Errorf("resumeValidator() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// 使用当前配置创建HTTP客户端，结束后恢复
+func initTestHTTPClient(t *testing.T) {
+	t.Helper()
+	oldClient := currentHTTPClient()
+	initHTTPClient()
+	t.Cleanup(func() {
+		httpClientLock.Lock()
+		httpClient = oldClient
+		httpClientLock.Unlock()
+	})
+}
+
+// 读取到指定位置后连接中断的响应体
+func brokenBody(content []byte, n int) io.ReadCloser {
+	return io.NopCloser(io.MultiReader(bytes.NewReader(content[:n]), &failingReader{}))
+}
+
+type failingReader struct{}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("connection reset by peer")
+}
+
+func TestCopyResponseBodyResume(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 10000))
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	etag := `"v1"`
+
+	cfg := testConfig()
+	cfg.Retry.MaxAttempts = 1
+	cfg.Retry.MaxResumes = 2
+	setTestConfig(t, cfg)
+	initTestHTTPClient(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		status     int
+		header     http.Header
+		rangeStart int
+		want       []byte
+		wantErr    bool
+	}{
+		{
+			name:   "完整响应中断后续传",
+			status: http.StatusOK,
+			header: http.Header{"Etag": {etag}},
+			want:   content,
+		},
+		{
+			name:       "范围响应中断后续传到原范围结尾",
+			status:     http.StatusPartialContent,
+			header:     http.Header{"Etag": {etag}, "Content-Range": {"bytes 1000-49999/100000"}},
+			rangeStart: 1000,
+			want:       content[1000:50000],
+		},
+		{
+			name:    "资源已变化",
+			status:  http.StatusOK,
+			header:  http.Header{"Etag": {`"v0"`}},
+			wantErr: true,
+		},
+		{
+			name:    "没有校验值",
+			status:  http.StatusOK,
+			header:  http.Header{"Etag": {`W/"v1"`}},
+			wantErr: true,
+		},
+		{
+			name:    "上游不支持范围请求",
+			status:  http.StatusOK,
+			header:  http.Header{"Etag": {etag}, "Accept-Ranges": {"none"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/file.bin", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := &http.Response{
+				StatusCode: tt.status,
+				Header:     tt.header,
+				Body:       brokenBody(content[tt.rangeStart:], 4096),
+				Request:    req,
+			}
+
+			var buf bytes.Buffer
+			err = copyResponseBody(&buf, resp)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("应返回错误")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.want) {
+				t.Errorf("续传后内容不一致，长度 %d, want %d", buf.Len(), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestCopyResponseBodyNoResumeForWriteError(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Etag": {`"v1"`}},
+		Body:       io.NopCloser(strings.NewReader("content")),
+	}
+	setTestConfig(t, testConfig())
+	err := copyResponseBody(&failingWriter{}, resp)
+	var readErr *upstreamReadError
+	if err == nil || errors.As(err, &readErr) {
+		t.Errorf("写入客户端失败时应直接返回写入错误，got %v", err)
+	}
+}
+
+type failingWriter struct{}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
@@ -0,0 +1,51 @@
+package main
+
+import "context"
+
+// 默认规则名称，其他规则未配置的项使用此规则的配置
+const defaultRuleName = "default"
+
+// 请求上下文中保存规则名称的键
+type ruleContextKey struct{}
+
+// 在上下文中记录请求匹配的规则
+func withRule(ctx context.Context, rule string) context.Context {
+	return context.WithValue(ctx, ruleContextKey{}, rule)
+}
+
+// 获取请求匹配的规则，未记录时返回默认规则
+func ruleFromContext(ctx context.Context) string {
+	if rule, ok := ctx.Value(ruleContextKey{}).(string); ok {
+		return rule
+	}
+	return defaultRuleName
+}
+
+// 判断规则名称是否有效
+func isKnownRule(name string) bool {
+	if name == defaultRuleName || name == otherRuleName {
+		return true
+	}
+	for _, ruleName := range ruleNames {
+		if ruleName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// 获取规则的上游配置，未配置的项使用default规则的配置
+func ruleConfig(cfg *Config, rule string) RuleConfig {
+	result := cfg.Rules[rule]
+	defaults := cfg.Rules[defaultRuleName]
+	if result.Proxy == "" {
+		result.Proxy = defaults.Proxy
+	}
+	if result.Timeout == 0 {
+		result.Timeout = defaults.Timeout
+	}
+	if len(result.Mirrors) == 0 {
+		result.Mirrors = defaults.Mirrors
+	}
+	return result
+}
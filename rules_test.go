@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRuleConfig(t *testing.T) {
+	mirrors := []MirrorConfig{{Name: "mirror", URL: "https://mirror.example.com/{url}"}}
+	cfg := testConfig()
+	cfg.Rules = map[string]RuleConfig{
+		defaultRuleName: {Proxy: "corp", Timeout: 60, Mirrors: mirrors},
+		"raw":           {Proxy: directProxyName, Timeout: 10},
+		"release":       {Mirrors: []MirrorConfig{}},
+	}
+
+	tests := []struct {
+		rule string
+		want RuleConfig
+	}{
+		{defaultRuleName, RuleConfig{Proxy: "corp", Timeout: 60, Mirrors: mirrors}},
+		{"raw", RuleConfig{Proxy: directProxyName, Timeout: 10, Mirrors: mirrors}},
+		{"release", RuleConfig{Proxy: "corp", Timeout: 60, Mirrors: mirrors}},
+		{"git", RuleConfig{Proxy: "corp", Timeout: 60, Mirrors: mirrors}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			if got := ruleConfig(cfg, tt.rule); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ruleConfig(%q) = %+v, want %+v", tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsKnownRule(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{defaultRuleName, true},
+		{otherRuleName, true},
+		{"release", true},
+		{"gist", true},
+		{"releases", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isKnownRule(tt.name); got != tt.want {
+				t.Errorf("isKnownRule(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleFromContext(t *testing.T) {
+	if got := ruleFromContext(context.Background()); got != defaultRuleName {
+		t.Errorf("未记录规则时 = %q, want %q", got, defaultRuleName)
+	}
+	if got := ruleFromContext(withRule(context.Background(), "raw")); got != "raw" {
+		t.Errorf("ruleFromContext() = %q, want raw", got)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// 排空期间输出剩余传输数的间隔
+	drainReportInterval = 5 * time.Second
+	// 监听关闭后检查传输是否全部结束的间隔
+	drainPollInterval = 100 * time.Millisecond
+)
+
+var (
+	// 正在运行的HTTP服务
+	servers     []*http.Server
+	serversLock sync.Mutex
+
+	// 正在使用的监听，平滑重启时传递给新进程
+	listeners []serverListener
+
+	// 重启请求，由管理API发起
+	restartRequests = make(chan chan error)
+
+	// 是否正在排空连接
+	draining int32
+	// 进行中的代理传输数
+	activeTransfers int64
+)
+
+// 监听及其地址
+type serverListener struct {
+	addr     string
+	listener net.Listener
+}
+
+// 监听地址，平滑重启时优先使用从父进程继承的监听
+func listen(addr string) (net.Listener, error) {
+	if listener := inheritedListener(addr); listener != nil {
+		logInfo("使用从父进程继承的监听", "address", addr)
+		return listener, nil
+	}
+	return listenAddress(addr)
+}
+
+// 启动HTTP服务
+func startServer(server *http.Server, useTLS bool) {
+	listener, err := listen(server.Addr)
+	if err != nil {
+		logError("服务器启动失败", "address", server.Addr, "error", err)
+		os.Exit(1)
+	}
+
+	serversLock.Lock()
+	servers = append(servers, server)
+	listeners = append(listeners, serverListener{addr: server.Addr, listener: listener})
+	serversLock.Unlock()
+
+	// 平滑重启时传递原始监听，PROXY protocol只在处理连接时解析
+	configLock.RLock()
+	proxyProtocol := config.ProxyProtocol
+	configLock.RUnlock()
+	serveListener := listener
+	if proxyProtocol {
+		serveListener = &proxyProtocolListener{listener}
+	}
+
+	go func() {
+		var err error
+		if useTLS {
+			err = server.ServeTLS(serveListener, "", "")
+		} else {
+			err = server.Serve(serveListener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logError("服务器运行失败", "address", server.Addr, "error", err)
+			os.Exit(1)
+		}
+	}()
+}
+
+// 是否正在排空连接
+func isDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+// 记录代理传输开始，返回结束时调用的函数
+func trackTransfer() func() {
+	atomic.AddInt64(&activeTransfers, 1)
+	return func() {
+		atomic.AddInt64(&activeTransfers, -1)
+	}
+}
+
+// 等待退出或重启信号，新进程接管监听后优雅关闭服务
+func waitForShutdown() {
+	// 所有监听已就绪，通知父进程开始排空
+	notifyParentReady()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	upgrades := make(chan os.Signal, 1)
+	if len(restartSignals) > 0 {
+		signal.Notify(upgrades, restartSignals...)
+	}
+
+	// 退出时先等待负载均衡摘除节点，重启时新进程已接管监听，不需要等待
+	preStop := false
+	for {
+		select {
+		case sig := <-signals:
+			logInfo("收到退出信号，停止接受新连接并等待进行中的传输完成", "signal", sig)
+			preStop = true
+		case sig := <-upgrades:
+			logInfo("收到重启信号，启动新进程接管监听", "signal", sig)
+			if err := restartProcess(); err != nil {
+				logError("平滑重启失败", "error", err)
+				continue
+			}
+		case result := <-restartRequests:
+			logInfo("收到管理API重启请求，启动新进程接管监听")
+			err := restartProcess()
+			result <- err
+			if err != nil {
+				logError("平滑重启失败", "error", err)
+				continue
+			}
+		}
+		break
+	}
+
+	signal.Stop(signals)
+	signal.Stop(upgrades)
+	shutdownServers(preStop)
+}
+
+// 请求平滑重启，新进程就绪后返回
+func requestRestart() error {
+	result := make(chan error, 1)
+	select {
+	case restartRequests <- result:
+		return <-result
+	default:
+		return errors.New("服务正在重启或关闭")
+	}
+}
+
+// 获取当前所有监听的副本
+func currentListeners() []serverListener {
+	serversLock.Lock()
+	defer serversLock.Unlock()
+	return append([]serverListener(nil), listeners...)
+}
+
+// 停止接受新连接，等待进行中的传输完成，超时后强制关闭
+// preStop为true时先标记为排空并等待shutdownDelay，使负载均衡通过就绪检查摘除节点后再关闭监听
+func shutdownServers(preStop bool) {
+	atomic.StoreInt32(&draining, 1)
+
+	configLock.RLock()
+	timeout := time.Duration(config.ShutdownTimeout) * time.Second
+	delay := time.Duration(config.ShutdownDelay) * time.Second
+	configLock.RUnlock()
+
+	if preStop && delay > 0 {
+		logInfo("就绪检查已返回排空状态，等待负载均衡摘除节点后关闭监听", "delay", delay)
+		time.Sleep(delay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	serversLock.Lock()
+	running := append([]*http.Server(nil), servers...)
+	serversLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for _, server := range running {
+			wg.Add(1)
+			go func(server *http.Server) {
+				defer wg.Done()
+				if err := server.Shutdown(ctx); err != nil {
+					// 超过排空时间，强制关闭剩余连接
+					server.Close()
+				}
+			}(server)
+		}
+		wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(drainReportInterval)
+	defer ticker.Stop()
+
+	// Shutdown不等待被接管的隧道连接，监听关闭后继续等待所有传输结束
+	var poll <-chan time.Time
+	for {
+		select {
+		case <-done:
+			done = nil
+			pollTicker := time.NewTicker(drainPollInterval)
+			defer pollTicker.Stop()
+			poll = pollTicker.C
+		case <-poll:
+		case <-ctx.Done():
+			if remaining := atomic.LoadInt64(&activeTransfers); remaining > 0 {
+				logWarn("排空超时，强制中断未完成的传输", "remaining", remaining)
+			}
+			logInfo("服务器已关闭")
+			return
+		case <-ticker.C:
+			logInfo("正在排空连接", "remaining", atomic.LoadInt64(&activeTransfers))
+		}
+		if done == nil && atomic.LoadInt64(&activeTransfers) == 0 {
+			logInfo("服务器已关闭")
+			return
+		}
+	}
+}
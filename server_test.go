@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 使用指定的排空配置关闭服务，返回关闭耗时
+func runShutdown(t *testing.T, timeout, delay int64, preStop bool, finishAfter time.Duration) time.Duration {
+	t.Helper()
+	cfg := testConfig()
+	cfg.ShutdownTimeout = timeout
+	cfg.ShutdownDelay = delay
+	setTestConfig(t, cfg)
+	t.Cleanup(func() { atomic.StoreInt32(&draining, 0) })
+
+	var once sync.Once
+	done := trackTransfer()
+	finish := func() { once.Do(done) }
+	defer finish()
+	if finishAfter >= 0 {
+		time.AfterFunc(finishAfter, finish)
+	}
+
+	start := time.Now()
+	shutdownServers(preStop)
+	if !isDraining() {
+		t.Error("关闭后应处于排空状态")
+	}
+	return time.Since(start)
+}
+
+func TestShutdownServers(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeout     int64
+		delay       int64
+		preStop     bool
+		finishAfter time.Duration
+		min, max    time.Duration
+	}{
+		{"等待传输结束", 5, 0, false, 300 * time.Millisecond, 300 * time.Millisecond, 2 * time.Second},
+		{"超过排空时间后退出", 1, 0, false, -1, time.Second, 3 * time.Second},
+		{"收到信号时先等待", 5, 1, true, 0, time.Second, 3 * time.Second},
+		{"没有等待时间", 5, 0, true, 0, 0, 900 * time.Millisecond},
+		{"重启时不等待", 5, 1, false, 0, 0, 900 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			elapsed := runShutdown(t, tt.timeout, tt.delay, tt.preStop, tt.finishAfter)
+			if elapsed < tt.min || elapsed > tt.max {
+				t.Errorf("关闭耗时 %v, want %v ~ %v", elapsed, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestRequestRestart(t *testing.T) {
+	// 没有等待重启请求的接收方时（例如正在关闭）立即返回错误
+	if err := requestRestart(); err == nil {
+		t.Error("没有接收方时应返回错误")
+	}
+
+	restartErr := errors.New("启动新进程失败")
+	go func() {
+		result := <-restartRequests
+		result <- restartErr
+	}()
+	deadline := time.Now().Add(time.Second)
+	for {
+		err := requestRestart()
+		if err == restartErr {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("requestRestart() = %v, want %v", err, restartErr)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
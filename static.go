@@ -17,7 +17,7 @@ func initStaticFiles() {
 	// 获取可执行文件路径
 	execPath, err := os.Executable()
 	if err != nil {
-		printfWithTime("获取可执行文件路径失败: %v\n", err)
+		logError("获取可执行文件路径失败", "error", err)
 		// 失败时使用当前目录作为备选
 		execPath = "."
 	}
@@ -26,10 +26,10 @@ func initStaticFiles() {
 
 	// 检查public目录是否存在
 	if _, err := os.Stat(publicDir); os.IsNotExist(err) {
-		printlnWithTime("public目录不存在，使用嵌入的静态资源...")
+		logInfo("public目录不存在，使用嵌入的静态资源", "dir", publicDir)
 		// 先创建public目录
 		if err := os.MkdirAll(publicDir, 0755); err != nil {
-			printfWithTime("创建public目录失败: %v\n", err)
+			logError("创建public目录失败", "dir", publicDir, "error", err)
 			return
 		}
 		// 从嵌入的文件系统复制静态文件到本地
@@ -38,11 +38,11 @@ func initStaticFiles() {
 		// 检查public目录是否为空
 		entries, err := os.ReadDir(publicDir)
 		if err != nil {
-			printfWithTime("读取public目录失败: %v\n", err)
+			logError("读取public目录失败", "dir", publicDir, "error", err)
 			return
 		}
 		if len(entries) == 0 {
-			printlnWithTime("public目录为空，使用嵌入的静态资源...")
+			logInfo("public目录为空，使用嵌入的静态资源", "dir", publicDir)
 			// 从嵌入的文件系统复制静态文件到本地
 			copyEmbeddedFiles(embeddedPublic, "public", publicDir)
 		}
@@ -53,7 +53,7 @@ func initStaticFiles() {
 func copyEmbeddedFiles(efs embed.FS, srcDir, dstDir string) {
 	entries, err := efs.ReadDir(srcDir)
 	if err != nil {
-		printfWithTime("读取嵌入文件失败: %v\n", err)
+		logError("读取嵌入文件失败", "error", err)
 		return
 	}
 
@@ -66,7 +66,7 @@ func copyEmbeddedFiles(efs embed.FS, srcDir, dstDir string) {
 			// 创建目录
 			err := os.MkdirAll(dstPath, 0755)
 			if err != nil {
-				printfWithTime("创建目录失败: %v\n", err)
+				logError("创建目录失败", "dir", dstPath, "error", err)
 				continue
 			}
 			// 递归复制子目录
@@ -75,13 +75,13 @@ func copyEmbeddedFiles(efs embed.FS, srcDir, dstDir string) {
 			// 复制文件
 			srcFile, err := efs.Open(srcPath)
 			if err != nil {
-				printfWithTime("打开嵌入文件失败: %v\n", err)
+				logError("打开嵌入文件失败", "path", srcPath, "error", err)
 				continue
 			}
 
 			dstFile, err := os.Create(dstPath)
 			if err != nil {
-				printfWithTime("创建本地文件失败: %v\n", err)
+				logError("创建本地文件失败", "path", dstPath, "error", err)
 				srcFile.Close()
 				continue
 			}
@@ -91,11 +91,11 @@ func copyEmbeddedFiles(efs embed.FS, srcDir, dstDir string) {
 			dstFile.Close()
 
 			if err != nil {
-				printfWithTime("复制文件失败: %v\n", err)
+				logError("复制文件失败", "path", dstPath, "error", err)
 				continue
 			}
 
-			printfWithTime("复制静态文件: %s -> %s\n", srcPath, dstPath)
+			logDebug("复制静态文件", "from", srcPath, "to", dstPath)
 		}
 	}
 }
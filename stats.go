@@ -0,0 +1,526 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 默认使用统计文件路径
+	defaultStatsFile = "./data/stats.json"
+	// 统计文件格式版本
+	statsFileVersion = 1
+	// 统计接口默认和最多返回的条数
+	defaultStatsLimit = 10
+	maxStatsLimit     = 1000
+)
+
+// 请求数和流量
+type usageCounter struct {
+	Requests int64 `json:"requests"`
+	Bytes    int64 `json:"bytes"`
+}
+
+func (c *usageCounter) add(other usageCounter) {
+	c.Requests += other.Requests
+	c.Bytes += other.Bytes
+}
+
+// 按小时或按天汇总的流量
+type usageBucket struct {
+	usageCounter
+	Hosts map[string]*usageCounter `json:"hosts"`
+	Repos map[string]*usageCounter `json:"repos,omitempty"` // 只在按天汇总中记录
+}
+
+// 使用统计
+type usageStats struct {
+	Version int                      `json:"version"`
+	Since   time.Time                `json:"since"`
+	Total   usageCounter             `json:"total"`
+	Repos   map[string]*usageCounter `json:"repos"`
+	Hosts   map[string]*usageCounter `json:"hosts"`
+	Files   map[string]*usageCounter `json:"files"`
+	Hourly  map[int64]*usageBucket   `json:"hourly"` // 键为该小时开始时间的Unix时间戳
+	Daily   map[int64]*usageBucket   `json:"daily"`  // 键为当天零点的Unix时间戳
+}
+
+func newUsageStats() *usageStats {
+	return &usageStats{
+		Version: statsFileVersion,
+		Since:   time.Now(),
+		Repos:   map[string]*usageCounter{},
+		Hosts:   map[string]*usageCounter{},
+		Files:   map[string]*usageCounter{},
+		Hourly:  map[int64]*usageBucket{},
+		Daily:   map[int64]*usageBucket{},
+	}
+}
+
+var (
+	// 当前的统计，包含文件中的数据和之后的增量
+	usage = newUsageStats()
+	// 上次写入文件后的增量，写入时与文件中的数据合并，平滑重启时新旧进程不会互相覆盖
+	usagePending = newUsageStats()
+	usageLock    sync.Mutex
+)
+
+// 在计数表中累加
+func addCounter(counters map[string]*usageCounter, key string, delta usageCounter) {
+	if key == "" {
+		return
+	}
+	counter, ok := counters[key]
+	if !ok {
+		counter = &usageCounter{}
+		counters[key] = counter
+	}
+	counter.add(delta)
+}
+
+// 获取或创建汇总
+func bucketAt(buckets map[int64]*usageBucket, start int64, withRepos bool) *usageBucket {
+	bucket, ok := buckets[start]
+	if !ok {
+		bucket = &usageBucket{Hosts: map[string]*usageCounter{}}
+		if withRepos {
+			bucket.Repos = map[string]*usageCounter{}
+		}
+		buckets[start] = bucket
+	}
+	return bucket
+}
+
+// 当天零点
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// 记录一次请求
+func (s *usageStats) record(t time.Time, host, repo, file string, delta usageCounter) {
+	s.Total.add(delta)
+	addCounter(s.Hosts, host, delta)
+	addCounter(s.Repos, repo, delta)
+	addCounter(s.Files, file, delta)
+
+	hourly := bucketAt(s.Hourly, t.Truncate(time.Hour).Unix(), false)
+	hourly.add(delta)
+	addCounter(hourly.Hosts, host, delta)
+
+	daily := bucketAt(s.Daily, startOfDay(t).Unix(), true)
+	daily.add(delta)
+	addCounter(daily.Hosts, host, delta)
+	addCounter(daily.Repos, repo, delta)
+}
+
+// 合并另一份统计
+func (s *usageStats) merge(other *usageStats) {
+	if !other.Since.IsZero() && (s.Since.IsZero() || other.Since.Before(s.Since)) {
+		s.Since = other.Since
+	}
+	s.Total.add(other.Total)
+	mergeCounters(s.Repos, other.Repos)
+	mergeCounters(s.Hosts, other.Hosts)
+	mergeCounters(s.Files, other.Files)
+	mergeBuckets(s.Hourly, other.Hourly, false)
+	mergeBuckets(s.Daily, other.Daily, true)
+}
+
+func mergeCounters(dst, src map[string]*usageCounter) {
+	for key, counter := range src {
+		addCounter(dst, key, *counter)
+	}
+}
+
+func mergeBuckets(dst, src map[int64]*usageBucket, withRepos bool) {
+	for start, bucket := range src {
+		merged := bucketAt(dst, start, withRepos)
+		merged.add(bucket.usageCounter)
+		mergeCounters(merged.Hosts, bucket.Hosts)
+		if withRepos {
+			mergeCounters(merged.Repos, bucket.Repos)
+		}
+	}
+}
+
+// 删除超过保留时间的汇总和多余的文件统计
+func (s *usageStats) prune(cfg StatsConfig, now time.Time) {
+	hourlyCutoff := now.Add(-time.Duration(cfg.HourlyRetention) * time.Hour).Unix()
+	for start := range s.Hourly {
+		if start < hourlyCutoff {
+			delete(s.Hourly, start)
+		}
+	}
+	dailyCutoff := startOfDay(now).AddDate(0, 0, -int(cfg.DailyRetention)).Unix()
+	for start := range s.Daily {
+		if start < dailyCutoff {
+			delete(s.Daily, start)
+		}
+	}
+
+	// 只保留请求数最多的文件
+	if len(s.Files) > cfg.MaxFiles {
+		kept := map[string]*usageCounter{}
+		for _, item := range topCounters(s.Files, cfg.MaxFiles) {
+			kept[item.name] = s.Files[item.name]
+		}
+		s.Files = kept
+	}
+}
+
+// 从统计文件读取，文件不存在时返回空统计
+func readUsageStats(path string) (*usageStats, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return newUsageStats(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	stats := newUsageStats()
+	if err := json.Unmarshal(data, stats); err != nil {
+		return nil, err
+	}
+	if stats.Version != statsFileVersion {
+		return nil, fmt.Errorf("不支持的统计文件版本: %d", stats.Version)
+	}
+	return stats, nil
+}
+
+// 写入统计文件，先写入临时文件再重命名，避免写入中断时损坏文件
+func writeUsageStats(path string, stats *usageStats) error {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	// 失败时清理临时文件
+	defer os.Remove(tmpPath)
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// 当前的统计配置
+func currentStatsConfig() StatsConfig {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return config.Stats
+}
+
+// 启动时加载统计文件
+func initStats() {
+	cfg := currentStatsConfig()
+	if !cfg.Enabled {
+		return
+	}
+	stats, err := readUsageStats(cfg.File)
+	if err != nil {
+		logError("读取使用统计失败，从零开始统计", "path", cfg.File, "error", err)
+		return
+	}
+	usageLock.Lock()
+	usage = stats
+	usageLock.Unlock()
+}
+
+// 定期将使用统计写入文件
+func autoFlushStats() {
+	for {
+		interval := seconds(currentStatsConfig().FlushInterval)
+		if interval <= 0 {
+			interval = seconds(defaultConfig.Stats.FlushInterval)
+		}
+		time.Sleep(interval)
+		flushStats()
+	}
+}
+
+// 将增量合并到统计文件中
+func flushStats() {
+	cfg := currentStatsConfig()
+	if !cfg.Enabled {
+		return
+	}
+
+	usageLock.Lock()
+	defer usageLock.Unlock()
+	if usagePending.Total.Requests == 0 {
+		return
+	}
+
+	// 以文件中的数据为基础，合并其他进程（如平滑重启前后的新旧进程）写入的统计
+	// 文件不存在时readUsageStats返回空统计，其他读取错误时保留增量等待下次写入，避免覆盖文件中的统计
+	stats, err := readUsageStats(cfg.File)
+	if err != nil {
+		logError("读取使用统计失败，跳过本次写入", "path", cfg.File, "error", err)
+		return
+	}
+	stats.merge(usagePending)
+	stats.prune(cfg, time.Now())
+
+	if err := writeUsageStats(cfg.File, stats); err != nil {
+		logError("写入使用统计失败", "path", cfg.File, "error", err)
+		return
+	}
+	usage = stats
+	usagePending = newUsageStats()
+	logDebug("使用统计已写入文件", "path", cfg.File)
+}
+
+// 记录一次代理传输，只统计成功的请求
+func recordUsage(target, rule string, status int, bytes int64) {
+	if status >= http.StatusBadRequest || !currentStatsConfig().Enabled {
+		return
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return
+	}
+	host := strings.ToLower(u.Hostname())
+
+	// 仓库来自URL规则的捕获组，git和api请求不计入文件统计
+	repo := ""
+	if matches := checkURL(target); len(matches) >= 2 {
+		repo = matches[0] + "/" + strings.TrimSuffix(matches[1], ".git")
+	}
+	file := ""
+	if rule != "git" && rule != "api" && rule != tunnelRuleLabel {
+		file = host + u.Path
+	}
+
+	now := time.Now()
+	delta := usageCounter{Requests: 1, Bytes: bytes}
+	usageLock.Lock()
+	usage.record(now, host, repo, file, delta)
+	usagePending.record(now, host, repo, file, delta)
+	usageLock.Unlock()
+}
+
+// 排行中的一项
+type rankedCounter struct {
+	name string
+	usageCounter
+}
+
+// 按请求数排序，请求数相同时按流量和名称排序
+func topCounters(counters map[string]*usageCounter, limit int) []rankedCounter {
+	items := make([]rankedCounter, 0, len(counters))
+	for name, counter := range counters {
+		items = append(items, rankedCounter{name, *counter})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Requests != items[j].Requests {
+			return items[i].Requests > items[j].Requests
+		}
+		if items[i].Bytes != items[j].Bytes {
+			return items[i].Bytes > items[j].Bytes
+		}
+		return items[i].name < items[j].name
+	})
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
+
+// 排行转换为接口返回的格式
+func rankedJSON(items []rankedCounter, key string) []gin.H {
+	result := make([]gin.H, 0, len(items))
+	for _, item := range items {
+		result = append(result, gin.H{key: item.name, "requests": item.Requests, "bytes": item.Bytes})
+	}
+	return result
+}
+
+// 解析正整数查询参数，无效时使用默认值
+func queryInt(c *gin.Context, key string, defaultValue, maxValue int) int {
+	value, err := strconv.Atoi(c.Query(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	if maxValue > 0 && value > maxValue {
+		return maxValue
+	}
+	return value
+}
+
+// 最近若干天的计数，days为0时返回全部时间的计数
+func recentCounters(days int, allTime map[string]*usageCounter, daily func(*usageBucket) map[string]*usageCounter) map[string]*usageCounter {
+	if days <= 0 {
+		return allTime
+	}
+	cutoff := startOfDay(time.Now()).AddDate(0, 0, -(days - 1)).Unix()
+	counters := map[string]*usageCounter{}
+	for start, bucket := range usage.Daily {
+		if start >= cutoff {
+			mergeCounters(counters, daily(bucket))
+		}
+	}
+	return counters
+}
+
+// 统计概览
+func getStats(c *gin.Context) {
+	usageLock.Lock()
+	defer usageLock.Unlock()
+	c.JSON(http.StatusOK, gin.H{
+		"since":    usage.Since,
+		"requests": usage.Total.Requests,
+		"bytes":    usage.Total.Bytes,
+		"repos":    rankedJSON(topCounters(usage.Repos, defaultStatsLimit), "repo"),
+		"hosts":    rankedJSON(topCounters(usage.Hosts, defaultStatsLimit), "host"),
+	})
+}
+
+// 请求最多的仓库，days指定最近的天数
+func getTopRepos(c *gin.Context) {
+	limit := queryInt(c, "limit", defaultStatsLimit, maxStatsLimit)
+	days := queryInt(c, "days", 0, 0)
+
+	usageLock.Lock()
+	defer usageLock.Unlock()
+	counters := recentCounters(days, usage.Repos, func(b *usageBucket) map[string]*usageCounter { return b.Repos })
+	c.JSON(http.StatusOK, rankedJSON(topCounters(counters, limit), "repo"))
+}
+
+// 请求最多的域名，days指定最近的天数
+func getTopHosts(c *gin.Context) {
+	limit := queryInt(c, "limit", defaultStatsLimit, maxStatsLimit)
+	days := queryInt(c, "days", 0, 0)
+
+	usageLock.Lock()
+	defer usageLock.Unlock()
+	counters := recentCounters(days, usage.Hosts, func(b *usageBucket) map[string]*usageCounter { return b.Hosts })
+	c.JSON(http.StatusOK, rankedJSON(topCounters(counters, limit), "host"))
+}
+
+// 请求最多的文件
+func getTopFiles(c *gin.Context) {
+	limit := queryInt(c, "limit", defaultStatsLimit, maxStatsLimit)
+
+	usageLock.Lock()
+	defer usageLock.Unlock()
+	c.JSON(http.StatusOK, rankedJSON(topCounters(usage.Files, limit), "file"))
+}
+
+// 按小时或按天的流量，可按域名筛选
+func getTraffic(c *gin.Context) {
+	interval := c.DefaultQuery("interval", "hour")
+	host := strings.ToLower(c.Query("host"))
+
+	usageLock.Lock()
+	defer usageLock.Unlock()
+
+	var buckets map[int64]*usageBucket
+	switch interval {
+	case "hour":
+		buckets = usage.Hourly
+	case "day":
+		buckets = usage.Daily
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval只能为hour或day"})
+		return
+	}
+
+	starts := make([]int64, 0, len(buckets))
+	for start := range buckets {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	result := make([]gin.H, 0, len(starts))
+	for _, start := range starts {
+		counter := buckets[start].usageCounter
+		if host != "" {
+			counter = usageCounter{}
+			if hostCounter, ok := buckets[start].Hosts[host]; ok {
+				counter = *hostCounter
+			}
+		}
+		result = append(result, gin.H{
+			"start":    time.Unix(start, 0),
+			"requests": counter.Requests,
+			"bytes":    counter.Bytes,
+		})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// 填充使用统计配置的默认值
+func fillStatsDefaults(stats *StatsConfig) bool {
+	defaults := defaultConfig.Stats
+	// 逐项填充，已配置的enabled保持不变
+	updated := false
+	if stats.File == "" {
+		stats.File = defaults.File
+		updated = true
+	}
+	if stats.FlushInterval <= 0 {
+		stats.FlushInterval = defaults.FlushInterval
+		updated = true
+	}
+	if stats.HourlyRetention <= 0 {
+		stats.HourlyRetention = defaults.HourlyRetention
+		updated = true
+	}
+	if stats.DailyRetention <= 0 {
+		stats.DailyRetention = defaults.DailyRetention
+		updated = true
+	}
+	if stats.MaxFiles <= 0 {
+		stats.MaxFiles = defaults.MaxFiles
+		updated = true
+	}
+	return updated
+}
+
+// 校验使用统计配置
+func validateStatsConfig(cfg *Config) error {
+	if cfg.Stats.Enabled && cfg.Stats.File == "" {
+		return &configValidationError{"stats.file", "统计文件路径不能为空"}
+	}
+	if cfg.Stats.FlushInterval <= 0 {
+		return &configValidationError{"stats.flushInterval", "写入间隔必须大于0"}
+	}
+	if cfg.Stats.HourlyRetention <= 0 {
+		return &configValidationError{"stats.hourlyRetention", "按小时统计的保留时间必须大于0"}
+	}
+	if cfg.Stats.DailyRetention <= 0 {
+		return &configValidationError{"stats.dailyRetention", "按天统计的保留时间必须大于0"}
+	}
+	if cfg.Stats.MaxFiles <= 0 {
+		return &configValidationError{"stats.maxFiles", "文件统计的最大数量必须大于0"}
+	}
+	return nil
+}
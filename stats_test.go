@@ -0,0 +1,238 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 在测试期间使用独立的使用统计
+func resetUsageStats(t *testing.T) {
+	t.Helper()
+	usageLock.Lock()
+	oldUsage, oldPending := usage, usagePending
+	usage, usagePending = newUsageStats(), newUsageStats()
+	usageLock.Unlock()
+	t.Cleanup(func() {
+		usageLock.Lock()
+		usage, usagePending = oldUsage, oldPending
+		usageLock.Unlock()
+	})
+}
+
+func TestUsageStatsRecordAndMerge(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)
+	a := newUsageStats()
+	a.record(now, "github.com", "a/b", "github.com/a/b/f.zip", usageCounter{1, 100})
+	a.record(now.Add(time.Hour), "github.com", "", "", usageCounter{1, 10})
+
+	if a.Total != (usageCounter{2, 110}) || *a.Hosts["github.com"] != (usageCounter{2, 110}) {
+		t.Errorf("总计 = %+v, %+v", a.Total, *a.Hosts["github.com"])
+	}
+	if len(a.Repos) != 1 || len(a.Files) != 1 {
+		t.Errorf("空的仓库和文件不应计入: %v, %v", a.Repos, a.Files)
+	}
+	if len(a.Hourly) != 2 || len(a.Daily) != 1 {
+		t.Fatalf("汇总数量 = %d, %d, want 2, 1", len(a.Hourly), len(a.Daily))
+	}
+	daily := a.Daily[startOfDay(now).Unix()]
+	if daily.usageCounter != (usageCounter{2, 110}) || *daily.Repos["a/b"] != (usageCounter{1, 100}) {
+		t.Errorf("按天汇总 = %+v", daily)
+	}
+
+	b := newUsageStats()
+	b.Since = now.Add(-time.Hour)
+	b.record(now, "gitlab.com", "c/d", "", usageCounter{1, 1})
+	a.merge(b)
+	if a.Total != (usageCounter{3, 111}) || !a.Since.Equal(b.Since) {
+		t.Errorf("合并后 = %+v, since %v", a.Total, a.Since)
+	}
+	if daily := a.Daily[startOfDay(now).Unix()]; len(daily.Hosts) != 2 || len(daily.Repos) != 2 {
+		t.Errorf("合并后的按天汇总 = %+v", daily)
+	}
+}
+
+func TestUsageStatsPrune(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.Local)
+	stats := newUsageStats()
+	stats.record(now, "github.com", "", "a", usageCounter{3, 0})
+	stats.record(now.Add(-5*time.Hour), "github.com", "", "b", usageCounter{2, 0})
+	stats.record(now.AddDate(0, 0, -3), "github.com", "", "c", usageCounter{1, 0})
+
+	stats.prune(StatsConfig{HourlyRetention: 4, DailyRetention: 2, MaxFiles: 2}, now)
+	if len(stats.Hourly) != 1 {
+		t.Errorf("按小时汇总数量 = %d, want 1", len(stats.Hourly))
+	}
+	if len(stats.Daily) != 1 {
+		t.Errorf("按天汇总数量 = %d, want 1", len(stats.Daily))
+	}
+	var files []string
+	for _, item := range topCounters(stats.Files, 0) {
+		files = append(files, item.name)
+	}
+	if !reflect.DeepEqual(files, []string{"a", "b"}) {
+		t.Errorf("保留的文件 = %v, want [a b]", files)
+	}
+}
+
+func TestTopCounters(t *testing.T) {
+	counters := map[string]*usageCounter{
+		"a": {1, 100},
+		"b": {2, 0},
+		"c": {1, 200},
+		"d": {1, 100},
+	}
+	tests := []struct {
+		limit int
+		want  []string
+	}{
+		{0, []string{"b", "c", "a", "d"}},
+		{2, []string{"b", "c"}},
+		{10, []string{"b", "c", "a", "d"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, item := range topCounters(counters, tt.limit) {
+			got = append(got, item.name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("topCounters(%d) = %v, want %v", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestUsageStatsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "stats.json")
+	stats, err := readUsageStats(path)
+	if err != nil || stats.Total.Requests != 0 {
+		t.Fatalf("文件不存在时应返回空统计: %v", err)
+	}
+
+	stats.record(time.Now(), "github.com", "a/b", "github.com/a/b/f", usageCounter{1, 100})
+	if err := writeUsageStats(path, stats); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readUsageStats(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Total != stats.Total || !reflect.DeepEqual(got.Repos, stats.Repos) || len(got.Daily) != 1 {
+		t.Errorf("读取的统计 = %+v, want %+v", got, stats)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"version":2}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readUsageStats(path); err == nil {
+		t.Error("文件版本不同时应返回错误")
+	}
+}
+
+func TestFlushStatsMergesFile(t *testing.T) {
+	resetUsageStats(t)
+	cfg := testConfig()
+	cfg.Stats.Enabled = true
+	cfg.Stats.File = filepath.Join(t.TempDir(), "stats.json")
+	setTestConfig(t, cfg)
+
+	// 其他进程已写入的统计
+	other := newUsageStats()
+	other.record(time.Now(), "github.com", "a/b", "", usageCounter{2, 200})
+	if err := writeUsageStats(cfg.Stats.File, other); err != nil {
+		t.Fatal(err)
+	}
+
+	recordUsage("https://github.com/a/b/archive/main.zip", "archive", 200, 100)
+	recordUsage("https://github.com/a/b/archive/main.zip", "archive", 404, 100)
+	flushStats()
+
+	stats, err := readUsageStats(cfg.Stats.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total != (usageCounter{3, 300}) || *stats.Repos["a/b"] != (usageCounter{3, 300}) {
+		t.Errorf("写入的统计 = %+v, repos %v", stats.Total, stats.Repos)
+	}
+	if usagePending.Total.Requests != 0 || usage.Total != stats.Total {
+		t.Errorf("写入后增量应清空: pending %+v, usage %+v", usagePending.Total, usage.Total)
+	}
+}
+
+func TestFlushStatsKeepsPendingOnReadError(t *testing.T) {
+	resetUsageStats(t)
+	cfg := testConfig()
+	cfg.Stats.Enabled = true
+	cfg.Stats.File = filepath.Join(t.TempDir(), "stats.json")
+	setTestConfig(t, cfg)
+
+	// 统计文件损坏时不应使用内存中的统计覆盖
+	if err := os.WriteFile(cfg.Stats.File, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	recordUsage("https://github.com/a/b/archive/main.zip", "archive", 200, 100)
+	flushStats()
+
+	data, err := os.ReadFile(cfg.Stats.File)
+	if err != nil || string(data) != "{" {
+		t.Errorf("读取失败时不应写入文件: %q, %v", data, err)
+	}
+	if usagePending.Total != (usageCounter{1, 100}) {
+		t.Errorf("读取失败时应保留增量: %+v", usagePending.Total)
+	}
+}
+
+func TestFillStatsDefaults(t *testing.T) {
+	// 关闭使用统计时只填充缺少的字段，不应重新开启
+	stats := StatsConfig{Enabled: false}
+	if !fillStatsDefaults(&stats) {
+		t.Error("缺少字段时应返回true")
+	}
+	want := defaultConfig.Stats
+	want.Enabled = false
+	if stats != want {
+		t.Errorf("fillStatsDefaults() = %+v, want %+v", stats, want)
+	}
+
+	stats = StatsConfig{Enabled: true, FlushInterval: 10}
+	fillStatsDefaults(&stats)
+	if !stats.Enabled || stats.FlushInterval != 10 || stats.File != defaultConfig.Stats.File {
+		t.Errorf("应只填充缺少的字段: %+v", stats)
+	}
+	if fillStatsDefaults(&stats) {
+		t.Error("没有缺少的字段时应返回false")
+	}
+}
+
+func TestValidateStatsConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    func(stats *StatsConfig)
+		wantField string
+	}{
+		{"默认配置", func(stats *StatsConfig) {}, ""},
+		{"文件路径为空", func(stats *StatsConfig) {
+			stats.Enabled = true
+			stats.File = ""
+		}, "stats.file"},
+		{"写入间隔为0", func(stats *StatsConfig) { stats.FlushInterval = 0 }, "stats.flushInterval"},
+		{"按小时保留时间为0", func(stats *StatsConfig) { stats.HourlyRetention = 0 }, "stats.hourlyRetention"},
+		{"按天保留时间为0", func(stats *StatsConfig) { stats.DailyRetention = 0 }, "stats.dailyRetention"},
+		{"文件数量为0", func(stats *StatsConfig) { stats.MaxFiles = 0 }, "stats.maxFiles"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			tt.modify(&cfg.Stats)
+			err := validateStatsConfig(cfg)
+			field := ""
+			if validationErr, ok := err.(*configValidationError); ok {
+				field = validationErr.Field
+			}
+			if field != tt.wantField {
+				t.Errorf("validateStatsConfig() = %v, want field %q", err, tt.wantField)
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// 当前平台不支持syslog
+const syslogSupported = false
+
+func newSyslogWriter(tag string) (logWriter, error) {
+	return nil, errors.New("当前系统不支持syslog")
+}
@@ -0,0 +1,38 @@
+//go:build unix
+
+package main
+
+import "log/syslog"
+
+// 当前平台支持syslog
+const syslogSupported = true
+
+// 写入本地syslog，级别映射为syslog的优先级
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+func newSyslogWriter(tag string) (logWriter, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogWriter{w: w}, nil
+}
+
+func (s *syslogWriter) writeLog(level logLevel, line []byte) error {
+	msg := string(line)
+	switch level {
+	case levelDebug:
+		return s.w.Debug(msg)
+	case levelWarn:
+		return s.w.Warning(msg)
+	case levelError:
+		return s.w.Err(msg)
+	}
+	return s.w.Info(msg)
+}
+
+func (s *syslogWriter) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 上报请求的超时时间
+	telemetryTimeout = 10 * time.Second
+	// 最短上报间隔（秒）
+	minTelemetryInterval = 60
+)
+
+// 上报使用独立的客户端，不经过出站代理和规则配置
+var telemetryClient = &http.Client{Timeout: telemetryTimeout}
+
+// 上报的匿名使用统计，只包含汇总的计数，不包含地址、仓库、客户端等信息
+type telemetryReport struct {
+	UUID          string `json:"uuid"`
+	Version       string `json:"version"`
+	Uptime        int64  `json:"uptime"`        // 运行时间（秒）
+	Requests      int64  `json:"requests"`      // 启动以来的代理请求数
+	RequestBytes  int64  `json:"requestBytes"`  // 启动以来接收客户端的字节数
+	ResponseBytes int64  `json:"responseBytes"` // 启动以来发送给客户端的字节数
+}
+
+// 生成当前的上报内容
+func buildTelemetryReport() telemetryReport {
+	configLock.RLock()
+	uuid := config.UUID
+	configLock.RUnlock()
+
+	return telemetryReport{
+		UUID:          uuid,
+		Version:       version,
+		Uptime:        int64(time.Since(startTime).Seconds()),
+		Requests:      int64(requestsTotal.total()),
+		RequestBytes:  int64(requestBytesTotal.total()),
+		ResponseBytes: int64(responseBytesTotal.total()),
+	}
+}
+
+// 定期上报匿名使用统计，未启用时只检查配置
+func autoReportTelemetry() {
+	for {
+		configLock.RLock()
+		cfg := config.Telemetry
+		configLock.RUnlock()
+
+		if !cfg.Enabled {
+			time.Sleep(minTelemetryInterval * time.Second)
+			continue
+		}
+		time.Sleep(time.Duration(cfg.Interval) * time.Second)
+
+		// 等待期间可能已关闭上报或修改了地址
+		configLock.RLock()
+		cfg = config.Telemetry
+		configLock.RUnlock()
+		if !cfg.Enabled {
+			continue
+		}
+		if err := sendTelemetry(cfg.Endpoint, buildTelemetryReport()); err != nil {
+			logWarn("上报使用统计失败", "endpoint", cfg.Endpoint, "error", err)
+		} else {
+			logDebug("使用统计已上报", "endpoint", cfg.Endpoint)
+		}
+	}
+}
+
+// 以JSON格式POST上报内容
+func sendTelemetry(endpoint string, report telemetryReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "FastCode/"+version)
+	resp, err := telemetryClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("服务器返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// 预览上报的内容，与实际发送的请求体相同
+func getTelemetryPreview(c *gin.Context) {
+	configLock.RLock()
+	cfg := config.Telemetry
+	configLock.RUnlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":  cfg.Enabled,
+		"interval": cfg.Interval,
+		"payload":  buildTelemetryReport(),
+	})
+}
+
+// 填充上报配置的默认值
+func fillTelemetryDefaults(telemetry *TelemetryConfig) bool {
+	if telemetry.Interval == 0 {
+		telemetry.Interval = defaultConfig.Telemetry.Interval
+		return true
+	}
+	return false
+}
+
+// 校验上报配置，启用时必须配置上报地址
+func validateTelemetryConfig(cfg *Config) error {
+	if cfg.Telemetry.Interval < minTelemetryInterval {
+		return &configValidationError{"telemetry.interval", fmt.Sprintf("上报间隔不能小于%d秒", minTelemetryInterval)}
+	}
+	if !cfg.Telemetry.Enabled && cfg.Telemetry.Endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(cfg.Telemetry.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &configValidationError{"telemetry.endpoint", fmt.Sprintf("上报地址无效: %s", cfg.Telemetry.Endpoint)}
+	}
+	return nil
+}
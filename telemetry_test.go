@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSendTelemetry(t *testing.T) {
+	setTestConfig(t, testConfig())
+	var body []byte
+	var contentType string
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		contentType = r.Header.Get("Content-Type")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	report := buildTelemetryReport()
+	if err := sendTelemetry(server.URL, report); err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+
+	// 只上报汇总的计数
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	want := []string{"requestBytes", "requests", "responseBytes", "uptime", "uuid", "version"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("上报的字段 = %v, want %v", keys, want)
+	}
+	if fields["uuid"] != "00000000-0000-0000-0000-000000000000" {
+		t.Errorf("uuid = %v", fields["uuid"])
+	}
+
+	status = http.StatusInternalServerError
+	if err := sendTelemetry(server.URL, report); err == nil {
+		t.Error("服务器返回错误时应返回错误")
+	}
+}
+
+func TestValidateTelemetryConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		telemetry TelemetryConfig
+		wantField string
+	}{
+		{"未启用", TelemetryConfig{Interval: 86400}, ""},
+		{"启用", TelemetryConfig{Enabled: true, Endpoint: "https://telemetry.example.com/report", Interval: 3600}, ""},
+		{"启用时缺少地址", TelemetryConfig{Enabled: true, Interval: 3600}, "telemetry.endpoint"},
+		{"未启用时地址无效", TelemetryConfig{Endpoint: "telemetry.example.com", Interval: 3600}, "telemetry.endpoint"},
+		{"地址协议无效", TelemetryConfig{Enabled: true, Endpoint: "ftp://telemetry.example.com", Interval: 3600}, "telemetry.endpoint"},
+		{"上报间隔过短", TelemetryConfig{Enabled: true, Endpoint: "https://telemetry.example.com/report", Interval: 59}, "telemetry.interval"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Telemetry = tt.telemetry
+			err := validateTelemetryConfig(cfg)
+			field := ""
+			if validationErr, ok := err.(*configValidationError); ok {
+				field = validationErr.Field
+			}
+			if field != tt.wantField {
+				t.Errorf("validateTelemetryConfig() = %v, want field %q", err, tt.wantField)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 使用默认值填充未配置的超时项，返回是否有更新
+func fillTimeoutDefaults(timeouts *TimeoutsConfig) bool {
+	defaults := defaultConfig.Timeouts
+	updated := false
+	fill := func(value *int64, defaultValue int64) {
+		if *value <= 0 {
+			*value = defaultValue
+			updated = true
+		}
+	}
+	fill(&timeouts.Dial, defaults.Dial)
+	fill(&timeouts.TLSHandshake, defaults.TLSHandshake)
+	fill(&timeouts.ResponseHeader, defaults.ResponseHeader)
+	fill(&timeouts.IdleRead, defaults.IdleRead)
+	fill(&timeouts.ServerReadHeader, defaults.ServerReadHeader)
+	fill(&timeouts.ServerIdle, defaults.ServerIdle)
+	if timeouts.MaxHeaderBytes <= 0 {
+		timeouts.MaxHeaderBytes = defaults.MaxHeaderBytes
+		updated = true
+	}
+	return updated
+}
+
+// 校验超时配置
+func validateTimeoutsConfig(cfg *Config) error {
+	positive := []struct {
+		field string
+		value int64
+	}{
+		{"timeouts.dial", cfg.Timeouts.Dial},
+		{"timeouts.tlsHandshake", cfg.Timeouts.TLSHandshake},
+		{"timeouts.responseHeader", cfg.Timeouts.ResponseHeader},
+		{"timeouts.idleRead", cfg.Timeouts.IdleRead},
+		{"timeouts.serverReadHeader", cfg.Timeouts.ServerReadHeader},
+		{"timeouts.serverIdle", cfg.Timeouts.ServerIdle},
+		{"timeouts.maxHeaderBytes", int64(cfg.Timeouts.MaxHeaderBytes)},
+	}
+	for _, item := range positive {
+		if item.value <= 0 {
+			return &configValidationError{item.field, "必须大于0"}
+		}
+	}
+	if cfg.Timeouts.ServerRead < 0 {
+		return &configValidationError{"timeouts.serverRead", "不能为负数"}
+	}
+	if cfg.Timeouts.ServerWrite < 0 {
+		return &configValidationError{"timeouts.serverWrite", "不能为负数"}
+	}
+	for name, rule := range cfg.Rules {
+		if rule.Timeout < 0 {
+			return &configValidationError{"rules." + name + ".timeout", fmt.Sprintf("不能为负数: %d", rule.Timeout)}
+		}
+	}
+	return nil
+}
+
+// 为HTTP服务设置超时和请求头大小限制
+func applyServerTimeouts(server *http.Server) {
+	configLock.RLock()
+	timeouts := config.Timeouts
+	configLock.RUnlock()
+
+	server.ReadHeaderTimeout = seconds(timeouts.ServerReadHeader)
+	server.ReadTimeout = seconds(timeouts.ServerRead)
+	server.WriteTimeout = seconds(timeouts.ServerWrite)
+	server.IdleTimeout = seconds(timeouts.ServerIdle)
+	server.MaxHeaderBytes = timeouts.MaxHeaderBytes
+}
+
+// 限制两次读取到数据之间间隔的响应体
+type idleTimeoutReader struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	// 隧道另一方向的读取，读到数据时一并重新计时
+	peer *idleTimeoutReader
+
+	mu      sync.Mutex
+	expired bool
+}
+
+// 为响应体设置空闲读取超时，超时后关闭响应体使读取立即失败
+func withIdleTimeout(body io.ReadCloser, timeout time.Duration) io.ReadCloser {
+	if timeout <= 0 {
+		return body
+	}
+	r := &idleTimeoutReader{body: body, timeout: timeout}
+	r.timer = time.AfterFunc(timeout, func() {
+		r.mu.Lock()
+		r.expired = true
+		r.mu.Unlock()
+		body.Close()
+	})
+	return r
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if err != nil {
+		r.timer.Stop()
+		r.mu.Lock()
+		expired := r.expired
+		r.mu.Unlock()
+		if expired {
+			return n, fmt.Errorf("超过 %v 未收到上游数据", r.timeout)
+		}
+		return n, err
+	}
+	r.timer.Reset(r.timeout)
+	if r.peer != nil {
+		r.peer.timer.Reset(r.peer.timeout)
+	}
+	return n, nil
+}
+
+// 为隧道的两个方向设置空闲超时，任一方向有数据都会重新计时，
+// 只有两个方向都超过timeout没有数据时才关闭连接
+func withTunnelIdleTimeout(a, b io.ReadCloser, timeout time.Duration) (io.ReadCloser, io.ReadCloser) {
+	if timeout <= 0 {
+		return a, b
+	}
+	ra := withIdleTimeout(a, timeout).(*idleTimeoutReader)
+	rb := withIdleTimeout(b, timeout).(*idleTimeoutReader)
+	ra.peer, rb.peer = rb, ra
+	return ra, rb
+}
+
+func (r *idleTimeoutReader) Close() error {
+	r.timer.Stop()
+	return r.body.Close()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFillTimeoutDefaults(t *testing.T) {
+	timeouts := TimeoutsConfig{Dial: 3, ServerWrite: 0}
+	if !fillTimeoutDefaults(&timeouts) {
+		t.Fatal("填充默认值后应返回true")
+	}
+	want := defaultConfig.Timeouts
+	want.Dial = 3
+	if timeouts != want {
+		t.Errorf("timeouts = %+v, want %+v", timeouts, want)
+	}
+	if fillTimeoutDefaults(&timeouts) {
+		t.Error("已全部配置时应返回false")
+	}
+}
+
+func TestValidateTimeoutsConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    func(cfg *Config)
+		wantField string
+	}{
+		{"默认配置", func(cfg *Config) {}, ""},
+		{"不限制读写时间", func(cfg *Config) { cfg.Timeouts.ServerRead, cfg.Timeouts.ServerWrite = 0, 0 }, ""},
+		{"连接超时为0", func(cfg *Config) { cfg.Timeouts.Dial = 0 }, "timeouts.dial"},
+		{"空闲读取超时为负数", func(cfg *Config) { cfg.Timeouts.IdleRead = -1 }, "timeouts.idleRead"},
+		{"请求头大小为0", func(cfg *Config) { cfg.Timeouts.MaxHeaderBytes = 0 }, "timeouts.maxHeaderBytes"},
+		{"读取超时为负数", func(cfg *Config) { cfg.Timeouts.ServerRead = -1 }, "timeouts.serverRead"},
+		{"写入超时为负数", func(cfg *Config) { cfg.Timeouts.ServerWrite = -1 }, "timeouts.serverWrite"},
+		{"规则超时为负数", func(cfg *Config) { cfg.Rules = map[string]RuleConfig{"raw": {Timeout: -1}} }, "rules.raw.timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			tt.modify(cfg)
+			err := validateTimeoutsConfig(cfg)
+			field := ""
+			if validationErr, ok := err.(*configValidationError); ok {
+				field = validationErr.Field
+			}
+			if field != tt.wantField {
+				t.Errorf("validateTimeoutsConfig() = %v, want field %q", err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestIdleTimeoutReader(t *testing.T) {
+	// 正常读取不受超时影响
+	body := withIdleTimeout(io.NopCloser(strings.NewReader("content")), time.Second)
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil || string(data) != "content" {
+		t.Fatalf("ReadAll() = %q, %v", data, err)
+	}
+
+	// 上游长时间没有数据时读取失败
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	body = withIdleTimeout(pr, 100*time.Millisecond)
+	defer body.Close()
+	start := time.Now()
+	if _, err := body.Read(make([]byte, 1)); err == nil || !strings.Contains(err.Error(), "未收到上游数据") {
+		t.Errorf("Read() error = %v, want 空闲超时", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("超时后未及时返回: %v", elapsed)
+	}
+
+	if withIdleTimeout(pr, 0) != pr {
+		t.Error("超时为0时不应包装响应体")
+	}
+}
+
+func TestTunnelIdleTimeout(t *testing.T) {
+	upR, upW := io.Pipe()
+	downR, downW := io.Pipe()
+	defer upW.Close()
+	defer downW.Close()
+	up, down := withTunnelIdleTimeout(upR, downR, 200*time.Millisecond)
+	defer up.Close()
+	defer down.Close()
+
+	// 只有下行方向有数据时，上行方向也不应超时
+	go func() {
+		for i := 0; i < 5; i++ {
+			downW.Write([]byte("x"))
+			time.Sleep(100 * time.Millisecond)
+		}
+	}()
+	upErr := make(chan error, 1)
+	go func() {
+		_, err := up.Read(make([]byte, 1))
+		upErr <- err
+	}()
+	for i := 0; i < 5; i++ {
+		if _, err := down.Read(make([]byte, 1)); err != nil {
+			t.Fatalf("down.Read() error = %v", err)
+		}
+	}
+	select {
+	case err := <-upErr:
+		t.Fatalf("另一方向有数据时上行读取提前结束: %v", err)
+	default:
+	}
+
+	// 两个方向都没有数据时关闭隧道
+	select {
+	case err := <-upErr:
+		if err == nil || !strings.Contains(err.Error(), "未收到上游数据") {
+			t.Errorf("up.Read() error = %v, want 空闲超时", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("隧道空闲后未关闭")
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 证书文件检查间隔
+const certificateCheckInterval = 30 * time.Second
+
+// TLS版本映射
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// 校验HTTPS配置
+func validateTLSConfig(cfg *Config) error {
+	if !cfg.TLS.Enabled {
+		return nil
+	}
+	if len(cfg.TLS.certificateFiles()) == 0 {
+		return &configValidationError{"tls.certFile", "启用HTTPS时必须配置证书和私钥文件"}
+	}
+	for _, file := range cfg.TLS.certificateFiles() {
+		if file.CertFile == "" || file.KeyFile == "" {
+			return &configValidationError{"tls.certificates", "证书和私钥文件必须成对配置"}
+		}
+	}
+	if _, ok := tlsVersions[cfg.TLS.MinVersion]; !ok {
+		return &configValidationError{"tls.minVersion", fmt.Sprintf("不支持的TLS版本: %s", cfg.TLS.MinVersion)}
+	}
+	if cfg.TLS.RedirectHTTP {
+		if cfg.TLS.RedirectPort <= 0 || cfg.TLS.RedirectPort > 65535 {
+			return &configValidationError{"tls.redirectPort", fmt.Sprintf("监听端口无效: %d", cfg.TLS.RedirectPort)}
+		}
+		for _, l := range cfg.Listeners {
+			if !isUnixAddress(l.Address) && listenerPort(l.Address) == cfg.TLS.RedirectPort {
+				return &configValidationError{"tls.redirectPort", fmt.Sprintf("HTTP跳转监听端口不能与监听 %s 的端口相同", l.Name)}
+			}
+		}
+	}
+	return nil
+}
+
+// 获取所有证书文件，默认证书排在最前
+func (c TLSConfig) certificateFiles() []TLSCertificateFile {
+	var files []TLSCertificateFile
+	if c.CertFile != "" || c.KeyFile != "" {
+		files = append(files, TLSCertificateFile{CertFile: c.CertFile, KeyFile: c.KeyFile})
+	}
+	return append(files, c.Certificates...)
+}
+
+// 证书存储，支持证书文件变化后自动重新加载
+type certificateStore struct {
+	mu           sync.RWMutex
+	files        []TLSCertificateFile
+	modTimes     []time.Time
+	certificates []*tls.Certificate
+}
+
+// 加载证书
+func (s *certificateStore) load(files []TLSCertificateFile) error {
+	certificates := make([]*tls.Certificate, 0, len(files))
+	modTimes := make([]time.Time, 0, len(files))
+	for _, file := range files {
+		certificate, err := tls.LoadX509KeyPair(file.CertFile, file.KeyFile)
+		if err != nil {
+			return fmt.Errorf("加载证书 %s 失败: %v", file.CertFile, err)
+		}
+		certificates = append(certificates, &certificate)
+		modTimes = append(modTimes, certificateModTime(file))
+	}
+	if len(certificates) == 0 {
+		return errors.New("未配置证书")
+	}
+
+	s.mu.Lock()
+	s.files = files
+	s.modTimes = modTimes
+	s.certificates = certificates
+	s.mu.Unlock()
+	return nil
+}
+
+// 获取证书和私钥文件中较新的修改时间
+func certificateModTime(file TLSCertificateFile) time.Time {
+	var latest time.Time
+	for _, path := range []string{file.CertFile, file.KeyFile} {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// 判断证书是否需要重新加载
+func (s *certificateStore) changed(files []TLSCertificateFile) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(files) != len(s.files) {
+		return true
+	}
+	for i, file := range files {
+		if file != s.files[i] || !certificateModTime(file).Equal(s.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// 根据SNI选择证书，没有匹配时使用默认证书
+func (s *certificateStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, certificate := range s.certificates {
+		if hello.SupportsCertificate(certificate) == nil {
+			return certificate, nil
+		}
+	}
+	return s.certificates[0], nil
+}
+
+// 定期检查证书文件和配置，发生变化时重新加载
+func (s *certificateStore) watch() {
+	ticker := time.NewTicker(certificateCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		configLock.RLock()
+		files := config.TLS.certificateFiles()
+		configLock.RUnlock()
+
+		// 运行时关闭HTTPS或清空证书配置需要重启后生效
+		if len(files) == 0 || !s.changed(files) {
+			continue
+		}
+		if err := s.load(files); err != nil {
+			logError("重新加载证书失败，继续使用当前证书", "error", err)
+			continue
+		}
+		logInfo("证书已重新加载")
+	}
+}
+
+// 创建TLS配置
+func newTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	store := &certificateStore{}
+	if err := store.load(cfg.certificateFiles()); err != nil {
+		return nil, err
+	}
+	go store.watch()
+
+	return &tls.Config{
+		MinVersion:     tlsVersions[cfg.MinVersion],
+		GetCertificate: store.getCertificate,
+	}, nil
+}
+
+// 启动HTTP跳转HTTPS监听
+func startHTTPSRedirect(host string, redirectPort, httpsPort int64) {
+	addr := net.JoinHostPort(host, strconv.FormatInt(redirectPort, 10))
+	redirectServer := &http.Server{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			target := r.Host
+			if h, _, err := net.SplitHostPort(target); err == nil {
+				target = h
+			}
+			target = strings.Trim(target, "[]")
+			if httpsPort != 443 {
+				target = net.JoinHostPort(target, strconv.FormatInt(httpsPort, 10))
+			} else if strings.Contains(target, ":") {
+				target = "[" + target + "]"
+			}
+			http.Redirect(w, r, "https://"+target+r.URL.RequestURI(), http.StatusMovedPermanently)
+		}),
+	}
+
+	applyServerTimeouts(redirectServer)
+
+	logInfo("HTTP跳转服务启动成功", "address", addr)
+	startServer(redirectServer, false)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 生成自签名证书并写入临时目录
+func writeTestCertificate(t *testing.T, dir, name string, dnsNames ...string) TLSCertificateFile {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := TLSCertificateFile{CertFile: filepath.Join(dir, name+".crt"), KeyFile: filepath.Join(dir, name+".key")}
+	if err := os.WriteFile(file.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestValidateTLSConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		tls       TLSConfig
+		wantField string
+	}{
+		{"未启用", TLSConfig{}, ""},
+		{"默认证书", TLSConfig{Enabled: true, CertFile: "a.crt", KeyFile: "a.key", MinVersion: "1.2"}, ""},
+		{"只有SNI证书", TLSConfig{Enabled: true, Certificates: []TLSCertificateFile{{"a.crt", "a.key"}}, MinVersion: "1.3"}, ""},
+		{"没有证书", TLSConfig{Enabled: true, MinVersion: "1.2"}, "tls.certFile"},
+		{"缺少私钥", TLSConfig{Enabled: true, CertFile: "a.crt", MinVersion: "1.2"}, "tls.certificates"},
+		{"SNI证书缺少私钥", TLSConfig{Enabled: true, CertFile: "a.crt", KeyFile: "a.key", Certificates: []TLSCertificateFile{{CertFile: "b.crt"}}, MinVersion: "1.2"}, "tls.certificates"},
+		{"TLS版本无效", TLSConfig{Enabled: true, CertFile: "a.crt", KeyFile: "a.key", MinVersion: "1.4"}, "tls.minVersion"},
+		{"跳转端口无效", TLSConfig{Enabled: true, CertFile: "a.crt", KeyFile: "a.key", MinVersion: "1.2", RedirectHTTP: true}, "tls.redirectPort"},
+		{"跳转端口与监听相同", TLSConfig{Enabled: true, CertFile: "a.crt", KeyFile: "a.key", MinVersion: "1.2", RedirectHTTP: true, RedirectPort: 8080}, "tls.redirectPort"},
+		{"跳转端口", TLSConfig{Enabled: true, CertFile: "a.crt", KeyFile: "a.key", MinVersion: "1.2", RedirectHTTP: true, RedirectPort: 80}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Listeners = []ListenerConfig{{Name: "default", Address: ":8080"}}
+			cfg.TLS = tt.tls
+			err := validateTLSConfig(cfg)
+			field := ""
+			if validationErr, ok := err.(*configValidationError); ok {
+				field = validationErr.Field
+			} else if err != nil {
+				t.Fatalf("validateTLSConfig() = %v", err)
+			}
+			if field != tt.wantField {
+				t.Errorf("validateTLSConfig() field = %q, want %q", field, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestCertificateStoreGetCertificate(t *testing.T) {
+	dir := t.TempDir()
+	files := []TLSCertificateFile{
+		writeTestCertificate(t, dir, "default", "default.example"),
+		writeTestCertificate(t, dir, "mirror", "mirror.example", "*.mirror.example"),
+	}
+	store := &certificateStore{}
+	if err := store.load(files); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		serverName string
+		want       string
+	}{
+		{"default.example", "default.example"},
+		{"mirror.example", "mirror.example"},
+		{"cdn.mirror.example", "mirror.example"},
+		{"other.example", "default.example"},
+		{"", "default.example"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.serverName, func(t *testing.T) {
+			hello := &tls.ClientHelloInfo{
+				ServerName:        tt.serverName,
+				SupportedVersions: []uint16{tls.VersionTLS13},
+				SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+			}
+			certificate, err := store.getCertificate(hello)
+			if err != nil {
+				t.Fatal(err)
+			}
+			leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if leaf.Subject.CommonName != tt.want {
+				t.Errorf("getCertificate(%q) = %s, want %s", tt.serverName, leaf.Subject.CommonName, tt.want)
+			}
+		})
+	}
+}
+
+func TestCertificateStoreChanged(t *testing.T) {
+	dir := t.TempDir()
+	file := writeTestCertificate(t, dir, "default", "default.example")
+	store := &certificateStore{}
+	if err := store.load([]TLSCertificateFile{file}); err != nil {
+		t.Fatal(err)
+	}
+	if store.changed([]TLSCertificateFile{file}) {
+		t.Error("证书文件未变化")
+	}
+
+	other := writeTestCertificate(t, dir, "other", "other.example")
+	if !store.changed([]TLSCertificateFile{file, other}) {
+		t.Error("增加证书后应重新加载")
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file.KeyFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !store.changed([]TLSCertificateFile{file}) {
+		t.Error("私钥文件更新后应重新加载")
+	}
+}
+
+func TestCertificateStoreLoadError(t *testing.T) {
+	dir := t.TempDir()
+	file := writeTestCertificate(t, dir, "default", "default.example")
+	store := &certificateStore{}
+	if err := store.load([]TLSCertificateFile{file}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 加载失败时保留之前的证书
+	missing := TLSCertificateFile{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: filepath.Join(dir, "missing.key")}
+	if err := store.load([]TLSCertificateFile{missing}); err == nil {
+		t.Fatal("应返回错误")
+	}
+	if err := store.load(nil); err == nil {
+		t.Fatal("没有证书时应返回错误")
+	}
+	if len(store.certificates) != 1 || store.files[0] != file {
+		t.Errorf("加载失败后证书被修改: %+v", store.files)
+	}
+}
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	mathrand "math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// W3C Trace Context请求头
+	traceparentHeader = "traceparent"
+
+	// span类型，与OTLP中的取值一致
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+
+	// span状态，与OTLP中的取值一致
+	spanStatusError = 2
+
+	// 上报间隔
+	traceExportInterval = 5 * time.Second
+	// 上报请求的超时时间
+	traceExportTimeout = 10 * time.Second
+	// 单次上报的最大span数
+	traceExportBatchSize = 512
+	// 等待上报的最大span数，收集器不可用时丢弃超出的span
+	maxPendingSpans = 8192
+
+	// 默认的OTLP/HTTP接收地址
+	defaultTracingEndpoint = "http://127.0.0.1:4318/v1/traces"
+)
+
+// span的属性
+type spanAttr struct {
+	key   string
+	value interface{}
+}
+
+// 一段被追踪的操作
+type span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	sampled  bool
+	name     string
+	kind     int
+	start    time.Time
+
+	mu       sync.Mutex
+	end      time.Time
+	attrs    []spanAttr
+	errorMsg string
+}
+
+type spanContextKey struct{}
+
+var (
+	// 等待上报的span
+	pendingSpans     []*span
+	droppedSpans     int64
+	pendingSpansLock sync.Mutex
+
+	// 当前的追踪配置
+	tracingConfig     TracingConfig
+	tracingConfigLock sync.RWMutex
+
+	// 上报使用独立的客户端，不经过出站代理和规则配置
+	traceExportClient = &http.Client{Timeout: traceExportTimeout}
+)
+
+// 按配置更新追踪设置
+func refreshTracing(cfg *Config) {
+	tracingConfigLock.Lock()
+	tracingConfig = cfg.Tracing
+	tracingConfigLock.Unlock()
+}
+
+func currentTracingConfig() TracingConfig {
+	tracingConfigLock.RLock()
+	defer tracingConfigLock.RUnlock()
+	return tracingConfig
+}
+
+// 获取上下文中的span
+func spanFromContext(ctx context.Context) *span {
+	s, _ := ctx.Value(spanContextKey{}).(*span)
+	return s
+}
+
+// 生成随机ID
+func randomID(id []byte) {
+	rand.Read(id)
+}
+
+// 解析traceparent请求头：版本-traceId-parentId-标志
+func parseTraceparent(value string) (traceID [16]byte, parentID [8]byte, sampled bool, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, parentID, false, false
+	}
+	// 版本00不允许有多余的字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return traceID, parentID, false, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == ([16]byte{}) {
+		return traceID, parentID, false, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil || parentID == ([8]byte{}) {
+		return traceID, parentID, false, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return traceID, parentID, false, false
+	}
+	return traceID, parentID, flags&1 == 1, true
+}
+
+// 开始处理请求的span，请求带有traceparent时沿用调用方的追踪和采样决定
+func startServerSpan(r *http.Request, name string) (context.Context, *span) {
+	ctx := r.Context()
+	cfg := currentTracingConfig()
+	if !cfg.Enabled {
+		return ctx, nil
+	}
+
+	s := &span{name: name, kind: spanKindServer, start: time.Now()}
+	if traceID, parentID, sampled, ok := parseTraceparent(r.Header.Get(traceparentHeader)); ok {
+		s.traceID, s.parentID, s.sampled = traceID, parentID, sampled
+	} else {
+		randomID(s.traceID[:])
+		s.sampled = mathrand.Float64() < cfg.SampleRatio
+	}
+	randomID(s.spanID[:])
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+// 在上下文中的span下开始子span，未追踪的请求返回nil
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *span) {
+	s := spanFromContext(ctx).child(name, kind)
+	if s == nil {
+		return ctx, nil
+	}
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+// 创建子span
+func (s *span) child(name string, kind int) *span {
+	if s == nil {
+		return nil
+	}
+	c := &span{traceID: s.traceID, parentID: s.spanID, sampled: s.sampled, name: name, kind: kind, start: time.Now()}
+	randomID(c.spanID[:])
+	return c
+}
+
+// 设置属性，同名属性覆盖
+func (s *span) setAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.attrs {
+		if s.attrs[i].key == key {
+			s.attrs[i].value = value
+			return
+		}
+	}
+	s.attrs = append(s.attrs, spanAttr{key, value})
+}
+
+// 标记为失败，只保留第一次记录的错误
+func (s *span) setError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.errorMsg == "" {
+		s.errorMsg = err.Error()
+	}
+	s.mu.Unlock()
+}
+
+// 结束span，采样的span加入上报队列，重复调用时忽略
+func (s *span) finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if !s.sampled {
+		return
+	}
+	pendingSpansLock.Lock()
+	if len(pendingSpans) < maxPendingSpans {
+		pendingSpans = append(pendingSpans, s)
+	} else {
+		droppedSpans++
+	}
+	pendingSpansLock.Unlock()
+}
+
+// 生成发送给上游的traceparent，上游请求以该span为父span
+func (s *span) traceparent() string {
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(s.traceID[:]), hex.EncodeToString(s.spanID[:]), flags)
+}
+
+// 为上游请求记录DNS解析、建立连接、TLS握手和等待首字节的子span，重试和切换上游时每次尝试都会记录
+func withUpstreamTrace(ctx context.Context, parent *span) context.Context {
+	if parent == nil {
+		return ctx
+	}
+
+	var mu sync.Mutex
+	var dnsSpan, tlsSpan, waitSpan *span
+	connectSpans := map[string]*span{}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			parent.setAttr("net.connection.reused", info.Reused)
+		},
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			s := parent.child("dns", spanKindInternal)
+			s.setAttr("server.address", info.Host)
+			mu.Lock()
+			dnsSpan = s
+			mu.Unlock()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			mu.Lock()
+			s := dnsSpan
+			dnsSpan = nil
+			mu.Unlock()
+			s.setAttr("dns.addresses", len(info.Addrs))
+			s.setError(info.Err)
+			s.finish()
+		},
+		ConnectStart: func(network, addr string) {
+			s := parent.child("connect", spanKindInternal)
+			s.setAttr("network.transport", network)
+			s.setAttr("network.peer.address", addr)
+			mu.Lock()
+			connectSpans[addr] = s
+			mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mu.Lock()
+			s := connectSpans[addr]
+			delete(connectSpans, addr)
+			mu.Unlock()
+			s.setError(err)
+			s.finish()
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			tlsSpan = parent.child("tls", spanKindInternal)
+			mu.Unlock()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			mu.Lock()
+			s := tlsSpan
+			tlsSpan = nil
+			mu.Unlock()
+			if err == nil {
+				s.setAttr("tls.protocol.version", tlsVersionName(state.Version))
+				s.setAttr("tls.server.name", state.ServerName)
+			}
+			s.setError(err)
+			s.finish()
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			s := parent.child("wait first byte", spanKindInternal)
+			s.setError(info.Err)
+			mu.Lock()
+			waitSpan = s
+			mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			mu.Lock()
+			s := waitSpan
+			waitSpan = nil
+			mu.Unlock()
+			s.finish()
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace)
+}
+
+// TLS版本名称，与配置中的取值一致
+func tlsVersionName(v uint16) string {
+	for name, value := range tlsVersions {
+		if value == v {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%04x", v)
+}
+
+// 记录写入客户端的耗时，耗时长说明客户端接收慢
+type timedWriter struct {
+	io.Writer
+	elapsed time.Duration
+}
+
+func (w *timedWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := w.Writer.Write(p)
+	w.elapsed += time.Since(start)
+	return n, err
+}
+
+// 定期上报span
+func autoExportTraces() {
+	ticker := time.NewTicker(traceExportInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		flushTraces()
+	}
+}
+
+// 上报所有等待中的span
+func flushTraces() {
+	pendingSpansLock.Lock()
+	spans := pendingSpans
+	dropped := droppedSpans
+	pendingSpans = nil
+	droppedSpans = 0
+	pendingSpansLock.Unlock()
+
+	if dropped > 0 {
+		logWarn("等待上报的span过多，已丢弃", "dropped", dropped)
+	}
+	cfg := currentTracingConfig()
+	if !cfg.Enabled {
+		return
+	}
+	for len(spans) > 0 {
+		n := len(spans)
+		if n > traceExportBatchSize {
+			n = traceExportBatchSize
+		}
+		if err := exportSpans(cfg, spans[:n]); err != nil {
+			logWarn("上报追踪数据失败", "endpoint", cfg.Endpoint, "spans", n, "error", err)
+		}
+		spans = spans[n:]
+	}
+}
+
+// OTLP/HTTP JSON格式的请求体
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+// 转换为OTLP属性值，64位整数按规范编码为字符串
+func toOTLPValue(value interface{}) otlpValue {
+	switch v := value.(type) {
+	case string:
+		return otlpValue{StringValue: &v}
+	case bool:
+		return otlpValue{BoolValue: &v}
+	case int:
+		s := strconv.FormatInt(int64(v), 10)
+		return otlpValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return otlpValue{IntValue: &s}
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			s := fmt.Sprint(v)
+			return otlpValue{StringValue: &s}
+		}
+		return otlpValue{DoubleValue: &v}
+	}
+	s := fmt.Sprint(logValue(value))
+	return otlpValue{StringValue: &s}
+}
+
+// 转换为OTLP格式
+func (s *span) toOTLP() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+	}
+	if s.parentID != ([8]byte{}) {
+		result.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	for _, attr := range s.attrs {
+		result.Attributes = append(result.Attributes, otlpKeyValue{attr.key, toOTLPValue(attr.value)})
+	}
+	if s.errorMsg != "" {
+		result.Status = otlpStatus{Code: spanStatusError, Message: s.errorMsg}
+	}
+	return result
+}
+
+// 以OTLP/HTTP JSON格式发送到收集器
+func exportSpans(cfg TracingConfig, spans []*span) error {
+	otlpSpans := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		otlpSpans = append(otlpSpans, s.toOTLP())
+	}
+	payload := otlpTraceRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{
+			{"service.name", toOTLPValue(cfg.ServiceName)},
+			{"service.version", toOTLPValue(version)},
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "fastcode", Version: version},
+			Spans: otlpSpans,
+		}},
+	}}}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, cfg.Endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range cfg.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := traceExportClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("收集器返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// 填充追踪配置的默认值
+func fillTracingDefaults(tracing *TracingConfig) bool {
+	defaults := defaultConfig.Tracing
+	// 旧配置文件中没有追踪配置段时整体使用默认配置
+	if !tracing.Enabled && tracing.Endpoint == "" && tracing.ServiceName == "" && tracing.SampleRatio == 0 && tracing.Headers == nil {
+		*tracing = defaults
+		tracing.Headers = map[string]string{}
+		return true
+	}
+	updated := false
+	if tracing.Endpoint == "" {
+		tracing.Endpoint = defaults.Endpoint
+		updated = true
+	}
+	if tracing.ServiceName == "" {
+		tracing.ServiceName = defaults.ServiceName
+		updated = true
+	}
+	if tracing.Headers == nil {
+		tracing.Headers = map[string]string{}
+		updated = true
+	}
+	return updated
+}
+
+// 校验追踪配置
+func validateTracingConfig(cfg *Config) error {
+	u, err := url.Parse(cfg.Tracing.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &configValidationError{"tracing.endpoint", fmt.Sprintf("收集器地址无效: %s", cfg.Tracing.Endpoint)}
+	}
+	if cfg.Tracing.ServiceName == "" {
+		return &configValidationError{"tracing.serviceName", "服务名称不能为空"}
+	}
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		return &configValidationError{"tracing.sampleRatio", "采样比例必须在0到1之间"}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 在测试期间使用指定的追踪配置和独立的上报队列
+func setTestTracing(t *testing.T, tracing TracingConfig) {
+	t.Helper()
+	oldConfig := currentTracingConfig()
+	pendingSpansLock.Lock()
+	oldSpans, oldDropped := pendingSpans, droppedSpans
+	pendingSpans, droppedSpans = nil, 0
+	pendingSpansLock.Unlock()
+	refreshTracing(&Config{Tracing: tracing})
+	t.Cleanup(func() {
+		refreshTracing(&Config{Tracing: oldConfig})
+		pendingSpansLock.Lock()
+		pendingSpans, droppedSpans = oldSpans, oldDropped
+		pendingSpansLock.Unlock()
+	})
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		wantSampled bool
+		wantOK      bool
+	}{
+		{"采样", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"未采样", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", false, true},
+		{"未来版本允许多余字段", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"版本00有多余字段", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"无效版本", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"traceId全为0", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"parentId全为0", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"traceId长度错误", "00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01", false, false},
+		{"非十六进制", "00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01", false, false},
+		{"空值", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, sampled, ok := parseTraceparent(tt.value)
+			if sampled != tt.wantSampled || ok != tt.wantOK {
+				t.Errorf("parseTraceparent(%q) = %v, %v, want %v, %v", tt.value, sampled, ok, tt.wantSampled, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestStartServerSpan(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	setTestTracing(t, TracingConfig{})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, s := startServerSpan(req, "proxy"); s != nil {
+		t.Error("未启用追踪时不应创建span")
+	}
+
+	setTestTracing(t, TracingConfig{Enabled: true, SampleRatio: 0})
+	req.Header.Set(traceparentHeader, traceparent)
+	ctx, s := startServerSpan(req, "proxy")
+	if s == nil || spanFromContext(ctx) != s {
+		t.Fatal("应创建span并放入上下文")
+	}
+	// 沿用调用方的追踪和采样决定
+	if got := s.traceparent(); !strings.HasPrefix(got, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || !strings.HasSuffix(got, "-01") || got == traceparent {
+		t.Errorf("traceparent() = %q", got)
+	}
+
+	_, child := startSpan(ctx, "upstream", spanKindClient)
+	if child.traceID != s.traceID || child.parentID != s.spanID || !child.sampled {
+		t.Errorf("子span = %+v", child)
+	}
+	if _, none := startSpan(req.Context(), "upstream", spanKindClient); none != nil {
+		t.Error("未追踪的请求不应创建子span")
+	}
+
+	// 没有traceparent时按采样比例决定
+	req.Header.Del(traceparentHeader)
+	if _, s := startServerSpan(req, "proxy"); s.sampled || s.traceID == ([16]byte{}) {
+		t.Errorf("采样比例为0时不应采样: %+v", s)
+	}
+}
+
+func TestSpanFinish(t *testing.T) {
+	setTestTracing(t, TracingConfig{Enabled: true, SampleRatio: 1})
+	s := &span{sampled: true}
+	s.setAttr("status", 200)
+	s.setAttr("status", 502)
+	s.setError(errors.New("first"))
+	s.setError(errors.New("second"))
+	s.finish()
+	s.finish()
+	(&span{}).finish()
+	var nilSpan *span
+	nilSpan.setAttr("status", 200)
+	nilSpan.finish()
+
+	if len(pendingSpans) != 1 {
+		t.Fatalf("等待上报的span = %d, want 1", len(pendingSpans))
+	}
+	if len(s.attrs) != 1 || s.attrs[0].value != 502 || s.errorMsg != "first" {
+		t.Errorf("span属性 = %+v, error %q", s.attrs, s.errorMsg)
+	}
+}
+
+func TestToOTLPValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"字符串", "a", `{"stringValue":"a"}`},
+		{"布尔值", true, `{"boolValue":true}`},
+		{"整数", 42, `{"intValue":"42"}`},
+		{"64位整数", int64(1) << 40, `{"intValue":"1099511627776"}`},
+		{"浮点数", 1.5, `{"doubleValue":1.5}`},
+		{"NaN", math.NaN(), `{"stringValue":"NaN"}`},
+		{"错误", errors.New("timeout"), `{"stringValue":"timeout"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(toOTLPValue(tt.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("toOTLPValue(%v) = %s, want %s", tt.value, data, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlushTraces(t *testing.T) {
+	var got otlpTraceRequest
+	var auth string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer collector.Close()
+
+	setTestTracing(t, TracingConfig{
+		Enabled:     true,
+		Endpoint:    collector.URL,
+		ServiceName: "fastcode-test",
+		SampleRatio: 1,
+		Headers:     map[string]string{"Authorization": "Bearer token"},
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	ctx, root := startServerSpan(req, "proxy")
+	_, child := startSpan(ctx, "upstream", spanKindClient)
+	child.setError(errors.New("timeout"))
+	child.finish()
+	root.finish()
+	flushTraces()
+
+	if auth != "Bearer token" {
+		t.Errorf("Authorization = %q, want Bearer token", auth)
+	}
+	if len(got.ResourceSpans) != 1 || len(got.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("上报的数据 = %+v", got)
+	}
+	if name := got.ResourceSpans[0].Resource.Attributes[0].Value.StringValue; name == nil || *name != "fastcode-test" {
+		t.Errorf("service.name = %v, want fastcode-test", name)
+	}
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("上报的span = %d, want 2", len(spans))
+	}
+	if spans[0].Name != "upstream" || spans[0].ParentSpanID != spans[1].SpanID || spans[0].Status.Code != spanStatusError {
+		t.Errorf("子span = %+v", spans[0])
+	}
+	if spans[1].ParentSpanID != "" || spans[1].Kind != spanKindServer {
+		t.Errorf("根span = %+v", spans[1])
+	}
+	if len(pendingSpans) != 0 {
+		t.Errorf("上报后等待的span = %d, want 0", len(pendingSpans))
+	}
+}
+
+func TestValidateTracingConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    func(tracing *TracingConfig)
+		wantField string
+	}{
+		{"默认配置", func(tracing *TracingConfig) {}, ""},
+		{"收集器地址无效", func(tracing *TracingConfig) { tracing.Endpoint = "127.0.0.1:4318" }, "tracing.endpoint"},
+		{"服务名称为空", func(tracing *TracingConfig) { tracing.ServiceName = "" }, "tracing.serviceName"},
+		{"采样比例小于0", func(tracing *TracingConfig) { tracing.SampleRatio = -0.1 }, "tracing.sampleRatio"},
+		{"采样比例大于1", func(tracing *TracingConfig) { tracing.SampleRatio = 1.5 }, "tracing.sampleRatio"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			tt.modify(&cfg.Tracing)
+			err := validateTracingConfig(cfg)
+			field := ""
+			if validationErr, ok := err.(*configValidationError); ok {
+				field = validationErr.Field
+			}
+			if field != tt.wantField {
+				t.Errorf("validateTracingConfig() = %v, want field %q", err, tt.wantField)
+			}
+		})
+	}
+}
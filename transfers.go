@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 实时传输事件的默认推送间隔（秒）和最大间隔
+	defaultTransferStreamInterval = 1
+	maxTransferStreamInterval     = 60
+)
+
+// 进行中的代理传输
+type transfer struct {
+	id        int64
+	requestID string
+	client    string
+	apiKeyID  string
+	method    string
+	url       string // 已脱敏
+	rule      string
+	start     time.Time
+	bytes     int64 // 已发送给客户端的字节数
+	lastWrite int64 // 最近一次写入客户端的时间（UnixNano）
+	cancelled int32
+	cancel    context.CancelFunc
+
+	mu       sync.Mutex
+	upstream string
+	size     int64 // 响应体大小，-1表示未知
+}
+
+var (
+	transfers      = map[int64]*transfer{}
+	transfersLock  sync.Mutex
+	nextTransferID int64
+)
+
+// 登记进行中的传输，cancel用于中断上游请求
+func registerTransfer(entry *accessEntry, cancel context.CancelFunc) *transfer {
+	t := &transfer{
+		id:        atomic.AddInt64(&nextTransferID, 1),
+		requestID: entry.requestID,
+		client:    entry.clientIP,
+		apiKeyID:  entry.apiKeyID,
+		method:    entry.method,
+		url:       entry.target,
+		rule:      entry.rule,
+		start:     entry.start,
+		lastWrite: entry.start.UnixNano(),
+		cancel:    cancel,
+		size:      -1,
+	}
+	transfersLock.Lock()
+	transfers[t.id] = t
+	transfersLock.Unlock()
+	return t
+}
+
+// 传输结束后取消登记
+func (t *transfer) unregister() {
+	transfersLock.Lock()
+	delete(transfers, t.id)
+	transfersLock.Unlock()
+}
+
+// 记录选中的上游和响应体大小
+func (t *transfer) setResponse(upstream string, size int64) {
+	t.mu.Lock()
+	t.upstream = upstream
+	t.size = size
+	t.mu.Unlock()
+}
+
+// 是否已被取消
+func (t *transfer) isCancelled() bool {
+	return atomic.LoadInt32(&t.cancelled) == 1
+}
+
+// 统计写入客户端的字节数和时间
+func (t *transfer) writer(w io.Writer) io.Writer {
+	return &transferWriter{w: w, t: t}
+}
+
+type transferWriter struct {
+	w io.Writer
+	t *transfer
+}
+
+func (w *transferWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	atomic.AddInt64(&w.t.bytes, int64(n))
+	atomic.StoreInt64(&w.t.lastWrite, time.Now().UnixNano())
+	return n, err
+}
+
+// 传输的当前状态
+func (t *transfer) snapshot(now time.Time) gin.H {
+	t.mu.Lock()
+	upstream, size := t.upstream, t.size
+	t.mu.Unlock()
+
+	bytes := atomic.LoadInt64(&t.bytes)
+	duration := now.Sub(t.start).Seconds()
+	var rate int64
+	if duration > 0 {
+		rate = int64(float64(bytes) / duration)
+	}
+	return gin.H{
+		"id":             t.id,
+		"requestId":      t.requestID,
+		"client":         t.client,
+		"apiKeyId":       t.apiKeyID,
+		"method":         t.method,
+		"url":            t.url,
+		"rule":           t.rule,
+		"upstream":       upstream,
+		"start":          t.start,
+		"duration":       duration,
+		"bytes":          bytes,
+		"size":           size,
+		"bytesPerSecond": rate,
+		"idle":           now.Sub(time.Unix(0, atomic.LoadInt64(&t.lastWrite))).Seconds(),
+	}
+}
+
+// 所有进行中的传输，按开始顺序排列
+func transferSnapshots() []gin.H {
+	now := time.Now()
+	transfersLock.Lock()
+	result := make([]gin.H, 0, len(transfers))
+	for _, t := range transfers {
+		result = append(result, t.snapshot(now))
+	}
+	transfersLock.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i]["id"].(int64) < result[j]["id"].(int64)
+	})
+	return result
+}
+
+// 查看进行中的传输
+func getTransfers(c *gin.Context) {
+	c.JSON(http.StatusOK, transferSnapshots())
+}
+
+// 以Server-Sent Events持续推送进行中的传输
+func streamTransfers(c *gin.Context) {
+	interval := time.Duration(queryInt(c, "interval", defaultTransferStreamInterval, maxTransferStreamInterval)) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	// 禁止反向代理缓冲事件
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("transfers", transferSnapshots())
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ticker.C:
+		}
+		// 排空期间结束推送，避免阻塞关闭服务
+		if isDraining() {
+			return false
+		}
+		c.SSEvent("transfers", transferSnapshots())
+		return true
+	})
+}
+
+// 取消进行中的传输
+func deleteTransfer(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的传输ID"})
+		return
+	}
+
+	transfersLock.Lock()
+	t, ok := transfers[id]
+	transfersLock.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "传输不存在或已结束"})
+		return
+	}
+
+	atomic.StoreInt32(&t.cancelled, 1)
+	t.cancel()
+	logInfo("传输已通过管理API取消", "id", id, "requestId", t.requestID, "client", t.client, "url", t.url)
+	c.JSON(http.StatusOK, gin.H{"id": id, "cancelled": true})
+}
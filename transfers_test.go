@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 在测试期间使用独立的传输列表
+func resetTransfers(t *testing.T) {
+	t.Helper()
+	transfersLock.Lock()
+	oldTransfers := transfers
+	transfers = map[int64]*transfer{}
+	transfersLock.Unlock()
+	t.Cleanup(func() {
+		transfersLock.Lock()
+		transfers = oldTransfers
+		transfersLock.Unlock()
+	})
+}
+
+func TestTransferSnapshots(t *testing.T) {
+	resetTransfers(t)
+	start := time.Now().Add(-2 * time.Second)
+	first := registerTransfer(&accessEntry{start: start, requestID: "req-1", method: "GET", target: "https://github.com/a/b"}, func() {})
+	second := registerTransfer(&accessEntry{start: start, requestID: "req-2"}, func() {})
+
+	var buf bytes.Buffer
+	w := first.writer(&buf)
+	w.Write([]byte("0123456789"))
+	w.Write([]byte("0123456789"))
+	first.setResponse("mirror", 100)
+
+	snapshots := transferSnapshots()
+	if len(snapshots) != 2 || snapshots[0]["requestId"] != "req-1" || snapshots[1]["requestId"] != "req-2" {
+		t.Fatalf("transferSnapshots() = %v", snapshots)
+	}
+	got := snapshots[0]
+	if got["bytes"] != int64(20) || got["size"] != int64(100) || got["upstream"] != "mirror" || buf.Len() != 20 {
+		t.Errorf("传输状态 = %v", got)
+	}
+	if rate := got["bytesPerSecond"].(int64); rate <= 0 || rate > 10 {
+		t.Errorf("bytesPerSecond = %d, want 1 ~ 10", rate)
+	}
+	// 写入后空闲时间重新计算，未写入的传输从开始时间计算
+	if idle := got["idle"].(float64); idle >= 1 {
+		t.Errorf("写入后的空闲时间 = %v", idle)
+	}
+	if idle := snapshots[1]["idle"].(float64); idle < 2 || snapshots[1]["size"] != int64(-1) {
+		t.Errorf("未写入的传输 = %v", snapshots[1])
+	}
+
+	second.unregister()
+	if snapshots := transferSnapshots(); len(snapshots) != 1 {
+		t.Errorf("取消登记后传输数量 = %d, want 1", len(snapshots))
+	}
+}
+
+func TestDeleteTransfer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	resetTransfers(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entry := registerTransfer(&accessEntry{start: time.Now()}, cancel)
+	id := entry.id
+
+	router := gin.New()
+	router.DELETE("/transfers/:id", deleteTransfer)
+	tests := []struct {
+		name       string
+		id         string
+		wantStatus int
+	}{
+		{"无效的ID", "abc", http.StatusBadRequest},
+		{"传输不存在", "0", http.StatusNotFound},
+		{"取消传输", strconv.FormatInt(id, 10), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/transfers/"+tt.id, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("状态码 = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+	if !entry.isCancelled() || ctx.Err() == nil {
+		t.Error("传输应被取消")
+	}
+}
+
+func TestStreamTransfers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	resetTransfers(t)
+	registerTransfer(&accessEntry{start: time.Now(), requestID: "req-1"}, func() {})
+
+	router := gin.New()
+	router.GET("/transfers/stream", streamTransfers)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/transfers/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/event-stream") {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	// 连接后立即推送一次
+	reader := bufio.NewReader(resp.Body)
+	event, err := reader.ReadString('\n')
+	if err != nil || event != "event:transfers\n" {
+		t.Fatalf("事件 = %q, %v", event, err)
+	}
+	data, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshots []map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(data, "data:")), &snapshots); err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || snapshots[0]["requestId"] != "req-1" {
+		t.Errorf("推送的传输 = %v", snapshots)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -22,11 +23,14 @@ func checkUpdate() (*UpdateInfo, error) {
 	// GitHub API URL
 	apiURL := "https://api.github.com/repos/TBeduCN/FastCode/releases/latest"
 
-	// 发送请求
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+	// 发送请求，使用代理请求共用的HTTP客户端和default规则的出站代理
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, err
 	}
-	resp, err := client.Get(apiURL)
+	resp, err := currentHTTPClient().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("获取最新版本信息失败: %v", err)
 	}
@@ -75,19 +79,18 @@ func checkForUpdates() {
 	// 获取最新版本信息
 	updateInfo, err := checkUpdate()
 	if err != nil {
-		printfWithTime("检查更新失败: %v\n", err)
+		logWarn("检查更新失败", "error", err)
 		return
 	}
 
 	// 检查是否需要更新
 	if needUpdate(version, updateInfo.TagName) {
-		printfWithTime("发现新版本: %s\n", updateInfo.TagName)
-		printfWithTime("当前版本: %s\n", version)
-		printlnWithTime("更新内容:")
-		printlnWithTime(updateInfo.Body)
-		printlnWithTime("请访问GitHub页面下载最新版本:")
-		printlnWithTime("https://github.com/TBeduCN/FastCode/releases")
+		logInfo("发现新版本，请访问GitHub页面下载最新版本",
+			"latest", updateInfo.TagName,
+			"current", version,
+			"changes", updateInfo.Body,
+			"url", "https://github.com/TBeduCN/FastCode/releases")
 	} else {
-		printfWithTime("当前已是最新版本: %s\n", version)
+		logInfo("当前已是最新版本", "version", version)
 	}
 }
@@ -19,21 +19,17 @@ func generateUUID() string {
 		uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
 }
 
-// 带时间戳的打印函数
-func printWithTime(format string, args ...interface{}) {
-	timeStr := time.Now().Format("[15:04:05]")
-	fmt.Printf(timeStr+" "+format, args...)
+// 将秒数转换为时间间隔
+func seconds(n int64) time.Duration {
+	return time.Duration(n) * time.Second
 }
 
-// 带时间戳的.Println函数
-func printlnWithTime(args ...interface{}) {
-	timeStr := time.Now().Format("[15:04:05]")
-	fmt.Print(timeStr + " ")
-	fmt.Println(args...)
-}
-
-// 带时间戳的.Printf函数
-func printfWithTime(format string, args ...interface{}) {
-	timeStr := time.Now().Format("[15:04:05]")
-	fmt.Printf(timeStr+" "+format, args...)
+// 列表中是否包含字符串
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
 }